@@ -129,18 +129,19 @@ func prepareWindow(windowSize, windowOffset, truncateTo string) (models.JobSpecT
 	window.Size = time.Hour * 24
 	window.Offset = 0
 	window.TruncateTo = "d"
+	window.Unset = windowSize == "" && windowOffset == "" && truncateTo == ""
 
 	if truncateTo != "" {
 		window.TruncateTo = truncateTo
 	}
 	if windowSize != "" {
-		window.Size, err = time.ParseDuration(windowSize)
+		window.Size, err = models.ParseWindowDuration(windowSize)
 		if err != nil {
 			return window, errors.Wrapf(err, "failed to parse task window with size %v", windowSize)
 		}
 	}
 	if windowOffset != "" {
-		window.Offset, err = time.ParseDuration(windowOffset)
+		window.Offset, err = models.ParseWindowDuration(windowOffset)
 		if err != nil {
 			return window, errors.Wrapf(err, "failed to parse task window with offset %v", windowOffset)
 		}
@@ -163,6 +164,14 @@ func (adapt *Adapter) ToJobProto(spec models.JobSpec) (*pb.JobSpecification, err
 		})
 	}
 
+	// windows the job doesn't configure are left empty
+	var windowSize, windowOffset, windowTruncateTo string
+	if !spec.Task.Window.Unset {
+		windowSize = spec.Task.Window.SizeString()
+		windowOffset = spec.Task.Window.OffsetString()
+		windowTruncateTo = spec.Task.Window.TruncateTo
+	}
+
 	conf := &pb.JobSpecification{
 		Version:          int32(spec.Version),
 		Name:             spec.Name,
@@ -172,9 +181,9 @@ func (adapt *Adapter) ToJobProto(spec models.JobSpec) (*pb.JobSpecification, err
 		DependsOnPast:    spec.Behavior.DependsOnPast,
 		CatchUp:          spec.Behavior.CatchUp,
 		TaskName:         spec.Task.Unit.Info().Name,
-		WindowSize:       spec.Task.Window.SizeString(),
-		WindowOffset:     spec.Task.Window.OffsetString(),
-		WindowTruncateTo: spec.Task.Window.TruncateTo,
+		WindowSize:       windowSize,
+		WindowOffset:     windowOffset,
+		WindowTruncateTo: windowTruncateTo,
 		Assets:           spec.Assets.ToMap(),
 		Dependencies:     []*pb.JobDependency{},
 		Hooks:            adaptedHook,
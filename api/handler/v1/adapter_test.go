@@ -107,6 +107,14 @@ func TestAdapter(t *testing.T) {
 		original, err := adapter.FromJobProto(inProto)
 		assert.Equal(t, jobSpec, original)
 		assert.Nil(t, err)
+
+		jobSpec.Task.Window = models.JobSpecTaskWindow{Size: 24 * time.Hour, TruncateTo: "d", Unset: true}
+		inProto, err = adapter.ToJobProto(jobSpec)
+		assert.Nil(t, err)
+		assert.Equal(t, "", inProto.WindowSize)
+		original, err = adapter.FromJobProto(inProto)
+		assert.Nil(t, err)
+		assert.Equal(t, jobSpec, original)
 	})
 }
 
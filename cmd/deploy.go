@@ -22,6 +22,10 @@ import (
 
 var (
 	deploymentTimeout = time.Minute * 10
+
+	// catchupRunsWarnThreshold is the count of catch up runs above which
+	// user is warned before deploying a job
+	catchupRunsWarnThreshold = 100
 )
 
 // deployCommand pushes current repo to optimus service
@@ -31,6 +35,7 @@ func deployCommand(l logger, conf config.Provider, jobSpecRepo JobSpecRepository
 	var namespace string
 	var ignoreJobs bool
 	var ignoreResources bool
+	var strict bool
 
 	cmd := &cli.Command{
 		Use:   "deploy",
@@ -42,6 +47,7 @@ func deployCommand(l logger, conf config.Provider, jobSpecRepo JobSpecRepository
 	cmd.MarkFlagRequired("namespace")
 	cmd.Flags().BoolVar(&ignoreJobs, "ignore-jobs", false, "ignore deployment of jobs")
 	cmd.Flags().BoolVar(&ignoreResources, "ignore-resources", false, "ignore deployment of resources")
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail deployment of jobs with schedule interval finer than window instead of warning")
 
 	cmd.RunE = func(c *cli.Command, args []string) error {
 		l.Printf("deploying project %s for namespace %s at %s\nplease wait...\n", projectName, namespace, conf.GetHost())
@@ -52,7 +58,7 @@ func deployCommand(l logger, conf config.Provider, jobSpecRepo JobSpecRepository
 		}
 
 		if err := postDeploymentRequest(l, projectName, namespace, jobSpecRepo, conf, pluginRepo, datastoreRepo,
-			datastoreSpecFs, ignoreJobs, ignoreResources); err != nil {
+			datastoreSpecFs, ignoreJobs, ignoreResources, strict); err != nil {
 			return err
 		}
 
@@ -66,7 +72,7 @@ func deployCommand(l logger, conf config.Provider, jobSpecRepo JobSpecRepository
 // postDeploymentRequest send a deployment request to service
 func postDeploymentRequest(l logger, projectName string, namespace string, jobSpecRepo JobSpecRepository,
 	conf config.Provider, pluginRepo models.PluginRepository, datastoreRepo models.DatastoreRepo, datastoreSpecFs map[string]afero.Fs,
-	ignoreJobDeployment, ignoreResources bool) (err error) {
+	ignoreJobDeployment, ignoreResources, strict bool) (err error) {
 	dialTimeoutCtx, dialCancel := context.WithTimeout(context.Background(), OptimusDialTimeout)
 	defer dialCancel()
 
@@ -181,8 +187,25 @@ func postDeploymentRequest(l logger, projectName string, namespace string, jobSp
 			return err
 		}
 
+		// start mode of the project decides catch up of jobs not setting it
+		projectSpec := adapt.FromProjectProto(&pb.ProjectSpecification{
+			Name:   projectName,
+			Config: conf.GetProjectConfig().Global,
+		})
 		var adaptedJobSpecs []*pb.JobSpecification
 		for _, spec := range jobSpecs {
+			if spec.StartModeIn(projectSpec).CatchUp(spec.Behavior.CatchUp) {
+				if catchupRuns, err := spec.ExpectedCatchupRuns(time.Now()); err == nil && catchupRuns > catchupRunsWarnThreshold {
+					l.Println(coloredNotice(fmt.Sprintf("warning: %s has catchup enabled and will trigger %d runs since %s",
+						spec.Name, catchupRuns, spec.Schedule.StartDate.Format(models.JobDatetimeLayout))))
+				}
+			}
+			if err := spec.ValidateWindowGrain(); errors.Is(err, models.ErrIntervalFinerThanWindow) {
+				if strict {
+					return err
+				}
+				l.Println(coloredNotice(fmt.Sprintf("warning: %s", err)))
+			}
 			adaptJob, err := adapt.ToJobProto(spec)
 			if err != nil {
 				return errors.Wrapf(err, "failed to serialize: %s", spec.Name)
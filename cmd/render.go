@@ -18,8 +18,7 @@ import (
 )
 
 var (
-	renderTimeout  = time.Minute * 2
-	templateEngine = instance.NewGoEngine()
+	renderTimeout = time.Minute * 2
 )
 
 func renderCommand(l logger, host string, jobSpecRepo JobSpecRepository) *cli.Command {
@@ -64,6 +63,10 @@ func renderTemplateCommand(l logger, jobSpecRepo JobSpecRepository) *cli.Command
 		now := time.Now()
 		l.Println("assuming execution time as current time of", now.Format(models.InstanceScheduledAtTimeLayout))
 
+		templateEngine, err := instance.NewGoEngine()
+		if err != nil {
+			return err
+		}
 		templates, err := instance.DumpAssets(jobSpec, now, templateEngine, true)
 		if err != nil {
 			return err
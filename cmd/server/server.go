@@ -19,6 +19,7 @@ import (
 	"github.com/odpf/optimus/utils"
 
 	"github.com/odpf/optimus/ext/scheduler/airflow"
+	"github.com/odpf/optimus/ext/scheduler/webhook"
 
 	"github.com/odpf/optimus/config"
 
@@ -64,6 +65,9 @@ var (
 
 	shutdownWait = 30 * time.Second
 
+	// dagLintTimeout bounds each call to the dag linter of a project
+	dagLintTimeout = 30 * time.Second
+
 	GRPCMaxRecvMsgSize = 45 << 20 // 45MB
 )
 
@@ -116,6 +120,11 @@ func (fac *jobRepoFactory) New(ctx context.Context, proj models.ProjectSpec) (st
 		return nil, errors.Errorf("%s secret not configured for project %s", models.ProjectSecretStorageKey, proj.Name)
 	}
 
+	storagePrefix, err := proj.StoragePrefix()
+	if err != nil {
+		return nil, err
+	}
+
 	p, err := url.Parse(storagePath)
 	if err != nil {
 		return nil, err
@@ -126,7 +135,7 @@ func (fac *jobRepoFactory) New(ctx context.Context, proj models.ProjectSpec) (st
 		if err != nil {
 			return nil, errors.Wrap(err, "error creating google storage client")
 		}
-		return gcs.NewJobRepository(p.Hostname(), filepath.Join(p.Path, fac.schd.GetJobsDir()), fac.schd.GetJobsExtension(), storageClient), nil
+		return gcs.NewJobRepository(p.Hostname(), filepath.Join(p.Path, storagePrefix, fac.schd.GetJobsDir()), fac.schd.GetJobsExtension(), storageClient), nil
 	}
 	return nil, errors.Errorf("unsupported storage config %s in %s of project %s", storagePath, models.ProjectStoragePathKey, proj.Name)
 }
@@ -226,8 +235,7 @@ func (obs *pipelineLogObserver) Notify(evt progress.Event) {
 	obs.log.Info(evt)
 }
 
-func jobSpecAssetDump() func(jobSpec models.JobSpec, scheduledAt time.Time) (models.JobAssets, error) {
-	engine := instance.NewGoEngine()
+func jobSpecAssetDump(engine models.TemplateEngine) func(jobSpec models.JobSpec, scheduledAt time.Time) (models.JobAssets, error) {
 	return func(jobSpec models.JobSpec, scheduledAt time.Time) (models.JobAssets, error) {
 		aMap, err := instance.DumpAssets(jobSpec, scheduledAt, engine, false)
 		if err != nil {
@@ -285,6 +293,10 @@ func Initialize(conf config.Provider) error {
 	if err != nil {
 		return errors.Wrap(err, "postgres.Connect")
 	}
+	templateEngine, err := instance.NewGoEngine()
+	if err != nil {
+		return errors.Wrap(err, "instance.NewGoEngine")
+	}
 
 	// init default scheduler
 	switch conf.GetScheduler().Name {
@@ -298,6 +310,8 @@ func Initialize(conf config.Provider) error {
 			&objectWriterFactory{},
 			&http.Client{},
 		)
+	case "webhook":
+		models.Scheduler = webhook.NewScheduler(&http.Client{})
 	default:
 		return errors.Errorf("unsupported scheduler: %s", conf.GetScheduler().Name)
 	}
@@ -351,7 +365,11 @@ func Initialize(conf config.Provider) error {
 		db:                    dbConn,
 		projectJobSpecRepoFac: projectJobSpecRepoFac,
 	}
-	jobCompiler := job.NewCompiler(models.Scheduler.GetTemplate(), conf.GetServe().IngressHost)
+	var jobCompiler models.JobCompiler = job.NewCompiler(models.Scheduler.GetTemplate(), conf.GetServe().IngressHost)
+	if conf.GetScheduler().Name == "airflow2" {
+		// dags of projects configuring an external linter are linted on compile
+		jobCompiler = airflow2.NewLintingCompiler(jobCompiler, &http.Client{}, dagLintTimeout)
+	}
 	dependencyResolver := job.NewDependencyResolver()
 	priorityResolver := job.NewPriorityResolver()
 
@@ -432,7 +450,7 @@ func Initialize(conf config.Provider) error {
 				schd: models.Scheduler,
 			},
 			jobCompiler,
-			jobSpecAssetDump(),
+			jobSpecAssetDump(templateEngine),
 			dependencyResolver,
 			priorityResolver,
 			metaSvcFactory,
@@ -453,7 +471,7 @@ func Initialize(conf config.Provider) error {
 			func() time.Time {
 				return time.Now().UTC()
 			},
-			instance.NewGoEngine(),
+			templateEngine,
 		),
 		models.Scheduler,
 	))
@@ -11,9 +11,18 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/odpf/optimus/config"
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/job"
 	"github.com/odpf/optimus/models"
 	"github.com/odpf/optimus/store"
 	"github.com/pkg/errors"
@@ -29,12 +38,75 @@ var resBaseDAG []byte
 
 const (
 	baseLibFileName   = "__lib.py"
-	dagStatusUrl      = "api/v1/dags/%s/dagRuns?limit=99999"
-	dagStatusBatchUrl = "api/v1/dags/~/dagRuns/list"
-	dagRunClearURL    = "api/v1/dags/%s/clearTaskInstances"
+	jobsExtension     = ".py"
+	dagStatusUrl      = "dags/%s/dagRuns?limit=99999"
+	dagStatusPageURL  = "dags/%s/dagRuns?limit=%d&offset=%d&order_by=execution_date"
+	activeDagRunsURL  = "dags/%s/dagRuns?state=queued&state=running&limit=%d&offset=%d"
+	dagStatusBatchUrl = "dags/~/dagRuns/list"
+	dagRunClearURL    = "dags/%s/clearTaskInstances"
+	dagURL            = "dags/%s"
+	dagPauseURL       = "dags/%s?update_mask=is_paused"
+	dagSourceURL      = "dagSources/%s"
+	dagRunURL         = "dags/%s/dagRuns/%s"
+	dagRunsURL        = "dags/%s/dagRuns"
+	versionURL        = "version"
+	configURL         = "config"
+	dagParseURL       = "parseDagFile/%s"
+	dagRunNoteURL     = "dags/%s/dagRuns/%s/setNote"
+	taskInstancesURL  = "dags/%s/dagRuns/%s/taskInstances?limit=%d&offset=%d"
+	taskLogURL        = "dags/%s/dagRuns/%s/taskInstances/%s/logs/%d?full_content=true"
 	airflowDateFormat = "2006-01-02T15:04:05+00:00"
+
+	// base path of the stable airflow api, endpoints above are relative to
+	// it, projects can configure another with models.ProjectSchedulerAPIBasePath
+	defaultAPIBasePath = "api/v1"
+
+	// minimum airflow version supporting update of dag run state
+	markRunStateMinVersion = "2.2.0"
+
+	// minimum airflow version supporting reparse of a dag file
+	refreshDagMinVersion = "2.6.0"
+
+	// minimum airflow version supporting notes on dag runs
+	runNoteMinVersion = "2.5.0"
+
+	// page size used when fetching runs of a job in a range
+	dagRunBatchSize = 100
+
+	// bytes read at most from a response unless configured otherwise
+	defaultMaxResponseSize = 64 << 20
+)
+
+var (
+	// ErrRunAlreadyFinished is returned when cancelling a dag run which
+	// has already finished
+	ErrRunAlreadyFinished = errors.New("dag run has already finished")
+
+	// classification of failed airflow api calls, errors returned by the
+	// scheduler can be checked against these with errors.Is to decide if
+	// the call is worth retrying
+	ErrTransient = errors.New("transient airflow failure")
+	ErrNotFound  = errors.New("airflow resource not found")
+	ErrAuth      = errors.New("airflow authentication failed")
+	ErrFatal     = errors.New("fatal airflow failure")
+
+	// classification of unusable storage of a project, errors returned by
+	// VerifyStorage and Bootstrap can be checked against these with errors.Is
+	ErrStorageNotConfigured = errors.New("storage not configured")
+	ErrInvalidStoragePath   = errors.New("invalid storage path")
+	ErrInvalidStorageSecret = errors.New("invalid storage secret")
+	ErrStorageUnreachable   = errors.New("storage unreachable")
+	ErrStorageProbeCleanup  = errors.New("failed to delete storage probe")
+
+	// ErrConfigNotExposed is returned when reading config of an airflow
+	// which doesn't expose it, see expose_config in the webserver section
+	ErrConfigNotExposed = errors.New("airflow config is not exposed")
 )
 
+// supportedStorageSchemes are the schemes of storage paths dags can be
+// written to
+var supportedStorageSchemes = []string{"gs"}
+
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -43,16 +115,129 @@ type ObjectWriterFactory interface {
 	New(ctx context.Context, writerPath, writerSecret string) (store.ObjectWriter, error)
 }
 
+// scheduler is safe for concurrent use by multiple goroutines. Its only
+// shared mutable state is the token buckets of clearLimiter, which
+// projectRateLimiter guards with a mutex, the rest is set at construction.
+// The http client and object writer factory it is built with are expected
+// to be safe for concurrent use as well. Any state added later, e.g.
+// caches, must be guarded accordingly
 type scheduler struct {
 	objWriterFac ObjectWriterFactory
 	httpClient   HttpClient
+
+	// limits clear operations per project, nil if unlimited
+	clearLimiter *projectRateLimiter
+
+	metrics models.MetricsRecorder
+
+	// identifies optimus as source of requests to airflow
+	userAgent string
+
+	// extension of compiled dags and name of the shared lib they import
+	jobsExtension string
+	libFileName   string
+
+	// bytes read at most from responses parsed in memory
+	maxResponseSize int64
+
+	// sends PATCH and DELETE requests as POST with methodOverrideHeader
+	overrideMethods bool
+}
+
+const (
+	metricAPICalls        = "scheduler_api_calls_total"
+	metricAPICallDuration = "scheduler_api_call_duration"
+)
+
+// Option customizes the scheduler at construction
+type Option func(*scheduler)
+
+// WithClearRateLimit limits clear operations of each project to opsPerSec
+// allowing bursts of up to burst operations, avoiding airflow rate limits
+// on mass backfills
+func WithClearRateLimit(opsPerSec float64, burst int) Option {
+	return func(a *scheduler) {
+		if opsPerSec <= 0 {
+			a.clearLimiter = nil
+			return
+		}
+		a.clearLimiter = newProjectRateLimiter(opsPerSec, burst)
+	}
+}
+
+// WithMetrics sets the recorder of api calls made to airflow
+func WithMetrics(recorder models.MetricsRecorder) Option {
+	return func(a *scheduler) {
+		if recorder == nil {
+			recorder = models.NoopMetrics{}
+		}
+		a.metrics = recorder
+	}
+}
+
+// WithUserAgent sets the User-Agent of requests made to airflow, defaults
+// to optimus/<version>. An empty user agent leaves the header unset
+func WithUserAgent(userAgent string) Option {
+	return func(a *scheduler) {
+		a.userAgent = userAgent
+	}
+}
+
+// WithJobsExtension sets extension of compiled dags, for custom executors
+// expecting a different one than .py
+func WithJobsExtension(extension string) Option {
+	return func(a *scheduler) {
+		if extension != "" && !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		a.jobsExtension = extension
+	}
+}
+
+// WithLibFileName sets name of the shared lib uploaded with dags on
+// bootstrap, defaults to __lib.py
+func WithLibFileName(name string) Option {
+	return func(a *scheduler) {
+		a.libFileName = name
+	}
 }
 
-func NewScheduler(ow ObjectWriterFactory, httpClient HttpClient) *scheduler {
-	return &scheduler{
-		objWriterFac: ow,
-		httpClient:   httpClient,
+// WithMaxResponseSize caps the bytes read from responses of airflow which
+// are parsed in memory, guarding against huge bodies exhausting memory.
+// Defaults to 64MiB, streamed responses like task logs are not capped
+func WithMaxResponseSize(maxBytes int64) Option {
+	return func(a *scheduler) {
+		a.maxResponseSize = maxBytes
+	}
+}
+
+// methodOverrideHeader carries the method of requests tunneled as POST
+const methodOverrideHeader = "X-HTTP-Method-Override"
+
+// WithMethodOverride sends PATCH and DELETE requests to airflow as POST
+// with the intended method in the X-HTTP-Method-Override header, for
+// proxies which only allow GET and POST
+func WithMethodOverride() Option {
+	return func(a *scheduler) {
+		a.overrideMethods = true
+	}
+}
+
+func NewScheduler(ow ObjectWriterFactory, httpClient HttpClient, opts ...Option) *scheduler {
+	a := &scheduler{
+		objWriterFac:  ow,
+		httpClient:    httpClient,
+		metrics:       models.NoopMetrics{},
+		userAgent:     fmt.Sprintf("optimus/%s", config.Version),
+		jobsExtension: jobsExtension,
+		libFileName:   baseLibFileName,
+
+		maxResponseSize: defaultMaxResponseSize,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *scheduler) GetName() string {
@@ -64,7 +249,7 @@ func (a *scheduler) GetJobsDir() string {
 }
 
 func (a *scheduler) GetJobsExtension() string {
-	return ".py"
+	return a.jobsExtension
 }
 
 func (a *scheduler) GetTemplate() []byte {
@@ -72,24 +257,168 @@ func (a *scheduler) GetTemplate() []byte {
 }
 
 func (a *scheduler) Bootstrap(ctx context.Context, proj models.ProjectSpec) error {
+	return a.BootstrapProject(ctx, proj, false)
+}
+
+// BootstrapProject validates storage configuration of the project and uploads
+// the shared lib used by dags, skipLib can be set where the lib is already
+// present, e.g. in ci environments
+func (a *scheduler) BootstrapProject(ctx context.Context, proj models.ProjectSpec, skipLib bool) error {
+	storage, err := resolveStorage(proj)
+	if err != nil {
+		return err
+	}
+	if skipLib {
+		return nil
+	}
+	objectWriter, err := a.objWriterFac.New(ctx, storage.path, storage.secret)
+	if err != nil {
+		return errors.Errorf("object writer failed for %s", proj.Name)
+	}
+	return a.migrateLibFileToWriter(ctx, objectWriter, storage.bucket, a.jobsObjectPath(storage, a.libFileName))
+}
+
+// jobsObjectPath returns path of the object in the jobs dir of the storage
+func (a *scheduler) jobsObjectPath(storage storageLocation, name string) string {
+	return filepath.Join(storage.dir, a.GetJobsDir(), name)
+}
+
+// storageProbeFileName is written and deleted by VerifyStorage under the
+// storage path of the project
+const storageProbeFileName = ".optimus_storage_probe"
+
+// VerifyStorage checks storage configured for the project is usable without
+// uploading anything for good, by validating its path and secret and then
+// writing a probe object which is deleted right after. The probe is left
+// in place by object writers which can't delete, see store.ObjectDeleter.
+// Failures can be told apart with errors.Is against the ErrStorage* errors
+func VerifyStorage(ctx context.Context, proj models.ProjectSpec, owf ObjectWriterFactory) error {
+	storage, err := resolveStorage(proj)
+	if err != nil {
+		return err
+	}
+	objectWriter, err := owf.New(ctx, storage.path, storage.secret)
+	if err != nil {
+		return &storageError{kind: ErrStorageUnreachable,
+			err: errors.Wrapf(err, "failed to connect to storage of project %s", proj.Name)}
+	}
+
+	probePath := filepath.Join(storage.dir, storageProbeFileName)
+	dst, err := objectWriter.NewWriter(ctx, storage.bucket, probePath)
+	if err == nil {
+		_, err = io.WriteString(dst, "probe")
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return &storageError{kind: ErrStorageUnreachable,
+			err: errors.Wrapf(err, "failed to write probe to storage of project %s", proj.Name)}
+	}
+
+	if deleter, ok := objectWriter.(store.ObjectDeleter); ok {
+		if err := deleter.Delete(ctx, storage.bucket, probePath); err != nil {
+			return &storageError{kind: ErrStorageProbeCleanup,
+				err: errors.Wrapf(err, "failed to delete probe %s from storage of project %s", probePath, proj.Name)}
+		}
+	}
+	return nil
+}
+
+// storageLocation is where objects of a project are written to
+type storageLocation struct {
+	path   string
+	secret string
+	bucket string
+
+	// dir in the bucket objects are written under, storage prefix included
+	dir string
+}
+
+// resolveStorage validates storage configuration of the project and
+// resolves where its objects are written to
+func resolveStorage(proj models.ProjectSpec) (storageLocation, error) {
 	storagePath, ok := proj.Config[models.ProjectStoragePathKey]
 	if !ok {
-		return errors.Errorf("%s config not configured for project %s", models.ProjectStoragePathKey, proj.Name)
+		return storageLocation{}, &storageError{kind: ErrStorageNotConfigured,
+			err: errors.Errorf("%s config not configured for project %s", models.ProjectStoragePathKey, proj.Name)}
 	}
 	storageSecret, ok := proj.Secret.GetByName(models.ProjectSecretStorageKey)
 	if !ok {
-		return errors.Errorf("%s secret not configured for project %s", models.ProjectSecretStorageKey, proj.Name)
+		return storageLocation{}, &storageError{kind: ErrStorageNotConfigured,
+			err: errors.Errorf("%s secret not configured for project %s", models.ProjectSecretStorageKey, proj.Name)}
 	}
 
 	p, err := url.Parse(storagePath)
 	if err != nil {
-		return err
+		return storageLocation{}, &storageError{kind: ErrInvalidStoragePath,
+			err: errors.Wrapf(err, "failed to parse %s %s of project %s", models.ProjectStoragePathKey, storagePath, proj.Name)}
+	}
+	if !isSupportedStorageScheme(p.Scheme) || p.Hostname() == "" {
+		return storageLocation{}, &storageError{kind: ErrInvalidStoragePath,
+			err: errors.Errorf("invalid %s %s of project %s, expected a path like gs://bucket/path",
+				models.ProjectStoragePathKey, storagePath, proj.Name)}
 	}
-	objectWriter, err := a.objWriterFac.New(ctx, storagePath, storageSecret)
+	if err := validateStorageSecret(storageSecret); err != nil {
+		return storageLocation{}, &storageError{kind: ErrInvalidStorageSecret,
+			err: errors.Wrapf(err, "invalid storage secret %s of project %s", models.ProjectSecretStorageKey, proj.Name)}
+	}
+	storagePrefix, err := proj.StoragePrefix()
 	if err != nil {
-		return errors.Errorf("object writer failed for %s", proj.Name)
+		return storageLocation{}, &storageError{kind: ErrInvalidStoragePath, err: err}
+	}
+	return storageLocation{
+		path:   storagePath,
+		secret: storageSecret,
+		bucket: p.Hostname(),
+		dir:    filepath.Join(strings.Trim(p.Path, "/"), storagePrefix),
+	}, nil
+}
+
+// storageError is returned for unusable storage of a project, classified
+// by one of the ErrStorage* errors
+type storageError struct {
+	kind error
+	err  error
+}
+
+func (e *storageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+func (e *storageError) Is(target error) bool {
+	return target == e.kind
+}
+
+// validateStorageSecret checks the storage secret is usable before handing
+// it to the object writer, whose errors on malformed credentials are hard to
+// trace back to the secret. The secret itself is never part of the error
+func validateStorageSecret(secret string) error {
+	trimmed := strings.TrimSpace(secret)
+	if trimmed == "" {
+		return errors.New("secret is empty")
+	}
+	if !utf8.ValidString(trimmed) {
+		return errors.New("secret is not valid text, it may have been decrypted with a wrong key")
+	}
+	// credentials of gcs are json documents
+	if strings.HasPrefix(trimmed, "{") && !json.Valid([]byte(trimmed)) {
+		return errors.New("secret is not a valid json document")
+	}
+	return nil
+}
+
+func isSupportedStorageScheme(scheme string) bool {
+	for _, supported := range supportedStorageSchemes {
+		if scheme == supported {
+			return true
+		}
 	}
-	return a.migrateLibFileToWriter(ctx, objectWriter, p.Hostname(), filepath.Join(strings.Trim(p.Path, "/"), a.GetJobsDir(), baseLibFileName))
+	return false
 }
 
 func (a *scheduler) migrateLibFileToWriter(ctx context.Context, objWriter store.ObjectWriter, bucket, objPath string) (err error) {
@@ -114,35 +443,9 @@ func (a *scheduler) migrateLibFileToWriter(ctx context.Context, objWriter store.
 
 func (a *scheduler) GetJobStatus(ctx context.Context, projSpec models.ProjectSpec, jobName string) ([]models.JobStatus,
 	error) {
-	schdHost, ok := projSpec.Config[models.ProjectSchedulerHost]
-	if !ok {
-		return nil, errors.Errorf("scheduler host not set for %s", projSpec.Name)
-	}
-	schdHost = strings.Trim(schdHost, "/")
-	authToken, ok := projSpec.Secret.GetByName(models.ProjectSchedulerAuth)
-	if !ok {
-		return nil, errors.Errorf("%s secret not configured for project %s", models.ProjectSchedulerAuth, projSpec.Name)
-	}
-
-	fetchURL := fmt.Sprintf(fmt.Sprintf("%s/%s", schdHost, dagStatusUrl), jobName)
-	request, err := http.NewRequest(http.MethodGet, fetchURL, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to build http request for %s", fetchURL)
-	}
-	request.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authToken))))
-
-	resp, err := a.httpClient.Do(request)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to fetch airflow dag runs from %s", fetchURL)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("failed to fetch airflow dag runs from %s: %d", fetchURL, resp.StatusCode)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagStatusUrl, nil, jobName)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read airflow response")
+		return nil, errors.Wrapf(err, "failed to fetch airflow dag runs of %s", jobName)
 	}
 
 	//{
@@ -170,56 +473,394 @@ func (a *scheduler) GetJobStatus(ctx context.Context, projSpec models.ProjectSpe
 	return toJobStatus(responseJson.DagRuns, jobName)
 }
 
+// GetJobStatusPage returns a page of at most limit runs of the job ordered
+// by execution date, starting at the cursor, empty for the first page. The
+// returned cursor fetches the next page and is empty after the last one
+func (a *scheduler) GetJobStatusPage(ctx context.Context, projSpec models.ProjectSpec, jobName string, cursor string,
+	limit int) ([]models.JobStatus, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.Errorf("invalid page limit %d", limit)
+	}
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagStatusPageURL, nil, jobName, limit, offset)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to fetch airflow dag runs of %s", jobName)
+	}
+	var responseJson struct {
+		DagRuns      []map[string]interface{} `json:"dag_runs"`
+		TotalEntries int                      `json:"total_entries"`
+	}
+	if err := json.Unmarshal(body, &responseJson); err != nil {
+		return nil, "", errors.Wrapf(err, "json error: %s", string(body))
+	}
+	jobStatus, err := toJobStatus(responseJson.DagRuns, jobName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if next := offset + len(responseJson.DagRuns); len(responseJson.DagRuns) > 0 && next < responseJson.TotalEntries {
+		nextCursor = encodeCursor(next)
+	}
+	return jobStatus, nextCursor, nil
+}
+
+// cursors are opaque to callers, these wrap the offset of the next page
+const cursorPrefix = "offset:"
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return 0, errors.Errorf("invalid cursor %s", cursor)
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(decoded), cursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, errors.Errorf("invalid cursor %s", cursor)
+	}
+	return offset, nil
+}
+
+// GetActiveRunCount counts runs of the job which are queued or running,
+// e.g. for controllers applying backpressure before triggering more runs
+func (a *scheduler) GetActiveRunCount(ctx context.Context, projSpec models.ProjectSpec, jobName string) (int, error) {
+	var count int
+	for offset := 0; ; offset += dagRunBatchSize {
+		body, err := a.callAPI(ctx, projSpec, http.MethodGet, activeDagRunsURL, nil, jobName, dagRunBatchSize, offset)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to fetch active airflow dag runs of %s", jobName)
+		}
+		var responseJson struct {
+			DagRuns []struct {
+				State string `json:"state"`
+			} `json:"dag_runs"`
+			TotalEntries int `json:"total_entries"`
+		}
+		if err := json.Unmarshal(body, &responseJson); err != nil {
+			return 0, errors.Wrapf(err, "json error: %s", string(body))
+		}
+		// states are checked as well in case the filter isn't honoured
+		for _, dagRun := range responseJson.DagRuns {
+			if dagRun.State == "queued" || dagRun.State == "running" {
+				count++
+			}
+		}
+		if len(responseJson.DagRuns) == 0 || offset+len(responseJson.DagRuns) >= responseJson.TotalEntries {
+			return count, nil
+		}
+	}
+}
+
+// GetJobStatusBulk fetches status of many jobs running up to concurrency
+// fetches at a time. Statuses of jobs fetched successfully are returned
+// along with errors of the jobs which failed, in order of the job names
+func (a *scheduler) GetJobStatusBulk(ctx context.Context, projSpec models.ProjectSpec, jobNames []string,
+	concurrency int) (map[string][]models.JobStatus, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobErrors := make([]error, len(jobNames))
+	jobStatus := map[string][]models.JobStatus{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, jobName := range jobNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, jobName string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			status, err := a.GetJobStatus(ctx, projSpec, jobName)
+			if err != nil {
+				jobErrors[i] = err
+				return
+			}
+			mu.Lock()
+			jobStatus[jobName] = status
+			mu.Unlock()
+		}(i, jobName)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, err := range jobErrors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return jobStatus, errs
+}
+
+// clearRequest is the payload of airflow api clearing task instances
+type clearRequest struct {
+	StartDate    string   `json:"start_date"`
+	EndDate      string   `json:"end_date"`
+	DryRun       bool     `json:"dry_run"`
+	ResetDagRuns bool     `json:"reset_dag_runs"`
+	OnlyFailed   bool     `json:"only_failed"`
+	OnlyRunning  bool     `json:"only_running,omitempty"`
+	TaskIDs      []string `json:"task_ids,omitempty"`
+
+	IncludeUpstream   bool `json:"include_upstream,omitempty"`
+	IncludeDownstream bool `json:"include_downstream,omitempty"`
+	IncludeFuture     bool `json:"include_future,omitempty"`
+	IncludePast       bool `json:"include_past,omitempty"`
+}
+
+// ClearOption widens what a clear resets beyond the matched task instances
+type ClearOption func(*clearRequest)
+
+// IncludeUpstream clears upstream tasks of the cleared tasks as well
+func IncludeUpstream() ClearOption {
+	return func(r *clearRequest) {
+		r.IncludeUpstream = true
+	}
+}
+
+// IncludeDownstream clears downstream tasks of the cleared tasks as well,
+// e.g. to rerun everything depending on a fixed task
+func IncludeDownstream() ClearOption {
+	return func(r *clearRequest) {
+		r.IncludeDownstream = true
+	}
+}
+
+// IncludeFuture clears runs of the cleared tasks after the end date as well
+func IncludeFuture() ClearOption {
+	return func(r *clearRequest) {
+		r.IncludeFuture = true
+	}
+}
+
+// IncludePast clears runs of the cleared tasks before the start date as well
+func IncludePast() ClearOption {
+	return func(r *clearRequest) {
+		r.IncludePast = true
+	}
+}
+
+func newClearRequest(startDate, endDate time.Time, opts ...ClearOption) clearRequest {
+	clearReq := clearRequest{
+		StartDate:    startDate.UTC().Format(airflowDateFormat),
+		EndDate:      endDate.UTC().Format(airflowDateFormat),
+		DryRun:       false,
+		ResetDagRuns: true,
+		OnlyFailed:   false,
+	}
+	for _, opt := range opts {
+		opt(&clearReq)
+	}
+	return clearReq
+}
+
 func (a *scheduler) Clear(ctx context.Context, projSpec models.ProjectSpec, jobName string, startDate, endDate time.Time) error {
-	schdHost, ok := projSpec.Config[models.ProjectSchedulerHost]
-	if !ok {
-		return errors.Errorf("scheduler host not set for %s", projSpec.Name)
+	_, err := a.clearTaskInstances(ctx, projSpec, jobName, newClearRequest(startDate, endDate))
+	return err
+}
+
+// ClearDatesError reports the dates ClearDates failed to clear, dates not
+// listed were cleared
+type ClearDatesError struct {
+	Dates []time.Time
+	Errs  []error
+}
+
+func (e *ClearDatesError) Error() string {
+	dates := make([]string, 0, len(e.Dates))
+	for _, date := range e.Dates {
+		dates = append(dates, date.UTC().Format(airflowDateFormat))
 	}
-	authToken, ok := projSpec.Secret.GetByName(models.ProjectSchedulerAuth)
-	if !ok {
-		return errors.Errorf("%s secret not configured for project %s", models.ProjectSchedulerAuth, projSpec.Name)
+	return fmt.Sprintf("failed to clear %d of the dates: %s: %v", len(e.Dates), strings.Join(dates, ", "), e.Errs[0])
+}
+
+// ClearDates clears runs of the job at each of the logical dates, e.g. for
+// backfilling dates which aren't contiguous. All dates are attempted, those
+// failing to clear are reported with a ClearDatesError
+func (a *scheduler) ClearDates(ctx context.Context, projSpec models.ProjectSpec, jobName string, dates []time.Time) error {
+	var failed ClearDatesError
+	for _, date := range dates {
+		if _, err := a.clearTaskInstances(ctx, projSpec, jobName, newClearRequest(date, date)); err != nil {
+			failed.Dates = append(failed.Dates, date)
+			failed.Errs = append(failed.Errs, err)
+		}
 	}
+	if len(failed.Dates) > 0 {
+		return &failed
+	}
+	return nil
+}
+
+// ClearedTaskInstance is a task instance reset by a clear
+type ClearedTaskInstance struct {
+	DagID         string `json:"dag_id"`
+	DagRunID      string `json:"dag_run_id"`
+	TaskID        string `json:"task_id"`
+	ExecutionDate string `json:"execution_date"`
+}
+
+// ClearResult lists the task instances affected by a clear
+type ClearResult struct {
+	TaskInstances []ClearedTaskInstance `json:"task_instances"`
+}
 
-	schdHost = strings.Trim(schdHost, "/")
-	var jsonStr = []byte(fmt.Sprintf(`{"start_date":"%s", "end_date": "%s", "dry_run": false, "reset_dag_runs": true, "only_failed": false}`,
-		startDate.UTC().Format(airflowDateFormat),
-		endDate.UTC().Format(airflowDateFormat)))
-	postURL := fmt.Sprintf(
-		fmt.Sprintf("%s/%s", schdHost, dagRunClearURL),
-		jobName)
+// Count returns the number of task instances affected by the clear
+func (r ClearResult) Count() int {
+	return len(r.TaskInstances)
+}
 
-	request, err := http.NewRequest(http.MethodPost, postURL, bytes.NewBuffer(jsonStr))
+// ClearWithResult works like Clear and returns the task instances airflow
+// reports as cleared
+func (a *scheduler) ClearWithResult(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	startDate, endDate time.Time, opts ...ClearOption) (ClearResult, error) {
+	body, err := a.clearTaskInstances(ctx, projSpec, jobName, newClearRequest(startDate, endDate, opts...))
 	if err != nil {
-		return errors.Wrapf(err, "failed to build http request for %s", postURL)
+		return ClearResult{}, err
 	}
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authToken))))
+	var result ClearResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return ClearResult{}, errors.Wrapf(err, "json error: %s", string(body))
+	}
+	return result, nil
+}
 
-	resp, err := a.httpClient.Do(request)
+// ClearWithNote works like ClearWithResult and attaches the note to each
+// cleared dag run for audit trails. Notes are skipped on airflow versions
+// not supporting them
+func (a *scheduler) ClearWithNote(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	startDate, endDate time.Time, note string, opts ...ClearOption) (ClearResult, error) {
+	result, err := a.ClearWithResult(ctx, projSpec, jobName, startDate, endDate, opts...)
+	if err != nil || note == "" || len(result.TaskInstances) == 0 {
+		return result, err
+	}
+	if supported, err := a.supportsRunNotes(ctx, projSpec); err != nil || !supported {
+		return result, err
+	}
+
+	noted := map[string]bool{}
+	for _, taskInstance := range result.TaskInstances {
+		if noted[taskInstance.DagRunID] {
+			continue
+		}
+		if err := a.setRunNote(ctx, projSpec, jobName, taskInstance.DagRunID, note); err != nil {
+			return result, err
+		}
+		noted[taskInstance.DagRunID] = true
+	}
+	return result, nil
+}
+
+// SetRunNote attaches the note to a dag run, it is a no-op on airflow
+// versions not supporting notes
+func (a *scheduler) SetRunNote(ctx context.Context, projSpec models.ProjectSpec, jobName, runID, note string) error {
+	if supported, err := a.supportsRunNotes(ctx, projSpec); err != nil || !supported {
+		return err
+	}
+	return a.setRunNote(ctx, projSpec, jobName, runID, note)
+}
+
+// TriggerRun starts a dag run of the job for the execution time with the
+// run conf, attaching the note to it when provided. Notes are skipped on
+// airflow versions not supporting them. It returns id of the dag run
+func (a *scheduler) TriggerRun(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	executionTime time.Time, conf map[string]string, note string) (string, error) {
+	if conf == nil {
+		conf = map[string]string{}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"execution_date": executionTime.UTC().Format(airflowDateFormat),
+		"conf":           conf,
+	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to clear airflow dag runs from %s", postURL)
+		return "", err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("failed to clear airflow dag runs from %s: %d", postURL, resp.StatusCode)
+	body, err := a.callAPI(ctx, projSpec, http.MethodPost, dagRunsURL, payload, jobName)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to trigger airflow dag run of %s", jobName)
+	}
+	var dagRun struct {
+		DagRunID string `json:"dag_run_id"`
+	}
+	if err := json.Unmarshal(body, &dagRun); err != nil {
+		return "", errors.Wrapf(err, "json error: %s", string(body))
+	}
+	if note == "" {
+		return dagRun.DagRunID, nil
+	}
+	return dagRun.DagRunID, a.SetRunNote(ctx, projSpec, jobName, dagRun.DagRunID, note)
+}
+
+func (a *scheduler) supportsRunNotes(ctx context.Context, projSpec models.ProjectSpec) (bool, error) {
+	version, err := a.GetVersion(ctx, projSpec)
+	if err != nil {
+		return false, err
+	}
+	cmp, err := compareVersions(version, runNoteMinVersion)
+	if err != nil {
+		return false, err
 	}
-	defer resp.Body.Close()
+	return cmp >= 0, nil
+}
 
+func (a *scheduler) setRunNote(ctx context.Context, projSpec models.ProjectSpec, jobName, runID, note string) error {
+	payload, err := json.Marshal(map[string]string{
+		"note": note,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := a.callAPI(ctx, projSpec, http.MethodPatch, dagRunNoteURL, payload, jobName, url.PathEscape(runID)); err != nil {
+		return errors.Wrapf(err, "failed to set note of dag run %s of %s", runID, jobName)
+	}
 	return nil
 }
 
-func (a *scheduler) GetDagRunStatus(ctx context.Context, projSpec models.ProjectSpec, jobName string, startDate time.Time,
-	endDate time.Time, batchSize int) ([]models.JobStatus, error) {
-	schdHost, ok := projSpec.Config[models.ProjectSchedulerHost]
-	if !ok {
-		return nil, errors.Errorf("scheduler host not set for %s", projSpec.Name)
+// ClearTasks clears only the provided tasks of the job for runs between
+// start and end date
+func (a *scheduler) ClearTasks(ctx context.Context, projSpec models.ProjectSpec, jobName string, taskIDs []string,
+	startDate, endDate time.Time, opts ...ClearOption) error {
+	if len(taskIDs) == 0 {
+		return errors.Errorf("no tasks provided to clear for %s", jobName)
 	}
-	authToken, ok := projSpec.Secret.GetByName(models.ProjectSchedulerAuth)
-	if !ok {
-		return []models.JobStatus{}, errors.Errorf("%s secret not configured for project %s", models.ProjectSchedulerAuth, projSpec.Name)
+	clearReq := newClearRequest(startDate, endDate, opts...)
+	clearReq.TaskIDs = taskIDs
+	_, err := a.clearTaskInstances(ctx, projSpec, jobName, clearReq)
+	return err
+}
+
+// clearTaskInstances returns body of the airflow response listing the
+// cleared task instances
+func (a *scheduler) clearTaskInstances(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	clearReq clearRequest) ([]byte, error) {
+	payload, err := json.Marshal(clearReq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build clear request of %s", jobName)
+	}
+	if a.clearLimiter != nil {
+		if err := a.clearLimiter.Wait(ctx, projSpec.Name); err != nil {
+			return nil, errors.Wrapf(err, "failed waiting to clear airflow dag runs of %s", jobName)
+		}
+	}
+	body, err := a.callAPI(ctx, projSpec, http.MethodPost, dagRunClearURL, payload, jobName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to clear airflow dag runs of %s", jobName)
 	}
-	schdHost = strings.Trim(schdHost, "/")
-	postURL := fmt.Sprintf("%s/%s", schdHost, dagStatusBatchUrl)
+	return body, nil
+}
 
+func (a *scheduler) GetDagRunStatus(ctx context.Context, projSpec models.ProjectSpec, jobName string, startDate time.Time,
+	endDate time.Time, batchSize int) ([]models.JobStatus, error) {
 	pageOffset := 0
 	var jobStatus []models.JobStatus
 	var responseJson struct {
@@ -235,27 +876,10 @@ func (a *scheduler) GetDagRunStatus(ctx context.Context, projSpec models.Project
 		"execution_date_gte": "%s",
 		"execution_date_lte": "%s"
 		}`, pageOffset, batchSize, jobName, startDate.UTC().Format(airflowDateFormat), endDate.UTC().Format(airflowDateFormat))
-		var jsonStr = []byte(dagRunBatchReq)
-		request, err := http.NewRequest(http.MethodPost, postURL, bytes.NewBuffer(jsonStr))
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to build http request for %s", dagStatusBatchUrl)
-		}
-		request.Header.Set("Content-Type", "application/json")
-		request.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authToken))))
-
-		resp, err := a.httpClient.Do(request)
+		body, err := a.callAPI(ctx, projSpec, http.MethodPost, dagStatusBatchUrl, []byte(dagRunBatchReq))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to fetch airflow dag runs from %s", dagStatusBatchUrl)
 		}
-		if resp.StatusCode != http.StatusOK {
-			return nil, errors.Errorf("failed to fetch airflow dag runs from %s", dagStatusBatchUrl)
-		}
-		defer resp.Body.Close()
-
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read airflow response")
-		}
 
 		if err := json.Unmarshal(body, &responseJson); err != nil {
 			return nil, errors.Wrapf(err, "json error: %s", string(body))
@@ -276,6 +900,807 @@ func (a *scheduler) GetDagRunStatus(ctx context.Context, projSpec models.Project
 	return jobStatus, nil
 }
 
+// GetJobStatusByRunType works like GetJobStatus returning only the runs
+// of provided run types, e.g. to leave out backfills
+func (a *scheduler) GetJobStatusByRunType(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	runTypes ...models.JobRunType) ([]models.JobStatus, error) {
+	jobStatus, err := a.GetJobStatus(ctx, projSpec, jobName)
+	if err != nil {
+		return nil, err
+	}
+	return filterByRunType(jobStatus, runTypes), nil
+}
+
+// GetDagRunStatusByRunType works like GetDagRunStatus returning only the
+// runs of provided run types
+func (a *scheduler) GetDagRunStatusByRunType(ctx context.Context, projSpec models.ProjectSpec, jobName string,
+	startDate, endDate time.Time, batchSize int, runTypes ...models.JobRunType) ([]models.JobStatus, error) {
+	jobStatus, err := a.GetDagRunStatus(ctx, projSpec, jobName, startDate, endDate, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	return filterByRunType(jobStatus, runTypes), nil
+}
+
+// filterByRunType keeps runs of the provided types, all runs are kept if
+// no type is provided
+func filterByRunType(jobStatus []models.JobStatus, runTypes []models.JobRunType) []models.JobStatus {
+	if len(runTypes) == 0 {
+		return jobStatus
+	}
+	var filtered []models.JobStatus
+	for _, status := range jobStatus {
+		for _, runType := range runTypes {
+			if status.RunType == runType {
+				filtered = append(filtered, status)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// GetSLAMisses returns runs scheduled between start and end which took longer
+// than the sla to finish, or are still unfinished past it. Runs yet to start
+// are measured from their schedule time
+func (a *scheduler) GetSLAMisses(ctx context.Context, projSpec models.ProjectSpec, jobName string, start,
+	end time.Time, sla time.Duration) ([]models.JobStatus, error) {
+	runs, err := a.GetDagRunStatus(ctx, projSpec, jobName, start, end, dagRunBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var misses []models.JobStatus
+	for _, run := range runs {
+		startedAt := run.ScheduledAt
+		if run.StartedAt != nil {
+			startedAt = *run.StartedAt
+		}
+		finishedAt := now
+		if run.EndedAt != nil {
+			finishedAt = *run.EndedAt
+		}
+		if finishedAt.Sub(startedAt) > sla {
+			misses = append(misses, run)
+		}
+	}
+	return misses, nil
+}
+
+// GetLastSuccessRun returns schedule time of the most recent successful run
+// of the job, false if the job never succeeded
+func (a *scheduler) GetLastSuccessRun(ctx context.Context, projSpec models.ProjectSpec, jobName string) (time.Time,
+	bool, error) {
+	jobStatus, err := a.GetJobStatus(ctx, projSpec, jobName)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var lastSuccess time.Time
+	found := false
+	for _, status := range jobStatus {
+		if status.State != models.JobStatusStateSuccess {
+			continue
+		}
+		if !found || status.ScheduledAt.After(lastSuccess) {
+			lastSuccess = status.ScheduledAt
+			found = true
+		}
+	}
+	return lastSuccess, found, nil
+}
+
+// MarkRunState updates state of a dag run without rerunning it, e.g. to
+// force succeed a stuck run
+func (a *scheduler) MarkRunState(ctx context.Context, projSpec models.ProjectSpec, jobName, runID string,
+	state models.JobStatusState) error {
+	switch state {
+	case models.JobStatusStateSuccess, models.JobStatusStateFailed:
+	default:
+		return errors.Errorf("dag run state can only be set to %s or %s, requested: %s",
+			models.JobStatusStateSuccess, models.JobStatusStateFailed, state)
+	}
+	if err := a.requireVersion(ctx, projSpec, "marking dag run state", markRunStateMinVersion); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"state": state.String(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.callAPI(ctx, projSpec, http.MethodPatch, dagRunURL, payload, jobName, url.PathEscape(runID))
+	return err
+}
+
+// CancelRun stops a dag run in progress by marking it failed and clearing
+// its running task instances, along with their downstream, so airflow kills
+// them. It fails with ErrRunAlreadyFinished if the run is not in progress
+// anymore
+func (a *scheduler) CancelRun(ctx context.Context, projSpec models.ProjectSpec, jobName, runID string) error {
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagRunURL, nil, jobName, url.PathEscape(runID))
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch dag run %s of %s", runID, jobName)
+	}
+	var dagRun struct {
+		State         models.JobStatusState `json:"state"`
+		ExecutionDate string                `json:"execution_date"`
+	}
+	if err := json.Unmarshal(body, &dagRun); err != nil {
+		return errors.Wrapf(err, "json error: %s", string(body))
+	}
+	switch dagRun.State {
+	case models.JobStatusStateSuccess, models.JobStatusStateFailed:
+		return errors.Wrapf(ErrRunAlreadyFinished, "dag run %s of %s is %s", runID, jobName, dagRun.State)
+	}
+	executedAt, err := parseAirflowTime(dagRun.ExecutionDate)
+	if err != nil {
+		return errors.Errorf("error parsing date for %s, %s", jobName, dagRun.ExecutionDate)
+	}
+	if err := a.MarkRunState(ctx, projSpec, jobName, runID, models.JobStatusStateFailed); err != nil {
+		return err
+	}
+
+	// the run is already failed, resetting it would schedule it again
+	clearReq := newClearRequest(executedAt, executedAt, IncludeDownstream())
+	clearReq.OnlyRunning = true
+	clearReq.ResetDagRuns = false
+	_, err = a.clearTaskInstances(ctx, projSpec, jobName, clearReq)
+	return err
+}
+
+// GetRunEvents returns the timeline of a run of the job, built from
+// timestamps of its task instances as they got queued, started and ended.
+// Events are ordered by time, ties ordered by task
+func (a *scheduler) GetRunEvents(ctx context.Context, projSpec models.ProjectSpec, jobName,
+	runID string) ([]models.RunEvent, error) {
+	var events []models.RunEvent
+	for offset := 0; ; offset += dagRunBatchSize {
+		body, err := a.callAPI(ctx, projSpec, http.MethodGet, taskInstancesURL, nil, jobName, url.PathEscape(runID),
+			dagRunBatchSize, offset)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch task instances of run %s of %s", runID, jobName)
+		}
+		var responseJson struct {
+			TaskInstances []map[string]interface{} `json:"task_instances"`
+			TotalEntries  int                      `json:"total_entries"`
+		}
+		if err := json.Unmarshal(body, &responseJson); err != nil {
+			return nil, errors.Wrapf(err, "json error: %s", string(body))
+		}
+		for _, taskInstance := range responseJson.TaskInstances {
+			taskEvents, err := toRunEvents(taskInstance)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read task instances of run %s of %s", runID, jobName)
+			}
+			events = append(events, taskEvents...)
+		}
+		if len(responseJson.TaskInstances) == 0 || offset+len(responseJson.TaskInstances) >= responseJson.TotalEntries {
+			break
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].At.Equal(events[j].At) {
+			return events[i].At.Before(events[j].At)
+		}
+		return events[i].Task < events[j].Task
+	})
+	return events, nil
+}
+
+// toRunEvents converts the timestamps of a task instance to events, the
+// end of the task carries its latest state
+func toRunEvents(taskInstance map[string]interface{}) ([]models.RunEvent, error) {
+	task, _ := taskInstance["task_id"].(string)
+	state, _ := taskInstance["state"].(string)
+	stages := []struct {
+		field, state string
+	}{
+		{"queued_when", "queued"},
+		{"start_date", "running"},
+		{"end_date", state},
+	}
+
+	var events []models.RunEvent
+	for _, stage := range stages {
+		at, err := parseOptionalAirflowTime(taskInstance, stage.field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s of task %s", stage.field, task)
+		}
+		if at == nil {
+			continue
+		}
+		events = append(events, models.RunEvent{
+			Task:  task,
+			State: stage.state,
+			At:    *at,
+		})
+	}
+	return events, nil
+}
+
+// GetTaskLog streams the log of a try of a task in a run of the job, the
+// returned reader is wired to the response of airflow so logs of any size
+// can be read without holding them in memory. The caller must close it.
+// Unlike GetDagSource it skips the dagFile lookup, as the log endpoint
+// addresses the task by dag id and run instead of the file token of the dag
+func (a *scheduler) GetTaskLog(ctx context.Context, projSpec models.ProjectSpec, jobName, runID, taskID string,
+	tryNumber int) (io.ReadCloser, error) {
+	request, err := a.newRequest(ctx, projSpec, http.MethodGet,
+		fmt.Sprintf(taskLogURL, jobName, url.PathEscape(runID), taskID, tryNumber), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/plain")
+
+	began := time.Now()
+	body, err := a.stream(request)
+	a.recordCall(http.MethodGet, taskLogURL, began, err)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch log of task %s in run %s of %s", taskID, runID, jobName)
+	}
+	return body, nil
+}
+
+// GetVersion returns version of airflow serving the project
+func (a *scheduler) GetVersion(ctx context.Context, projSpec models.ProjectSpec) (string, error) {
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, versionURL, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to fetch airflow version of project %s", projSpec.Name)
+	}
+	var versionResp struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &versionResp); err != nil {
+		return "", errors.Wrapf(err, "json error: %s", string(body))
+	}
+	if versionResp.Version == "" {
+		return "", errors.Errorf("airflow version not found in response: %s", string(body))
+	}
+	return versionResp.Version, nil
+}
+
+// GetSchedulerConfig returns settings of airflow serving the project by
+// section and key, e.g. to check the auth backend of its api
+func (a *scheduler) GetSchedulerConfig(ctx context.Context, projSpec models.ProjectSpec) (map[string]map[string]string, error) {
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, configURL, nil)
+	if err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusForbidden {
+			return nil, errors.Wrapf(ErrConfigNotExposed, "failed to fetch airflow config of project %s", projSpec.Name)
+		}
+		return nil, errors.Wrapf(err, "failed to fetch airflow config of project %s", projSpec.Name)
+	}
+	var configResp struct {
+		Sections []struct {
+			Name    string `json:"name"`
+			Options []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"options"`
+		} `json:"sections"`
+	}
+	if err := json.Unmarshal(body, &configResp); err != nil {
+		return nil, errors.Wrapf(err, "json error: %s", string(body))
+	}
+
+	config := map[string]map[string]string{}
+	for _, section := range configResp.Sections {
+		if config[section.Name] == nil {
+			config[section.Name] = map[string]string{}
+		}
+		for _, option := range section.Options {
+			config[section.Name][option.Key] = option.Value
+		}
+	}
+	return config, nil
+}
+
+// requireVersion fails if airflow serving the project is older than the
+// minimum version needed by the operation
+func (a *scheduler) requireVersion(ctx context.Context, projSpec models.ProjectSpec, operation, minVersion string) error {
+	version, err := a.GetVersion(ctx, projSpec)
+	if err != nil {
+		return err
+	}
+	cmp, err := compareVersions(version, minVersion)
+	if err != nil {
+		return err
+	}
+	if cmp < 0 {
+		return errors.Errorf("%s requires Airflow >= %s, project %s runs %s", operation, minVersion, projSpec.Name, version)
+	}
+	return nil
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// compareVersions compares major, minor and patch of versions ignoring
+// any suffix like rc1 or +composer, returning -1, 0 or 1
+func compareVersions(first, second string) (int, error) {
+	firstParts, err := parseVersion(first)
+	if err != nil {
+		return 0, err
+	}
+	secondParts, err := parseVersion(second)
+	if err != nil {
+		return 0, err
+	}
+	for i := range firstParts {
+		if firstParts[i] < secondParts[i] {
+			return -1, nil
+		}
+		if firstParts[i] > secondParts[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([3]int, error) {
+	var parts [3]int
+	match := versionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return parts, errors.Errorf("invalid airflow version %s", version)
+	}
+	for i, part := range match[1:] {
+		if part == "" {
+			continue
+		}
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return parts, errors.Wrapf(err, "invalid airflow version %s", version)
+		}
+		parts[i] = num
+	}
+	return parts, nil
+}
+
+// GetDagSource returns the source of the dag currently deployed for the job
+// as parsed by airflow
+func (a *scheduler) GetDagSource(ctx context.Context, projSpec models.ProjectSpec, jobName string) ([]byte, error) {
+	file, err := a.dagFile(ctx, projSpec, jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagSourceURL, nil, file.FileToken)
+	if err != nil {
+		return nil, err
+	}
+	var sourceJson struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(body, &sourceJson); err != nil {
+		return nil, errors.Wrapf(err, "json error: %s", string(body))
+	}
+	return []byte(sourceJson.Content), nil
+}
+
+// callChainKey keys the callChain in contexts
+type callChainKey struct{}
+
+// callChain holds lookups shared by calls made under the same context, see
+// WithCallChain
+type callChain struct {
+	mu       sync.Mutex
+	dagFiles map[string]dagFile
+}
+
+// WithCallChain returns a context under which calls to the scheduler share
+// lookups which hold for the chain of calls, e.g. file tokens of dags, so
+// calls like GetDagSource followed by SetCatchup fetch the dag once
+func WithCallChain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callChainKey{}, &callChain{
+		dagFiles: map[string]dagFile{},
+	})
+}
+
+// dagFile locates the file a dag is parsed from
+type dagFile struct {
+	FileLoc   string `json:"fileloc"`
+	FileToken string `json:"file_token"`
+}
+
+// dagFile returns the file of the dag of the job, cached for the call chain
+// of the context if any
+func (a *scheduler) dagFile(ctx context.Context, projSpec models.ProjectSpec, jobName string) (dagFile, error) {
+	chain, _ := ctx.Value(callChainKey{}).(*callChain)
+	cacheKey := projSpec.Name + "/" + jobName
+	if chain != nil {
+		chain.mu.Lock()
+		file, ok := chain.dagFiles[cacheKey]
+		chain.mu.Unlock()
+		if ok {
+			return file, nil
+		}
+	}
+
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagURL, nil, jobName)
+	if err != nil {
+		return dagFile{}, err
+	}
+	var file dagFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return dagFile{}, errors.Wrapf(err, "json error: %s", string(body))
+	}
+	if chain != nil {
+		chain.mu.Lock()
+		chain.dagFiles[cacheKey] = file
+		chain.mu.Unlock()
+	}
+	return file, nil
+}
+
+// RefreshDag asks airflow to reparse and reserialize the dag of the job,
+// e.g. after editing variables or connections the dag reads at parse time
+func (a *scheduler) RefreshDag(ctx context.Context, projSpec models.ProjectSpec, jobName string) error {
+	if err := a.requireVersion(ctx, projSpec, "refreshing dag", refreshDagMinVersion); err != nil {
+		return err
+	}
+	file, err := a.dagFile(ctx, projSpec, jobName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch airflow dag %s", jobName)
+	}
+	if _, err := a.callAPI(ctx, projSpec, http.MethodPut, dagParseURL, nil, url.PathEscape(file.FileToken)); err != nil {
+		return errors.Wrapf(err, "failed to refresh airflow dag %s", jobName)
+	}
+	return nil
+}
+
+// IsPaused tells if the dag of the job is currently paused, deployments
+// can read it before uploading the dag and re-apply it with SetPaused after,
+// as airflow may reset it for a changed dag. ErrNotFound is returned for
+// jobs not deployed yet
+func (a *scheduler) IsPaused(ctx context.Context, projSpec models.ProjectSpec, jobName string) (bool, error) {
+	body, err := a.callAPI(ctx, projSpec, http.MethodGet, dagURL, nil, jobName)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to fetch airflow dag %s", jobName)
+	}
+	var dagJson struct {
+		IsPaused *bool `json:"is_paused"`
+	}
+	if err := json.Unmarshal(body, &dagJson); err != nil {
+		return false, errors.Wrapf(err, "json error: %s", string(body))
+	}
+	if dagJson.IsPaused == nil {
+		return false, errors.Errorf("paused state missing from airflow dag %s", jobName)
+	}
+	return *dagJson.IsPaused, nil
+}
+
+// SetPaused pauses or unpauses the dag of the job
+func (a *scheduler) SetPaused(ctx context.Context, projSpec models.ProjectSpec, jobName string, paused bool) error {
+	payload, err := json.Marshal(map[string]bool{
+		"is_paused": paused,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := a.callAPI(ctx, projSpec, http.MethodPatch, dagPauseURL, payload, jobName); err != nil {
+		return errors.Wrapf(err, "failed to update paused state of airflow dag %s", jobName)
+	}
+	return nil
+}
+
+// SetPausedBulk pauses or unpauses dags of many jobs running up to
+// concurrency updates at a time, e.g. for maintenance windows. Errors of the
+// jobs which failed are returned in order of the job names
+func (a *scheduler) SetPausedBulk(ctx context.Context, projSpec models.ProjectSpec, jobNames []string,
+	paused bool, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobErrors := make([]error, len(jobNames))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, jobName := range jobNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, jobName string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			jobErrors[i] = a.SetPaused(ctx, projSpec, jobName, paused)
+		}(i, jobName)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, err := range jobErrors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// dagCatchupPattern matches the catchup flag of dags compiled from the
+// base dag template
+var dagCatchupPattern = regexp.MustCompile(`(?m)^(\s*catchup\s*=\s*)(True|False)[ \t]*$`)
+
+// SetCatchup enables or disables catchup of an already deployed job without
+// redeploying it. Airflow doesn't allow changing catchup over its api as it
+// is a property of the dag file, so the deployed dag is fetched, its catchup
+// flag flipped and the file written back to the storage of the project.
+// The change is only effective once airflow reparses the file and is
+// overwritten by the next deployment of the job, which uses the catchup
+// behavior of the job spec
+func (a *scheduler) SetCatchup(ctx context.Context, projSpec models.ProjectSpec, jobName string, enabled bool) error {
+	// the dag is fetched once for both its location and source
+	chainCtx := ctx
+	if chain, _ := ctx.Value(callChainKey{}).(*callChain); chain == nil {
+		chainCtx = WithCallChain(ctx)
+	}
+	dagJson, err := a.dagFile(chainCtx, projSpec, jobName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch airflow dag %s", jobName)
+	}
+	source, err := a.GetDagSource(chainCtx, projSpec, jobName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch source of airflow dag %s", jobName)
+	}
+
+	if !dagCatchupPattern.Match(source) {
+		return errors.Errorf("catchup flag not found in dag %s", jobName)
+	}
+	flag := "False"
+	if enabled {
+		flag = "True"
+	}
+	updated := dagCatchupPattern.ReplaceAllString(string(source), "${1}"+flag)
+	if updated == string(source) {
+		return nil
+	}
+
+	// dags are deployed under the jobs dir of the project, airflow reports
+	// the location of the file as mounted on its workers
+	jobsDir := "/" + a.GetJobsDir() + "/"
+	idx := strings.LastIndex(dagJson.FileLoc, jobsDir)
+	if idx == -1 {
+		return errors.Errorf("dag %s is not located under %s", jobName, a.GetJobsDir())
+	}
+	dagFilePath := dagJson.FileLoc[idx+len(jobsDir):]
+
+	storage, err := resolveStorage(projSpec)
+	if err != nil {
+		return err
+	}
+	objectWriter, err := a.objWriterFac.New(ctx, storage.path, storage.secret)
+	if err != nil {
+		return errors.Errorf("object writer failed for %s", projSpec.Name)
+	}
+	dst, err := objectWriter.NewWriter(ctx, storage.bucket, a.jobsObjectPath(storage, dagFilePath))
+	if err != nil {
+		return errors.Wrapf(err, "failed to write airflow dag %s", jobName)
+	}
+	if _, err := io.WriteString(dst, updated); err != nil {
+		dst.Close()
+		return errors.Wrapf(err, "failed to write airflow dag %s", jobName)
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write airflow dag %s", jobName)
+	}
+	return nil
+}
+
+// Diff checks if the dag deployed for the job differs from the desired
+// compiled dag, compared as per job.CanonicalDag ignoring comments and blank
+// lines as these don't change the dag behaviour, e.g. the generated header
+// carrying optimus version
+func (a *scheduler) Diff(ctx context.Context, projSpec models.ProjectSpec, jobName string, desired []byte) (bool, error) {
+	deployed, err := a.GetDagSource(ctx, projSpec, jobName)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(job.CanonicalDag(deployed), job.CanonicalDag(desired)), nil
+}
+
+// schedulerAuth returns the scheduler host and auth token configured for the project
+func (a *scheduler) schedulerAuth(projSpec models.ProjectSpec) (string, string, error) {
+	schdHost, ok := projSpec.Config[models.ProjectSchedulerHost]
+	if !ok {
+		return "", "", errors.Errorf("scheduler host not set for %s", projSpec.Name)
+	}
+	authToken, ok := projSpec.Secret.GetByName(models.ProjectSchedulerAuth)
+	if !ok {
+		return "", "", errors.Errorf("%s secret not configured for project %s", models.ProjectSchedulerAuth, projSpec.Name)
+	}
+	schdHost, err := resolveSchedulerHost(projSpec, schdHost)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.Trim(schdHost, "/"), authToken, nil
+}
+
+// resolveSchedulerHost renders scheduler host of the project which can be
+// templated with project configs and secrets to pick the host per
+// environment, e.g. https://{{.GLOBAL__ENV}}.airflow.io or {{.SECRET__AIRFLOW_HOST}}
+func resolveSchedulerHost(projSpec models.ProjectSpec, schdHost string) (string, error) {
+	tmplContext := map[string]string{}
+	for key, val := range projSpec.Config {
+		tmplContext[instance.ProjectConfigPrefix+key] = val
+	}
+	for _, secret := range projSpec.Secret {
+		tmplContext[instance.SecretEnvPrefix+secret.Name] = secret.Value
+	}
+
+	tmpl, err := template.New("scheduler_host").Option("missingkey=error").Parse(schdHost)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse scheduler host %s of project %s", schdHost, projSpec.Name)
+	}
+	var resolved bytes.Buffer
+	if err := tmpl.Execute(&resolved, tmplContext); err != nil {
+		return "", errors.Wrapf(err, "failed to resolve scheduler host %s of project %s", schdHost, projSpec.Name)
+	}
+
+	// resolved host may carry secrets, only the template is reported
+	hostURL, err := url.Parse(strings.TrimSpace(resolved.String()))
+	if err != nil || (hostURL.Scheme != "http" && hostURL.Scheme != "https") || hostURL.Host == "" {
+		return "", errors.Errorf("scheduler host %s of project %s doesn't resolve to a valid http url", schdHost, projSpec.Name)
+	}
+	return hostURL.String(), nil
+}
+
+// newRequest prepares an authenticated request for the airflow api path,
+// relative to the api base path of the project
+func (a *scheduler) newRequest(ctx context.Context, projSpec models.ProjectSpec, method, apiPath string,
+	payload []byte) (*http.Request, error) {
+	schdHost, authToken, err := a.schedulerAuth(projSpec)
+	if err != nil {
+		return nil, err
+	}
+	basePath := defaultAPIBasePath
+	if configured := strings.Trim(projSpec.Config[models.ProjectSchedulerAPIBasePath], "/"); configured != "" {
+		basePath = configured
+	}
+	reqURL := fmt.Sprintf("%s/%s/%s", schdHost, basePath, apiPath)
+	overridden := a.overrideMethods && (method == http.MethodPatch || method == http.MethodDelete)
+	reqMethod := method
+	if overridden {
+		reqMethod = http.MethodPost
+	}
+	request, err := http.NewRequestWithContext(ctx, reqMethod, reqURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build http request for %s", reqURL)
+	}
+	if overridden {
+		request.Header.Set(methodOverrideHeader, method)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authToken))))
+	if a.userAgent != "" {
+		request.Header.Set("User-Agent", a.userAgent)
+	}
+	return request, nil
+}
+
+// do executes the request and returns body of the response if it succeeded
+func (a *scheduler) do(request *http.Request) ([]byte, error) {
+	respBody, err := a.stream(request)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(respBody, a.maxResponseSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read airflow response")
+	}
+	if int64(len(body)) > a.maxResponseSize {
+		return nil, errors.Errorf("response of airflow %s exceeds max size of %d bytes", request.URL, a.maxResponseSize)
+	}
+	return body, nil
+}
+
+// stream executes the request and returns the unread body of the response
+// if it succeeded, which the caller must close
+func (a *scheduler) stream(request *http.Request) (io.ReadCloser, error) {
+	resp, err := a.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(&transportError{err: err}, "failed to call airflow %s", request.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{
+			url:        request.URL.String(),
+			statusCode: resp.StatusCode,
+		}
+	}
+	return resp.Body, nil
+}
+
+// statusError is returned when airflow responds with a status other than OK
+type statusError struct {
+	url        string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to call airflow %s: %d", e.url, e.statusCode)
+}
+
+// Is classifies the error by the status code airflow responded with
+func (e *statusError) Is(target error) bool {
+	switch e.statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == ErrAuth
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return target == ErrTransient
+	}
+	return target == ErrFatal
+}
+
+// transportError is returned when airflow couldn't be reached, these are
+// transient unless the call was cancelled by the caller
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+func (e *transportError) Is(target error) bool {
+	return target == ErrTransient && !errors.Is(e.err, context.Canceled)
+}
+
+// callStatus labels the outcome of an api call with the http status code
+func callStatus(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.statusCode)
+	}
+	return "error"
+}
+
+// callAPI sends payload to the airflow api endpoint, formatted with path
+// args, and returns the response body
+func (a *scheduler) callAPI(ctx context.Context, projSpec models.ProjectSpec, method, endpoint string,
+	payload []byte, pathArgs ...interface{}) ([]byte, error) {
+	apiPath := endpoint
+	if len(pathArgs) > 0 {
+		apiPath = fmt.Sprintf(endpoint, pathArgs...)
+	}
+	request, err := a.newRequest(ctx, projSpec, method, apiPath, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	began := time.Now()
+	body, err := a.do(request)
+	a.recordCall(method, endpoint, began, err)
+	return body, err
+}
+
+// recordCall records duration and outcome of an api call
+func (a *scheduler) recordCall(method, endpoint string, began time.Time, err error) {
+	a.metrics.ObserveDuration(metricAPICallDuration, map[string]string{
+		"scheduler": a.GetName(),
+		"endpoint":  fmt.Sprintf("%s %s", method, endpoint),
+	}, time.Since(began))
+	a.metrics.IncCounter(metricAPICalls, map[string]string{
+		"scheduler": a.GetName(),
+		"endpoint":  fmt.Sprintf("%s %s", method, endpoint),
+		"status":    callStatus(err),
+	})
+}
+
 func toJobStatus(dagRuns []map[string]interface{}, jobName string) ([]models.JobStatus, error) {
 	var jobStatus []models.JobStatus
 	for _, status := range dagRuns {
@@ -284,14 +1709,72 @@ func toJobStatus(dagRuns []map[string]interface{}, jobName string) ([]models.Job
 		if !ok1 || !ok2 {
 			return nil, errors.Errorf("failed to find required response fields %s in %s", jobName, status)
 		}
-		scheduledAt, err := time.Parse(models.InstanceScheduledAtTimeLayout, status["execution_date"].(string))
+		scheduledAt, err := parseAirflowTime(status["execution_date"].(string))
 		if err != nil {
 			return nil, errors.Errorf("error parsing date for %s, %s", jobName, status["execution_date"].(string))
 		}
+		startedAt, err := parseOptionalAirflowTime(status, "start_date")
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing start date for %s", jobName)
+		}
+		endedAt, err := parseOptionalAirflowTime(status, "end_date")
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing end date for %s", jobName)
+		}
+		// data interval is reported since airflow 2.2
+		dataIntervalStart, err := parseOptionalAirflowTime(status, "data_interval_start")
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing data interval start for %s", jobName)
+		}
+		dataIntervalEnd, err := parseOptionalAirflowTime(status, "data_interval_end")
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing data interval end for %s", jobName)
+		}
+		runType, _ := status["run_type"].(string)
+		externalTrigger, _ := status["external_trigger"].(bool)
 		jobStatus = append(jobStatus, models.JobStatus{
-			ScheduledAt: scheduledAt,
-			State:       models.JobStatusState(status["state"].(string)),
+			ScheduledAt:       scheduledAt,
+			State:             models.JobStatusState(status["state"].(string)),
+			RunType:           models.JobRunType(runType),
+			ExternalTrigger:   externalTrigger,
+			StartedAt:         startedAt,
+			EndedAt:           endedAt,
+			DataIntervalStart: dataIntervalStart,
+			DataIntervalEnd:   dataIntervalEnd,
 		})
 	}
 	return jobStatus, nil
 }
+
+// ScheduledRunID returns the run_id airflow assigns to the scheduled run of
+// a dag at the time, e.g. scheduled__2020-03-25T02:00:00+00:00, usable with
+// methods operating on a single run like MarkRunState and CancelRun
+func ScheduledRunID(t time.Time) string {
+	return "scheduled__" + t.UTC().Format(airflowDateFormat)
+}
+
+// parseAirflowTime parses timestamps returned by airflow, these may carry
+// non UTC offsets like +05:30, so the parsed time is normalized to UTC
+func parseAirflowTime(value string) (time.Time, error) {
+	t, err := time.Parse(models.InstanceScheduledAtTimeLayout, value)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.UTC(), nil
+}
+
+// parseOptionalAirflowTime parses a timestamp field of the dag run or task
+// instance which is null or absent till it reaches that stage
+func parseOptionalAirflowTime(dagRun map[string]interface{}, field string) (*time.Time, error) {
+	value, ok := dagRun[field].(string)
+	if !ok || value == "" {
+		return nil, nil
+	}
+	t, err := parseAirflowTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
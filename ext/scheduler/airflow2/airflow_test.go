@@ -3,13 +3,20 @@ package airflow2_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/odpf/optimus/config"
 	"github.com/odpf/optimus/job"
 
 	"github.com/odpf/optimus/store"
@@ -42,6 +49,37 @@ func (m *MockedObjectWriterFactory) New(ctx context.Context, path, writerSecret
 	return args.Get(0).(store.ObjectWriter), args.Error(1)
 }
 
+func timeRef(value string) *time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	t = t.UTC()
+	return &t
+}
+
+// generatedLog produces a log of the remaining size on the fly
+type generatedLog struct {
+	remaining int64
+	closed    bool
+}
+
+func (l *generatedLog) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	for i := range p {
+		p[i] = 'a'
+	}
+	l.remaining -= int64(len(p))
+	return len(p), nil
+}
+
+func (l *generatedLog) Close() error {
+	l.closed = true
+	return nil
+}
+
 func TestAirflow2(t *testing.T) {
 	ctx := context.Background()
 	t.Run("Bootstrap", func(t *testing.T) {
@@ -78,6 +116,106 @@ func TestAirflow2(t *testing.T) {
 			})
 			assert.Nil(t, err)
 		})
+		t.Run("should upload lib under storage prefix of the project", func(t *testing.T) {
+			var out bytes.Buffer
+			wc := new(mocked.WriteCloser)
+			defer wc.AssertExpectations(t)
+			wc.On("Write").Return(&out, nil)
+			wc.On("Close").Return(nil)
+
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+
+			owf := new(MockedObjectWriterFactory)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+			defer owf.AssertExpectations(t)
+
+			ow.On("NewWriter", ctx, "mybucket", "hello/tenants/proj-name/dags/__lib.py").Return(wc, nil)
+
+			air := airflow2.NewScheduler(owf, nil)
+			err := air.Bootstrap(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey:   "gs://mybucket/hello",
+					models.ProjectStoragePrefixKey: "tenants/proj-name",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			})
+			assert.Nil(t, err)
+		})
+		t.Run("should fail for storage prefix traversing outside storage path", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil)
+			err := air.Bootstrap(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey:   "gs://mybucket/hello",
+					models.ProjectStoragePrefixKey: "../other-proj",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			})
+			assert.NotNil(t, err)
+		})
+		t.Run("should skip lib upload when requested", func(t *testing.T) {
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(owf, nil)
+			err := air.BootstrapProject(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "gs://mybucket/hello",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			}, true)
+			assert.Nil(t, err)
+			owf.AssertNotCalled(t, "New", mock.Anything, mock.Anything, mock.Anything)
+		})
+		t.Run("should validate storage secret even when lib upload is skipped", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil)
+			err := air.BootstrapProject(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "gs://mybucket/hello",
+				},
+			}, true)
+			assert.NotNil(t, err)
+		})
+		t.Run("should fail for malformed storage secret before writing", func(t *testing.T) {
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(owf, nil)
+			err := air.Bootstrap(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "gs://mybucket/hello",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: `{"type": "service_account", "private_key":`,
+					},
+				},
+			})
+			assert.EqualError(t, err, "invalid storage secret STORAGE of project proj-name: secret is not a valid json document")
+		})
 		t.Run("should fail if no storage config is set", func(t *testing.T) {
 			air := airflow2.NewScheduler(nil, nil)
 			err := air.Bootstrap(ctx, models.ProjectSpec{
@@ -96,6 +234,38 @@ func TestAirflow2(t *testing.T) {
 			})
 			assert.NotNil(t, err)
 		})
+		t.Run("should fail for storage path without a scheme", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil)
+			err := air.Bootstrap(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "/local/dags",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			})
+			assert.EqualError(t, err, "invalid STORAGE_PATH /local/dags of project proj-name, expected a path like gs://bucket/path")
+		})
+		t.Run("should fail for storage path without a bucket", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil)
+			err := air.BootstrapProject(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "gs:///dags",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			}, true)
+			assert.NotNil(t, err)
+		})
 	})
 	t.Run("GetJobStatus", func(t *testing.T) {
 		host := "http://airflow.example.io"
@@ -154,6 +324,158 @@ func TestAirflow2(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Len(t, status, 2)
 		})
+		t.Run("should normalize execution date with non UTC offset to UTC", func(t *testing.T) {
+			respString := `
+{
+"dag_runs": [
+	{
+		"dag_id": "sample_select",
+		"execution_date": "2020-03-25T07:30:00+05:30",
+		"run_id": "scheduled__2020-03-25T02:00:00+00:00",
+		"state": "success"
+	}
+],
+"total_entries": 1
+}`
+			r := ioutil.NopCloser(bytes.NewReader([]byte(respString)))
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       r,
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			status, err := air.GetJobStatus(ctx, models.ProjectSpec{
+				Name: "test-proj",
+				Config: map[string]string{
+					models.ProjectSchedulerHost: host,
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSchedulerAuth,
+						Value: "admin:admin",
+					},
+				},
+			}, "sample_select")
+
+			assert.Nil(t, err)
+			assert.Len(t, status, 1)
+			assert.Equal(t, time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC), status[0].ScheduledAt)
+		})
+		t.Run("should return start and end time of runs when present", func(t *testing.T) {
+			respString := `
+{
+"dag_runs": [
+	{
+		"dag_id": "sample_select",
+		"execution_date": "2020-03-25T02:00:00+00:00",
+		"start_date": "2020-03-26T02:00:05.123+00:00",
+		"end_date": "2020-03-26T02:30:00+00:00",
+		"state": "success"
+	},
+	{
+		"dag_id": "sample_select",
+		"execution_date": "2020-03-26T02:00:00+00:00",
+		"start_date": "2020-03-27T02:00:05+00:00",
+		"end_date": null,
+		"state": "running"
+	},
+	{
+		"dag_id": "sample_select",
+		"execution_date": "2020-03-27T02:00:00+00:00",
+		"state": "queued"
+	}
+],
+"total_entries": 3
+}`
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			status, err := air.GetJobStatus(ctx, models.ProjectSpec{
+				Name: "test-proj",
+				Config: map[string]string{
+					models.ProjectSchedulerHost: host,
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSchedulerAuth,
+						Value: "admin:admin",
+					},
+				},
+			}, "sample_select")
+
+			assert.Nil(t, err)
+			assert.Len(t, status, 3)
+			assert.Equal(t, timeRef("2020-03-26T02:00:05.123+00:00"), status[0].StartedAt)
+			assert.Equal(t, timeRef("2020-03-26T02:30:00+00:00"), status[0].EndedAt)
+			assert.Equal(t, timeRef("2020-03-27T02:00:05+00:00"), status[1].StartedAt)
+			assert.Nil(t, status[1].EndedAt)
+			assert.Nil(t, status[2].StartedAt)
+			assert.Nil(t, status[2].EndedAt)
+		})
+		t.Run("should resolve templated scheduler host with project secrets and configs", func(t *testing.T) {
+			var requestedURL string
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					requestedURL = req.URL.String()
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"dag_runs": [], "total_entries": 0}`))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.GetJobStatus(ctx, models.ProjectSpec{
+				Name: "test-proj",
+				Config: map[string]string{
+					models.ProjectSchedulerHost: "https://{{.GLOBAL__ENV}}.{{.SECRET__AIRFLOW_DOMAIN}}/",
+					"ENV":                       "staging",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSchedulerAuth,
+						Value: "admin:admin",
+					},
+					{
+						Name:  "AIRFLOW_DOMAIN",
+						Value: "airflow.example.io",
+					},
+				},
+			}, "sample_select")
+
+			assert.Nil(t, err)
+			assert.Equal(t, "https://staging.airflow.example.io/api/v1/dags/sample_select/dagRuns?limit=99999", requestedURL)
+		})
+		t.Run("should fail if templated scheduler host doesn't resolve to a valid url", func(t *testing.T) {
+			for _, schdHost := range []string{"{{.GLOBAL__ENV}}", "https://{{.SECRET__UNKNOWN}}"} {
+				air := airflow2.NewScheduler(nil, &MockHttpClient{})
+				_, err := air.GetJobStatus(ctx, models.ProjectSpec{
+					Name: "test-proj",
+					Config: map[string]string{
+						models.ProjectSchedulerHost: schdHost,
+						"ENV":                       "staging",
+					},
+					Secret: []models.ProjectSecretItem{
+						{
+							Name:  models.ProjectSchedulerAuth,
+							Value: "admin:admin",
+						},
+					},
+				}, "sample_select")
+				assert.NotNil(t, err, schdHost)
+			}
+		})
 		t.Run("should fail if host fails to return OK", func(t *testing.T) {
 			respString := `INTERNAL ERROR`
 			r := ioutil.NopCloser(bytes.NewReader([]byte(respString)))
@@ -317,16 +639,20 @@ func TestAirflow2(t *testing.T) {
 ],
 "total_entries": 2
 }`
-			expectedExecutionTime0, _ := time.Parse(models.InstanceScheduledAtTimeLayout, "2020-03-25T02:00:00+00:00")
-			expectedExecutionTime1, _ := time.Parse(models.InstanceScheduledAtTimeLayout, "2020-03-26T02:00:00+00:00")
+			expectedExecutionTime0 := time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC)
+			expectedExecutionTime1 := time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC)
 			expectedStatus := []models.JobStatus{
 				{
 					ScheduledAt: expectedExecutionTime0,
 					State:       models.JobStatusStateSuccess,
+					StartedAt:   timeRef("2020-06-01T16:32:58.489042+00:00"),
+					EndedAt:     timeRef("2020-06-01T17:32:58.489042+00:00"),
 				},
 				{
 					ScheduledAt: expectedExecutionTime1,
 					State:       models.JobStatusStateSuccess,
+					StartedAt:   timeRef("2020-06-01T16:33:01.020645+00:00"),
+					EndedAt:     timeRef("2020-06-01T16:33:01.020645+00:00"),
 				},
 			}
 
@@ -387,21 +713,27 @@ func TestAirflow2(t *testing.T) {
     ],
     "total_entries": 3
 }`
-			expectedExecutionTime0, _ := time.Parse(models.InstanceScheduledAtTimeLayout, "2020-03-25T02:00:00+00:00")
-			expectedExecutionTime1, _ := time.Parse(models.InstanceScheduledAtTimeLayout, "2020-03-26T02:00:00+00:00")
-			expectedExecutionTime2, _ := time.Parse(models.InstanceScheduledAtTimeLayout, "2020-03-26T02:00:00+00:00")
+			expectedExecutionTime0 := time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC)
+			expectedExecutionTime1 := time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC)
+			expectedExecutionTime2 := time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC)
 			expectedStatus := []models.JobStatus{
 				{
 					ScheduledAt: expectedExecutionTime0,
 					State:       models.JobStatusStateSuccess,
+					StartedAt:   timeRef("2020-06-01T16:32:58.489042+00:00"),
+					EndedAt:     timeRef("2020-06-01T17:32:58.489042+00:00"),
 				},
 				{
 					ScheduledAt: expectedExecutionTime1,
 					State:       models.JobStatusStateFailed,
+					StartedAt:   timeRef("2020-06-01T16:33:01.020645+00:00"),
+					EndedAt:     timeRef("2020-06-01T16:33:01.020645+00:00"),
 				},
 				{
 					ScheduledAt: expectedExecutionTime2,
 					State:       models.JobStatusStateRunning,
+					StartedAt:   timeRef("2020-06-01T16:35:01.020645+00:00"),
+					EndedAt:     timeRef("2020-06-01T16:34:01.020645+00:00"),
 				},
 			}
 
@@ -446,4 +778,2052 @@ func TestAirflow2(t *testing.T) {
 			assert.Len(t, status, 0)
 		})
 	})
+	t.Run("Diff", func(t *testing.T) {
+		host := "http://airflow.example.io"
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: host,
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		deployedSource := "# Code generated by optimus v0.0.1. DO NOT EDIT.\n\nfrom airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\")\n"
+		clientFor := func(source string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					var respString string
+					switch req.URL.Path {
+					case "/api/v1/dags/sample_select":
+						respString = `{"dag_id": "sample_select", "file_token": "token-1", "is_paused": false}`
+					case "/api/v1/dagSources/token-1":
+						content, _ := json.Marshal(map[string]string{"content": source})
+						respString = string(content)
+					default:
+						return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should not report a diff for identical sources ignoring comments", func(t *testing.T) {
+			desired := "# Code generated by optimus v0.0.2. DO NOT EDIT.\nfrom airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\")  \n"
+
+			air := airflow2.NewScheduler(nil, clientFor(deployedSource))
+			differs, err := air.Diff(ctx, projectSpec, "sample_select", []byte(desired))
+			assert.Nil(t, err)
+			assert.False(t, differs)
+		})
+		t.Run("should report a diff for divergent sources", func(t *testing.T) {
+			desired := "# Code generated by optimus v0.0.1. DO NOT EDIT.\n\nfrom airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\", catchup=True)\n"
+
+			air := airflow2.NewScheduler(nil, clientFor(deployedSource))
+			differs, err := air.Diff(ctx, projectSpec, "sample_select", []byte(desired))
+			assert.Nil(t, err)
+			assert.True(t, differs)
+		})
+		t.Run("should report a diff within multi-line strings", func(t *testing.T) {
+			deployed := "from airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\", doc_md=\"\"\"\n# Owner\n\nteam-a\n\"\"\")\n"
+			air := airflow2.NewScheduler(nil, clientFor(deployed))
+
+			for _, desired := range []string{
+				"from airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\", doc_md=\"\"\"\n# Owner\n\nteam-b\n\"\"\")\n",
+				"from airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\", doc_md=\"\"\"\n# Owners\n\nteam-a\n\"\"\")\n",
+				"from airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\", doc_md=\"\"\"\n# Owner\nteam-a\n\"\"\")\n",
+			} {
+				differs, err := air.Diff(ctx, projectSpec, "sample_select", []byte(desired))
+				assert.Nil(t, err)
+				assert.True(t, differs, desired)
+			}
+		})
+		t.Run("should fail if deployed dag is not found", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, clientFor(deployedSource))
+			_, err := air.Diff(ctx, projectSpec, "unknown", []byte(deployedSource))
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("MarkRunState", func(t *testing.T) {
+		host := "http://airflow.example.io"
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: host,
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		runID := "scheduled__2020-03-25T02:00:00+00:00"
+
+		for _, state := range []models.JobStatusState{models.JobStatusStateSuccess, models.JobStatusStateFailed} {
+			t.Run(fmt.Sprintf("should mark dag run as %s", state), func(t *testing.T) {
+				var requestBody map[string]string
+				client := &MockHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if req.URL.Path == "/api/v1/version" {
+							return &http.Response{
+								StatusCode: http.StatusOK,
+								Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"version": "2.2.3", "git_version": null}`))),
+							}, nil
+						}
+						assert.Equal(t, http.MethodPatch, req.Method)
+						assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/"+runID, req.URL.Path)
+						body, _ := ioutil.ReadAll(req.Body)
+						assert.Nil(t, json.Unmarshal(body, &requestBody))
+						return &http.Response{
+							StatusCode: http.StatusOK,
+							Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+						}, nil
+					},
+				}
+
+				air := airflow2.NewScheduler(nil, client)
+				err := air.MarkRunState(ctx, projectSpec, "sample_select", runID, state)
+				assert.Nil(t, err)
+				assert.Equal(t, state.String(), requestBody["state"])
+			})
+		}
+		t.Run("should fail for a state which can't be set", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, &MockHttpClient{})
+			err := air.MarkRunState(ctx, projectSpec, "sample_select", runID, models.JobStatusStateRunning)
+			assert.NotNil(t, err)
+		})
+		t.Run("should fail on airflow versions not supporting it", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v1/version", req.URL.Path)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"version": "2.1.4+composer"}`))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			err := air.MarkRunState(ctx, projectSpec, "sample_select", runID, models.JobStatusStateFailed)
+			assert.EqualError(t, err, "marking dag run state requires Airflow >= 2.2.0, project test-proj runs 2.1.4+composer")
+		})
+	})
+	t.Run("GetVersion", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should return version of airflow", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "http://airflow.example.io/api/v1/version", req.URL.String())
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"version": "2.1.4", "git_version": "release:2.1.4+abc"}`))),
+					}, nil
+				},
+			}
+
+			version, err := airflow2.NewScheduler(nil, client).GetVersion(ctx, projectSpec)
+			assert.Nil(t, err)
+			assert.Equal(t, "2.1.4", version)
+		})
+		t.Run("should fail if version is missing in response", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+					}, nil
+				},
+			}
+
+			_, err := airflow2.NewScheduler(nil, client).GetVersion(ctx, projectSpec)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("GetSLAMisses", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		startDate := time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2020, 3, 29, 0, 0, 0, 0, time.UTC)
+
+		t.Run("should return runs which breached the sla", func(t *testing.T) {
+			respString := `{
+    "dag_runs": [
+        {
+            "execution_date": "2020-03-25T02:00:00+00:00",
+            "start_date": "2020-03-26T02:00:00+00:00",
+            "end_date": "2020-03-26T02:30:00+00:00",
+            "state": "success"
+        },
+        {
+            "execution_date": "2020-03-26T02:00:00+00:00",
+            "start_date": "2020-03-27T02:00:00+00:00",
+            "end_date": "2020-03-27T04:00:00+00:00",
+            "state": "success"
+        },
+        {
+            "execution_date": "2020-03-27T02:00:00+00:00",
+            "start_date": "2020-03-28T02:00:00+00:00",
+            "end_date": null,
+            "state": "running"
+        },
+        {
+            "execution_date": "2020-03-28T02:00:00+00:00",
+            "start_date": null,
+            "end_date": null,
+            "state": "queued"
+        }
+    ],
+    "total_entries": 4
+}`
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			misses, err := air.GetSLAMisses(ctx, projectSpec, "sample_select", startDate, endDate, time.Hour)
+			assert.Nil(t, err)
+			assert.Len(t, misses, 3)
+			assert.Equal(t, time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC), misses[0].ScheduledAt)
+			assert.Equal(t, time.Date(2020, 3, 27, 2, 0, 0, 0, time.UTC), misses[1].ScheduledAt)
+			assert.Equal(t, time.Date(2020, 3, 28, 2, 0, 0, 0, time.UTC), misses[2].ScheduledAt)
+		})
+		t.Run("should measure runs yet to start from their schedule time", func(t *testing.T) {
+			recent := time.Now().UTC().Add(-10 * time.Minute).Truncate(time.Second)
+			stale := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+			respString := fmt.Sprintf(`{
+    "dag_runs": [
+        {
+            "execution_date": "%s",
+            "start_date": null,
+            "end_date": null,
+            "state": "queued"
+        },
+        {
+            "execution_date": "%s",
+            "start_date": null,
+            "end_date": null,
+            "state": "queued"
+        }
+    ],
+    "total_entries": 2
+}`, recent.Format(time.RFC3339), stale.Format(time.RFC3339))
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			misses, err := air.GetSLAMisses(ctx, projectSpec, "sample_select", stale, recent, time.Hour)
+			assert.Nil(t, err)
+			assert.Len(t, misses, 1)
+			assert.Equal(t, stale, misses[0].ScheduledAt)
+		})
+		t.Run("should fail if runs can't be fetched", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusInternalServerError,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("INTERNAL ERROR"))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.GetSLAMisses(ctx, projectSpec, "sample_select", startDate, endDate, time.Hour)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("should be safe to use concurrently", func(t *testing.T) {
+		respString := `{
+    "dag_runs": [
+        {
+            "execution_date": "2020-03-25T02:00:00+00:00",
+            "start_date": "2020-03-26T02:00:00+00:00",
+            "end_date": "2020-03-26T02:30:00+00:00",
+            "state": "success"
+        }
+    ],
+    "total_entries": 1
+}`
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+				}, nil
+			},
+		}
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://{{.GLOBAL__ENV}}.airflow.example.io",
+				"ENV":                       "staging",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+
+		air := airflow2.NewScheduler(nil, client)
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+				if err == nil && len(status) != 1 {
+					err = fmt.Errorf("expected 1 run, got %d", len(status))
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.Nil(t, err)
+		}
+	})
+	t.Run("ClearTasks", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2021, 5, 25, 0, 0, 0, 0, time.UTC)
+
+		t.Run("should pass task ids to clear in the request", func(t *testing.T) {
+			var received map[string]interface{}
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "http://airflow.example.io/api/v1/dags/sample_select/clearTaskInstances", req.URL.String())
+					body, err := ioutil.ReadAll(req.Body)
+					assert.Nil(t, err)
+					assert.Nil(t, json.Unmarshal(body, &received))
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			err := air.ClearTasks(ctx, projectSpec, "sample_select", []string{"transformation_bq", "hook_predator"}, startDate, endDate)
+			assert.Nil(t, err)
+			assert.Equal(t, []interface{}{"transformation_bq", "hook_predator"}, received["task_ids"])
+			assert.Equal(t, "2021-05-20T00:00:00+00:00", received["start_date"])
+			assert.Equal(t, "2021-05-25T00:00:00+00:00", received["end_date"])
+			assert.Equal(t, true, received["reset_dag_runs"])
+		})
+		t.Run("should fail if no task is provided", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, &MockHttpClient{})
+			err := air.ClearTasks(ctx, projectSpec, "sample_select", nil, startDate, endDate)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("WithClearRateLimit", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+				}, nil
+			},
+		}
+		startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2021, 5, 25, 0, 0, 0, 0, time.UTC)
+
+		t.Run("should limit clears to the configured rate", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, client, airflow2.WithClearRateLimit(20, 1))
+
+			// first clear uses the burst, rest wait for 50ms each
+			began := time.Now()
+			for i := 0; i < 5; i++ {
+				assert.Nil(t, air.Clear(ctx, projectSpec, "sample_select", startDate, endDate))
+			}
+			assert.GreaterOrEqual(t, int64(time.Since(began)), int64(200*time.Millisecond))
+		})
+		t.Run("should stop waiting when context is cancelled", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, client, airflow2.WithClearRateLimit(0.1, 1))
+			assert.Nil(t, air.Clear(ctx, projectSpec, "sample_select", startDate, endDate))
+
+			timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			err := air.Clear(timeoutCtx, projectSpec, "sample_select", startDate, endDate)
+			assert.NotNil(t, err)
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	})
+	t.Run("GetJobStatusByRunType", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		respString := `{
+    "dag_runs": [
+        {
+            "execution_date": "2020-03-25T02:00:00+00:00",
+            "run_id": "scheduled__2020-03-25T02:00:00+00:00",
+            "external_trigger": false,
+            "run_type": "scheduled",
+            "state": "success"
+        },
+        {
+            "execution_date": "2020-03-20T02:00:00+00:00",
+            "run_id": "backfill__2020-03-20T02:00:00+00:00",
+            "run_type": "backfill",
+            "state": "success"
+        },
+        {
+            "execution_date": "2020-03-25T10:00:00+00:00",
+            "run_id": "manual__2020-03-25T10:00:00+00:00",
+            "external_trigger": true,
+            "run_type": "manual",
+            "state": "failed"
+        }
+    ],
+    "total_entries": 3
+}`
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+				}, nil
+			},
+		}
+		air := airflow2.NewScheduler(nil, client)
+
+		t.Run("should return only runs of requested run types", func(t *testing.T) {
+			status, err := air.GetJobStatusByRunType(ctx, projectSpec, "sample_select", models.JobRunTypeScheduled)
+			assert.Nil(t, err)
+			assert.Equal(t, []models.JobStatus{
+				{
+					ScheduledAt: time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC),
+					State:       models.JobStatusStateSuccess,
+					RunType:     models.JobRunTypeScheduled,
+				},
+			}, status)
+		})
+		t.Run("should return all runs if no run type is requested", func(t *testing.T) {
+			status, err := air.GetJobStatusByRunType(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Len(t, status, 3)
+			assert.Equal(t, models.JobRunTypeBackfill, status[1].RunType)
+		})
+		t.Run("should parse external trigger flag of runs", func(t *testing.T) {
+			status, err := air.GetJobStatusByRunType(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.False(t, status[0].ExternalTrigger)
+			assert.False(t, status[1].ExternalTrigger)
+			assert.True(t, status[2].ExternalTrigger)
+		})
+	})
+	t.Run("WithMetrics", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should count api calls by endpoint and status", func(t *testing.T) {
+			statusCode := http.StatusOK
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: statusCode,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"dag_runs": [], "total_entries": 0}`))),
+					}, nil
+				},
+			}
+			metrics := new(mocked.MetricsRecorder)
+			metrics.On("IncCounter", "scheduler_api_calls_total", map[string]string{
+				"scheduler": "airflow2",
+				"endpoint":  "GET dags/%s/dagRuns?limit=99999",
+				"status":    "200",
+			}).Return().Once()
+			metrics.On("IncCounter", "scheduler_api_calls_total", map[string]string{
+				"scheduler": "airflow2",
+				"endpoint":  "POST dags/%s/clearTaskInstances",
+				"status":    "404",
+			}).Return().Once()
+			metrics.On("ObserveDuration", "scheduler_api_call_duration", mock.Anything, mock.Anything).Return()
+			defer metrics.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(nil, client, airflow2.WithMetrics(metrics))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+
+			statusCode = http.StatusNotFound
+			err = air.Clear(ctx, projectSpec, "sample_select", time.Now(), time.Now())
+			assert.NotNil(t, err)
+		})
+		t.Run("should observe latency of api calls by endpoint", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					time.Sleep(5 * time.Millisecond)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"dag_runs": []}`))),
+					}, nil
+				},
+			}
+			metrics := new(mocked.MetricsRecorder)
+			metrics.On("IncCounter", "scheduler_api_calls_total", mock.Anything).Return()
+			metrics.On("ObserveDuration", "scheduler_api_call_duration", map[string]string{
+				"scheduler": "airflow2",
+				"endpoint":  "GET dags/%s/dagRuns?limit=99999",
+			}, mock.MatchedBy(func(d time.Duration) bool {
+				return d >= 5*time.Millisecond
+			})).Return().Once()
+			defer metrics.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(nil, client, airflow2.WithMetrics(metrics))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+		})
+	})
+	t.Run("CancelRun", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		runID := "scheduled__2020-03-25T02:00:00+00:00"
+		newClient := func(runState string, patched *map[string]string, cleared *map[string]interface{}) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					respString := `{}`
+					switch {
+					case req.URL.Path == "/api/v1/version":
+						respString = `{"version": "2.2.3"}`
+					case req.Method == http.MethodGet:
+						assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/"+runID, req.URL.Path)
+						respString = fmt.Sprintf(`{"dag_run_id": "%s", "execution_date": "2020-03-25T02:00:00+00:00", "state": "%s"}`,
+							runID, runState)
+					case req.Method == http.MethodPatch:
+						body, _ := ioutil.ReadAll(req.Body)
+						assert.Nil(t, json.Unmarshal(body, patched))
+					case req.Method == http.MethodPost:
+						assert.Equal(t, "/api/v1/dags/sample_select/clearTaskInstances", req.URL.Path)
+						assert.NotEmpty(t, *patched, "dag run should be marked failed before clearing")
+						body, _ := ioutil.ReadAll(req.Body)
+						assert.Nil(t, json.Unmarshal(body, cleared))
+						respString = `{"task_instances": []}`
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should mark a running dag run as failed and clear its running tasks", func(t *testing.T) {
+			patched := map[string]string{}
+			cleared := map[string]interface{}{}
+			air := airflow2.NewScheduler(nil, newClient("running", &patched, &cleared))
+			err := air.CancelRun(ctx, projectSpec, "sample_select", runID)
+			assert.Nil(t, err)
+			assert.Equal(t, "failed", patched["state"])
+			assert.Equal(t, map[string]interface{}{
+				"start_date":         "2020-03-25T02:00:00+00:00",
+				"end_date":           "2020-03-25T02:00:00+00:00",
+				"dry_run":            false,
+				"reset_dag_runs":     false,
+				"only_failed":        false,
+				"only_running":       true,
+				"include_downstream": true,
+			}, cleared)
+		})
+		t.Run("should not touch a finished dag run", func(t *testing.T) {
+			patched := map[string]string{}
+			cleared := map[string]interface{}{}
+			air := airflow2.NewScheduler(nil, newClient("success", &patched, &cleared))
+			err := air.CancelRun(ctx, projectSpec, "sample_select", runID)
+			assert.True(t, errors.Is(err, airflow2.ErrRunAlreadyFinished))
+			assert.Len(t, patched, 0)
+			assert.Len(t, cleared, 0)
+		})
+	})
+	t.Run("ErrorClassification", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(statusCode int) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: statusCode,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+					}, nil
+				},
+			}
+		}
+		cases := []struct {
+			statusCode int
+			expected   error
+		}{
+			{http.StatusUnauthorized, airflow2.ErrAuth},
+			{http.StatusNotFound, airflow2.ErrNotFound},
+			{http.StatusServiceUnavailable, airflow2.ErrTransient},
+			{http.StatusBadRequest, airflow2.ErrFatal},
+		}
+		classes := []error{airflow2.ErrAuth, airflow2.ErrNotFound, airflow2.ErrTransient, airflow2.ErrFatal}
+		for _, tc := range cases {
+			air := airflow2.NewScheduler(nil, newClient(tc.statusCode))
+
+			_, statusErr := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			clearErr := air.Clear(ctx, projectSpec, "sample_select", time.Now(), time.Now())
+			for _, class := range classes {
+				assert.Equal(t, class == tc.expected, errors.Is(statusErr, class), "status %d", tc.statusCode)
+				assert.Equal(t, class == tc.expected, errors.Is(clearErr, class), "status %d", tc.statusCode)
+			}
+		}
+		t.Run("should classify unreachable airflow as transient", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("connection refused")
+				},
+			})
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.True(t, errors.Is(err, airflow2.ErrTransient))
+		})
+	})
+	t.Run("ScheduledRunID", func(t *testing.T) {
+		t.Run("should follow run id convention of airflow", func(t *testing.T) {
+			scheduledAt := time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC)
+			assert.Equal(t, "scheduled__2020-03-25T02:00:00+00:00", airflow2.ScheduledRunID(scheduledAt))
+		})
+		t.Run("should normalize time to UTC", func(t *testing.T) {
+			scheduledAt := time.Date(2020, 3, 25, 7, 30, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+			assert.Equal(t, "scheduled__2020-03-25T02:00:00+00:00", airflow2.ScheduledRunID(scheduledAt))
+		})
+	})
+	t.Run("ClearWithResult", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2021, 5, 21, 0, 0, 0, 0, time.UTC)
+
+		t.Run("should return task instances cleared by airflow", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v1/dags/sample_select/clearTaskInstances", req.URL.Path)
+					respString := `{"task_instances": [
+						{"dag_id": "sample_select", "dag_run_id": "scheduled__2021-05-20T02:00:00+00:00", "execution_date": "2021-05-20T02:00:00+00:00", "task_id": "bq"},
+						{"dag_id": "sample_select", "dag_run_id": "scheduled__2021-05-20T02:00:00+00:00", "execution_date": "2021-05-20T02:00:00+00:00", "task_id": "wait_upstream"}
+					]}`
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			result, err := air.ClearWithResult(ctx, projectSpec, "sample_select", startDate, endDate)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, result.Count())
+			assert.Equal(t, "bq", result.TaskInstances[0].TaskID)
+			assert.Equal(t, "scheduled__2021-05-20T02:00:00+00:00", result.TaskInstances[0].DagRunID)
+		})
+		t.Run("should fail on malformed response", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`not json`))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.ClearWithResult(ctx, projectSpec, "sample_select", startDate, endDate)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("RefreshDag", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(version string, requests *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					*requests = append(*requests, fmt.Sprintf("%s %s", req.Method, req.URL.Path))
+					respString := `{}`
+					switch req.URL.Path {
+					case "/api/v1/version":
+						respString = fmt.Sprintf(`{"version": "%s"}`, version)
+					case "/api/v1/dags/sample_select":
+						respString = `{"dag_id": "sample_select", "file_token": "Ii9vcHQvZGFncy9zYW1wbGUucHki"}`
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should request reparse of the dag file", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient("2.6.1", &requests))
+			err := air.RefreshDag(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				"GET /api/v1/version",
+				"GET /api/v1/dags/sample_select",
+				"PUT /api/v1/parseDagFile/Ii9vcHQvZGFncy9zYW1wbGUucHki",
+			}, requests)
+		})
+		t.Run("should fail for airflow not supporting reparse", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient("2.2.3", &requests))
+			err := air.RefreshDag(ctx, projectSpec, "sample_select")
+			assert.NotNil(t, err)
+			assert.Equal(t, []string{"GET /api/v1/version"}, requests)
+		})
+	})
+	t.Run("UserAgent", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(userAgent *string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					*userAgent = req.Header.Get("User-Agent")
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"dag_runs": []}`))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should identify optimus with its version by default", func(t *testing.T) {
+			var userAgent string
+			air := airflow2.NewScheduler(nil, newClient(&userAgent))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, "optimus/"+config.Version, userAgent)
+		})
+		t.Run("should use configured user agent", func(t *testing.T) {
+			var userAgent string
+			air := airflow2.NewScheduler(nil, newClient(&userAgent), airflow2.WithUserAgent("optimus/1.2.3 (data-platform)"))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, "optimus/1.2.3 (data-platform)", userAgent)
+		})
+	})
+	t.Run("GetLastSuccessRun", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(respString string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should skip later failed runs", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, newClient(`{"dag_runs": [
+				{"execution_date": "2020-03-23T02:00:00+00:00", "state": "success"},
+				{"execution_date": "2020-03-24T02:00:00+00:00", "state": "success"},
+				{"execution_date": "2020-03-25T02:00:00+00:00", "state": "failed"}
+			]}`))
+			lastSuccess, ok, err := air.GetLastSuccessRun(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, time.Date(2020, 3, 24, 2, 0, 0, 0, time.UTC), lastSuccess)
+		})
+		t.Run("should report job which never succeeded", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, newClient(`{"dag_runs": [
+				{"execution_date": "2020-03-25T02:00:00+00:00", "state": "running"}
+			]}`))
+			_, ok, err := air.GetLastSuccessRun(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.False(t, ok)
+		})
+	})
+	t.Run("GetJobStatusBulk", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+
+		t.Run("should return statuses of jobs fetched along with errors of failed ones", func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					mu.Lock()
+					inFlight++
+					if inFlight > maxInFlight {
+						maxInFlight = inFlight
+					}
+					mu.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+
+					if strings.Contains(req.URL.Path, "broken") {
+						return &http.Response{
+							StatusCode: http.StatusInternalServerError,
+							Body:       ioutil.NopCloser(bytes.NewReader([]byte(`INTERNAL ERROR`))),
+						}, nil
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(bytes.NewReader([]byte(`{"dag_runs": [
+							{"execution_date": "2020-03-25T02:00:00+00:00", "state": "success"}
+						]}`))),
+					}, nil
+				},
+			}
+
+			air := airflow2.NewScheduler(nil, client)
+			jobStatus, errs := air.GetJobStatusBulk(ctx, projectSpec,
+				[]string{"job_a", "broken_b", "job_c", "job_d", "broken_e"}, 2)
+			assert.Len(t, jobStatus, 3)
+			for _, jobName := range []string{"job_a", "job_c", "job_d"} {
+				assert.Len(t, jobStatus[jobName], 1)
+			}
+			assert.Len(t, errs, 2)
+			assert.Contains(t, errs[0].Error(), "broken_b")
+			assert.Contains(t, errs[1].Error(), "broken_e")
+			assert.LessOrEqual(t, maxInFlight, 2)
+		})
+	})
+	t.Run("ClearWithNote", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2021, 5, 21, 0, 0, 0, 0, time.UTC)
+		runID := "scheduled__2021-05-20T02:00:00+00:00"
+		newClient := func(version string, notes *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					respString := `{}`
+					switch {
+					case req.URL.Path == "/api/v1/version":
+						respString = fmt.Sprintf(`{"version": "%s"}`, version)
+					case req.URL.Path == "/api/v1/dags/sample_select/clearTaskInstances":
+						respString = fmt.Sprintf(`{"task_instances": [
+							{"dag_id": "sample_select", "dag_run_id": "%s", "task_id": "bq"},
+							{"dag_id": "sample_select", "dag_run_id": "%s", "task_id": "wait_upstream"}
+						]}`, runID, runID)
+					case req.Method == http.MethodPatch:
+						assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/"+runID+"/setNote", req.URL.Path)
+						body, _ := ioutil.ReadAll(req.Body)
+						*notes = append(*notes, string(body))
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should attach note to each cleared dag run", func(t *testing.T) {
+			var notes []string
+			air := airflow2.NewScheduler(nil, newClient("2.5.1", &notes))
+			result, err := air.ClearWithNote(ctx, projectSpec, "sample_select", startDate, endDate, "rerun after fixing source, JIRA-42")
+			assert.Nil(t, err)
+			assert.Equal(t, 2, result.Count())
+			assert.Equal(t, []string{`{"note":"rerun after fixing source, JIRA-42"}`}, notes)
+		})
+		t.Run("should skip notes on airflow not supporting them", func(t *testing.T) {
+			var notes []string
+			air := airflow2.NewScheduler(nil, newClient("2.2.3", &notes))
+			result, err := air.ClearWithNote(ctx, projectSpec, "sample_select", startDate, endDate, "rerun")
+			assert.Nil(t, err)
+			assert.Equal(t, 2, result.Count())
+			assert.Len(t, notes, 0)
+		})
+	})
+	t.Run("TriggerRun", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		executionTime := time.Date(2021, 5, 20, 2, 0, 0, 0, time.UTC)
+		runID := "manual__2021-05-20T02:00:00+00:00"
+		newClient := func(version string, triggered *map[string]interface{}, notes *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					respString := `{}`
+					switch {
+					case req.URL.Path == "/api/v1/version":
+						respString = fmt.Sprintf(`{"version": "%s"}`, version)
+					case req.Method == http.MethodPost:
+						assert.Equal(t, "/api/v1/dags/sample_select/dagRuns", req.URL.Path)
+						body, _ := ioutil.ReadAll(req.Body)
+						assert.Nil(t, json.Unmarshal(body, triggered))
+						respString = fmt.Sprintf(`{"dag_run_id": "%s", "state": "queued"}`, runID)
+					case req.Method == http.MethodPatch:
+						assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/"+runID+"/setNote", req.URL.Path)
+						body, _ := ioutil.ReadAll(req.Body)
+						*notes = append(*notes, string(body))
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should attach note to the triggered dag run", func(t *testing.T) {
+			var triggered map[string]interface{}
+			var notes []string
+			air := airflow2.NewScheduler(nil, newClient("2.5.1", &triggered, &notes))
+			dagRunID, err := air.TriggerRun(ctx, projectSpec, "sample_select", executionTime,
+				map[string]string{"region": "apac"}, "backfill for JIRA-42")
+			assert.Nil(t, err)
+			assert.Equal(t, runID, dagRunID)
+			assert.Equal(t, map[string]interface{}{
+				"execution_date": "2021-05-20T02:00:00+00:00",
+				"conf":           map[string]interface{}{"region": "apac"},
+			}, triggered)
+			assert.Equal(t, []string{`{"note":"backfill for JIRA-42"}`}, notes)
+		})
+		t.Run("should skip notes on airflow not supporting them", func(t *testing.T) {
+			var triggered map[string]interface{}
+			var notes []string
+			air := airflow2.NewScheduler(nil, newClient("2.2.3", &triggered, &notes))
+			dagRunID, err := air.TriggerRun(ctx, projectSpec, "sample_select", executionTime, nil, "backfill")
+			assert.Nil(t, err)
+			assert.Equal(t, runID, dagRunID)
+			assert.Len(t, notes, 0)
+		})
+		t.Run("should not set a note unless provided", func(t *testing.T) {
+			var triggered map[string]interface{}
+			var notes []string
+			air := airflow2.NewScheduler(nil, newClient("2.5.1", &triggered, &notes))
+			_, err := air.TriggerRun(ctx, projectSpec, "sample_select", executionTime, nil, "")
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]interface{}{}, triggered["conf"])
+			assert.Len(t, notes, 0)
+		})
+	})
+	t.Run("ClearOptions", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+		endDate := time.Date(2021, 5, 25, 0, 0, 0, 0, time.UTC)
+		newClient := func(received *map[string]interface{}) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					body, _ := ioutil.ReadAll(req.Body)
+					assert.Nil(t, json.Unmarshal(body, received))
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"task_instances": []}`))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should leave out include flags by default", func(t *testing.T) {
+			var received map[string]interface{}
+			air := airflow2.NewScheduler(nil, newClient(&received))
+			err := air.ClearTasks(ctx, projectSpec, "sample_select", []string{"bq"}, startDate, endDate)
+			assert.Nil(t, err)
+			for _, flag := range []string{"include_upstream", "include_downstream", "include_future", "include_past"} {
+				assert.NotContains(t, received, flag)
+			}
+		})
+		t.Run("should send each include flag set", func(t *testing.T) {
+			cases := map[string]airflow2.ClearOption{
+				"include_upstream":   airflow2.IncludeUpstream(),
+				"include_downstream": airflow2.IncludeDownstream(),
+				"include_future":     airflow2.IncludeFuture(),
+				"include_past":       airflow2.IncludePast(),
+			}
+			for flag, opt := range cases {
+				var received map[string]interface{}
+				air := airflow2.NewScheduler(nil, newClient(&received))
+				err := air.ClearTasks(ctx, projectSpec, "sample_select", []string{"bq"}, startDate, endDate, opt)
+				assert.Nil(t, err)
+				assert.Equal(t, true, received[flag], flag)
+				for other := range cases {
+					if other != flag {
+						assert.NotContains(t, received, other)
+					}
+				}
+			}
+		})
+		t.Run("should send include flags when clearing with result", func(t *testing.T) {
+			var received map[string]interface{}
+			air := airflow2.NewScheduler(nil, newClient(&received))
+			_, err := air.ClearWithResult(ctx, projectSpec, "sample_select", startDate, endDate,
+				airflow2.IncludeDownstream(), airflow2.IncludePast())
+			assert.Nil(t, err)
+			assert.Equal(t, true, received["include_downstream"])
+			assert.Equal(t, true, received["include_past"])
+		})
+	})
+	t.Run("CustomJobFiles", func(t *testing.T) {
+		t.Run("should default to python dags", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil)
+			assert.Equal(t, ".py", air.GetJobsExtension())
+		})
+		t.Run("should use configured extension of dags", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, nil, airflow2.WithJobsExtension("dag"))
+			assert.Equal(t, ".dag", air.GetJobsExtension())
+		})
+		t.Run("should upload lib with configured name on bootstrap", func(t *testing.T) {
+			var out bytes.Buffer
+			wc := new(mocked.WriteCloser)
+			defer wc.AssertExpectations(t)
+			wc.On("Write").Return(&out, nil)
+			wc.On("Close").Return(nil)
+
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			ow.On("NewWriter", ctx, "mybucket", "hello/dags/optimus_lib.py").Return(wc, nil)
+
+			owf := new(MockedObjectWriterFactory)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+			defer owf.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(owf, nil, airflow2.WithLibFileName("optimus_lib.py"))
+			err := air.Bootstrap(ctx, models.ProjectSpec{
+				Name: "proj-name",
+				Config: map[string]string{
+					models.ProjectStoragePathKey: "gs://mybucket/hello",
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: "test-secret",
+					},
+				},
+			})
+			assert.Nil(t, err)
+		})
+	})
+	t.Run("SetCatchup", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost:  "http://airflow.example.io",
+				models.ProjectStoragePathKey: "gs://mybucket/hello",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+				{
+					Name:  models.ProjectSecretStorageKey,
+					Value: "test-secret",
+				},
+			},
+		}
+		newClient := func(catchup string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					respString := `{}`
+					switch req.URL.Path {
+					case "/api/v1/dags/sample_select":
+						respString = `{"dag_id": "sample_select", "fileloc": "/home/airflow/gcs/dags/ns-id/sample_select.py", "file_token": "abc"}`
+					case "/api/v1/dagSources/abc":
+						source, _ := json.Marshal(map[string]string{
+							"content": fmt.Sprintf("dag = DAG(\n    dag_id=\"sample_select\",\n    catchup = %s\n)\n", catchup),
+						})
+						respString = string(source)
+					}
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should write the deployed dag back with catchup flipped", func(t *testing.T) {
+			var out bytes.Buffer
+			wc := new(mocked.WriteCloser)
+			defer wc.AssertExpectations(t)
+			wc.On("Write").Return(&out, nil)
+			wc.On("Close").Return(nil)
+
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			ow.On("NewWriter", ctx, "mybucket", "hello/dags/ns-id/sample_select.py").Return(wc, nil)
+
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+
+			client := newClient("True")
+			respond := client.DoFunc
+			dagFetches := 0
+			client.DoFunc = func(req *http.Request) (*http.Response, error) {
+				if req.URL.Path == "/api/v1/dags/sample_select" {
+					dagFetches++
+				}
+				return respond(req)
+			}
+			air := airflow2.NewScheduler(owf, client)
+			err := air.SetCatchup(ctx, projectSpec, "sample_select", false)
+			assert.Nil(t, err)
+			assert.Equal(t, "dag = DAG(\n    dag_id=\"sample_select\",\n    catchup = False\n)\n", out.String())
+			assert.Equal(t, 1, dagFetches)
+		})
+		t.Run("should skip writing when catchup is already as requested", func(t *testing.T) {
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+
+			air := airflow2.NewScheduler(owf, newClient("True"))
+			err := air.SetCatchup(ctx, projectSpec, "sample_select", true)
+			assert.Nil(t, err)
+		})
+	})
+	t.Run("GetTaskLog", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+
+		t.Run("should stream the log without buffering it", func(t *testing.T) {
+			const logSize = 256 << 20
+			log := &generatedLog{remaining: logSize}
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/scheduled__2021-05-20T02:00:00+00:00/taskInstances/bq/logs/2",
+						req.URL.Path)
+					assert.Equal(t, "text/plain", req.Header.Get("Accept"))
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       log,
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			reader, err := air.GetTaskLog(ctx, projectSpec, "sample_select", "scheduled__2021-05-20T02:00:00+00:00", "bq", 2)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(logSize), log.remaining)
+
+			read, err := io.CopyBuffer(ioutil.Discard, reader, make([]byte, 32<<10))
+			assert.Nil(t, err)
+			assert.Nil(t, reader.Close())
+			runtime.ReadMemStats(&after)
+
+			assert.Equal(t, int64(logSize), read)
+			assert.True(t, log.closed)
+			assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(8<<20))
+		})
+		t.Run("should close the body and fail for logs not found", func(t *testing.T) {
+			log := &generatedLog{}
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusNotFound,
+						Body:       log,
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.GetTaskLog(ctx, projectSpec, "sample_select", "manual__1", "bq", 1)
+			assert.True(t, errors.Is(err, airflow2.ErrNotFound))
+			assert.True(t, log.closed)
+		})
+	})
+	t.Run("APIBasePath", func(t *testing.T) {
+		newProjectSpec := func(basePath string) models.ProjectSpec {
+			return models.ProjectSpec{
+				Name: "test-proj",
+				Config: map[string]string{
+					models.ProjectSchedulerHost:        "http://airflow.example.io",
+					models.ProjectSchedulerAPIBasePath: basePath,
+				},
+				Secret: []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSchedulerAuth,
+						Value: "admin:admin",
+					},
+				},
+			}
+		}
+		newClient := func(requests *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					*requests = append(*requests, req.URL.Path)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"version": "2.2.3"}`))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should call the api under the configured base path", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(&requests))
+			_, err := air.GetVersion(ctx, newProjectSpec("/gateway/airflow/api/v2/"))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"/gateway/airflow/api/v2/version"}, requests)
+		})
+		t.Run("should default to the stable api base path", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(&requests))
+			_, err := air.GetVersion(ctx, newProjectSpec(""))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"/api/v1/version"}, requests)
+		})
+	})
+	t.Run("PausedState", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(statusCode int, respString string, requests *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					body, _ := ioutil.ReadAll(req.Body)
+					*requests = append(*requests, fmt.Sprintf("%s %s %s", req.Method, req.URL.RequestURI(), body))
+					return &http.Response{
+						StatusCode: statusCode,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should parse paused flag from dag details", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(http.StatusOK,
+				`{"dag_id": "sample_select", "is_active": true, "is_paused": true, "file_token": "abc"}`, &requests))
+			paused, err := air.IsPaused(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.True(t, paused)
+			assert.Equal(t, []string{"GET /api/v1/dags/sample_select "}, requests)
+
+			air = airflow2.NewScheduler(nil, newClient(http.StatusOK, `{"dag_id": "sample_select", "is_paused": false}`, &requests))
+			paused, err = air.IsPaused(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.False(t, paused)
+		})
+		t.Run("should fail when paused flag is missing", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(http.StatusOK, `{"dag_id": "sample_select"}`, &requests))
+			_, err := air.IsPaused(ctx, projectSpec, "sample_select")
+			assert.NotNil(t, err)
+		})
+		t.Run("should return not found for dags not deployed", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(http.StatusNotFound, `{}`, &requests))
+			_, err := air.IsPaused(ctx, projectSpec, "sample_select")
+			assert.True(t, errors.Is(err, airflow2.ErrNotFound))
+		})
+		t.Run("should re-apply paused state", func(t *testing.T) {
+			var requests []string
+			air := airflow2.NewScheduler(nil, newClient(http.StatusOK, `{"dag_id": "sample_select", "is_paused": true}`, &requests))
+			err := air.SetPaused(ctx, projectSpec, "sample_select", true)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{`PATCH /api/v1/dags/sample_select?update_mask=is_paused {"is_paused":true}`}, requests)
+		})
+	})
+	t.Run("GetRunEvents", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+
+		t.Run("should return events of task instances ordered by time", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v1/dags/sample_select/dagRuns/scheduled__2021-05-20T02:00:00+00:00/taskInstances", req.URL.Path)
+					assert.Equal(t, "0", req.URL.Query().Get("offset"))
+					respString := `{"task_instances": [
+						{"task_id": "bq", "state": "failed", "queued_when": "2021-05-20T02:10:00+00:00",
+							"start_date": "2021-05-20T02:10:05+00:00", "end_date": "2021-05-20T02:30:00+00:00"},
+						{"task_id": "wait_upstream", "state": "success", "queued_when": "2021-05-20T02:00:01+00:00",
+							"start_date": "2021-05-20T02:00:02+00:00", "end_date": "2021-05-20T02:09:59+00:00"},
+						{"task_id": "transporter", "state": null, "queued_when": null, "start_date": null, "end_date": null}
+					], "total_entries": 3}`
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			events, err := air.GetRunEvents(ctx, projectSpec, "sample_select", "scheduled__2021-05-20T02:00:00+00:00")
+			assert.Nil(t, err)
+			assert.Equal(t, []models.RunEvent{
+				{Task: "wait_upstream", State: "queued", At: time.Date(2021, 5, 20, 2, 0, 1, 0, time.UTC)},
+				{Task: "wait_upstream", State: "running", At: time.Date(2021, 5, 20, 2, 0, 2, 0, time.UTC)},
+				{Task: "wait_upstream", State: "success", At: time.Date(2021, 5, 20, 2, 9, 59, 0, time.UTC)},
+				{Task: "bq", State: "queued", At: time.Date(2021, 5, 20, 2, 10, 0, 0, time.UTC)},
+				{Task: "bq", State: "running", At: time.Date(2021, 5, 20, 2, 10, 5, 0, time.UTC)},
+				{Task: "bq", State: "failed", At: time.Date(2021, 5, 20, 2, 30, 0, 0, time.UTC)},
+			}, events)
+		})
+		t.Run("should fail for malformed timestamps", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(bytes.NewReader([]byte(
+							`{"task_instances": [{"task_id": "bq", "start_date": "yesterday"}], "total_entries": 1}`))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.GetRunEvents(ctx, projectSpec, "sample_select", "manual__1")
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("MaxResponseSize", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(log *generatedLog) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       log,
+					}, nil
+				},
+			}
+		}
+
+		t.Run("should fail for responses exceeding the max size", func(t *testing.T) {
+			log := &generatedLog{remaining: 1 << 30}
+			air := airflow2.NewScheduler(nil, newClient(log), airflow2.WithMaxResponseSize(1<<20))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.EqualError(t, err, "failed to fetch airflow dag runs of sample_select: response of airflow "+
+				"http://airflow.example.io/api/v1/dags/sample_select/dagRuns?limit=99999 exceeds max size of 1048576 bytes")
+			assert.Equal(t, int64(1<<30-(1<<20+1)), log.remaining)
+			assert.True(t, log.closed)
+		})
+		t.Run("should read responses within the max size", func(t *testing.T) {
+			respString := `{"dag_runs": [], "total_entries": 0}`
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client, airflow2.WithMaxResponseSize(int64(len(respString))))
+			_, err := air.GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+		})
+	})
+	t.Run("GetJobStatusPage", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		dagRuns := []string{
+			`{"execution_date": "2020-03-25T02:00:00+00:00", "state": "success", "run_type": "scheduled"}`,
+			`{"execution_date": "2020-03-26T02:00:00+00:00", "state": "success", "run_type": "scheduled"}`,
+			`{"execution_date": "2020-03-27T02:00:00+00:00", "state": "failed", "run_type": "scheduled"}`,
+		}
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/api/v1/dags/sample_select/dagRuns", req.URL.Path)
+				assert.Equal(t, "execution_date", req.URL.Query().Get("order_by"))
+				limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+				offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+				end := offset + limit
+				if end > len(dagRuns) {
+					end = len(dagRuns)
+				}
+				respString := fmt.Sprintf(`{"dag_runs": [%s], "total_entries": %d}`,
+					strings.Join(dagRuns[offset:end], ","), len(dagRuns))
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+				}, nil
+			},
+		}
+
+		t.Run("should walk history of the job page by page", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, client)
+			firstPage, cursor, err := air.GetJobStatusPage(ctx, projectSpec, "sample_select", "", 2)
+			assert.Nil(t, err)
+			assert.Len(t, firstPage, 2)
+			assert.Equal(t, time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC), firstPage[0].ScheduledAt)
+			assert.Equal(t, time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC), firstPage[1].ScheduledAt)
+			assert.NotEmpty(t, cursor)
+
+			secondPage, cursor, err := air.GetJobStatusPage(ctx, projectSpec, "sample_select", cursor, 2)
+			assert.Nil(t, err)
+			assert.Len(t, secondPage, 1)
+			assert.Equal(t, time.Date(2020, 3, 27, 2, 0, 0, 0, time.UTC), secondPage[0].ScheduledAt)
+			assert.Equal(t, "failed", secondPage[0].State.String())
+			assert.Empty(t, cursor)
+		})
+		t.Run("should fail for malformed cursors", func(t *testing.T) {
+			air := airflow2.NewScheduler(nil, client)
+			_, _, err := air.GetJobStatusPage(ctx, projectSpec, "sample_select", "not-a-cursor", 2)
+			assert.EqualError(t, err, "invalid cursor not-a-cursor")
+		})
+	})
+	t.Run("GetActiveRunCount", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+
+		t.Run("should count queued and running runs", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v1/dags/sample_select/dagRuns", req.URL.Path)
+					assert.Equal(t, []string{"queued", "running"}, req.URL.Query()["state"])
+					respString := `{"dag_runs": [
+						{"run_id": "scheduled__2020-03-25T02:00:00+00:00", "state": "running"},
+						{"run_id": "scheduled__2020-03-26T02:00:00+00:00", "state": "queued"},
+						{"run_id": "scheduled__2020-03-24T02:00:00+00:00", "state": "success"},
+						{"run_id": "manual__2020-03-26T05:00:00+00:00", "state": "running"}
+					], "total_entries": 4}`
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(respString))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			count, err := air.GetActiveRunCount(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, 3, count)
+		})
+		t.Run("should fail when runs can't be fetched", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusServiceUnavailable,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{}`))),
+					}, nil
+				},
+			}
+			air := airflow2.NewScheduler(nil, client)
+			_, err := air.GetActiveRunCount(ctx, projectSpec, "sample_select")
+			assert.True(t, errors.Is(err, airflow2.ErrTransient))
+		})
+	})
+	t.Run("GetSchedulerConfig", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should return settings of airflow by section", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "http://airflow.example.io/api/v1/config", req.URL.String())
+					assert.Equal(t, http.MethodGet, req.Method)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(strings.NewReader(`{"sections": [
+							{"name": "api", "options": [{"key": "auth_backend", "value": "airflow.api.auth.backend.basic_auth", "source": "airflow.cfg"}]},
+							{"name": "core", "options": [{"key": "dags_folder", "value": "/opt/airflow/dags"}, {"key": "parallelism", "value": "32"}]}
+						]}`)),
+					}, nil
+				},
+			}
+
+			config, err := airflow2.NewScheduler(nil, client).GetSchedulerConfig(ctx, projectSpec)
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]map[string]string{
+				"api": {
+					"auth_backend": "airflow.api.auth.backend.basic_auth",
+				},
+				"core": {
+					"dags_folder": "/opt/airflow/dags",
+					"parallelism": "32",
+				},
+			}, config)
+		})
+		t.Run("should fail with typed error if config is not exposed", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusForbidden,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"title": "Forbidden", "detail": "Your Airflow administrator chose not to expose the configuration"}`)),
+					}, nil
+				},
+			}
+
+			_, err := airflow2.NewScheduler(nil, client).GetSchedulerConfig(ctx, projectSpec)
+			assert.True(t, errors.Is(err, airflow2.ErrConfigNotExposed))
+		})
+	})
+	t.Run("VerifyStorage", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "proj-name",
+			Config: map[string]string{
+				models.ProjectStoragePathKey: "gs://mybucket/hello",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSecretStorageKey,
+					Value: "test-secret",
+				},
+			},
+		}
+		t.Run("should write and delete a probe without uploading the lib", func(t *testing.T) {
+			var out bytes.Buffer
+			wc := new(mocked.WriteCloser)
+			defer wc.AssertExpectations(t)
+			wc.On("Write").Return(&out, nil)
+			wc.On("Close").Return(nil)
+
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			ow.On("NewWriter", ctx, "mybucket", "hello/.optimus_storage_probe").Return(wc, nil)
+			ow.On("Delete", ctx, "mybucket", "hello/.optimus_storage_probe").Return(nil)
+
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+
+			err := airflow2.VerifyStorage(ctx, projectSpec, owf)
+			assert.Nil(t, err)
+			assert.Equal(t, "probe", out.String())
+		})
+		t.Run("should fail for invalid storage configs before connecting", func(t *testing.T) {
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+
+			cases := []struct {
+				name     string
+				config   map[string]string
+				secret   string
+				expected error
+			}{
+				{"missing path", map[string]string{}, "test-secret", airflow2.ErrStorageNotConfigured},
+				{"unsupported scheme", map[string]string{models.ProjectStoragePathKey: "file:///local/dags"}, "test-secret", airflow2.ErrInvalidStoragePath},
+				{"malformed secret", map[string]string{models.ProjectStoragePathKey: "gs://mybucket/hello"}, "{not json", airflow2.ErrInvalidStorageSecret},
+			}
+			for _, tc := range cases {
+				invalidSpec := projectSpec
+				invalidSpec.Config = tc.config
+				invalidSpec.Secret = []models.ProjectSecretItem{
+					{
+						Name:  models.ProjectSecretStorageKey,
+						Value: tc.secret,
+					},
+				}
+				err := airflow2.VerifyStorage(ctx, invalidSpec, owf)
+				assert.True(t, errors.Is(err, tc.expected), "%s: %v", tc.name, err)
+			}
+		})
+		t.Run("should fail if probe can't be written", func(t *testing.T) {
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			ow.On("NewWriter", ctx, "mybucket", "hello/.optimus_storage_probe").Return(new(mocked.WriteCloser), errors.New("permission denied"))
+
+			owf := new(MockedObjectWriterFactory)
+			defer owf.AssertExpectations(t)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+
+			err := airflow2.VerifyStorage(ctx, projectSpec, owf)
+			assert.True(t, errors.Is(err, airflow2.ErrStorageUnreachable))
+		})
+		t.Run("should fail if probe can't be deleted", func(t *testing.T) {
+			var out bytes.Buffer
+			wc := new(mocked.WriteCloser)
+			wc.On("Write").Return(&out, nil)
+			wc.On("Close").Return(nil)
+
+			ow := new(mocked.ObjectWriter)
+			defer ow.AssertExpectations(t)
+			ow.On("NewWriter", ctx, "mybucket", "hello/.optimus_storage_probe").Return(wc, nil)
+			ow.On("Delete", ctx, "mybucket", "hello/.optimus_storage_probe").Return(errors.New("permission denied"))
+
+			owf := new(MockedObjectWriterFactory)
+			owf.On("New", ctx, "gs://mybucket/hello", "test-secret").Return(ow, nil)
+
+			err := airflow2.VerifyStorage(ctx, projectSpec, owf)
+			assert.True(t, errors.Is(err, airflow2.ErrStorageProbeCleanup))
+		})
+	})
+	t.Run("WithCallChain", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		source := "from airflow.models import DAG\n\ndag = DAG(dag_id=\"sample_select\")\n"
+		var detailCalls, sourceCalls int
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				var respString string
+				switch req.URL.Path {
+				case "/api/v1/dags/sample_select":
+					detailCalls++
+					respString = `{"dag_id": "sample_select", "fileloc": "/opt/airflow/dags/sample_select.py", "file_token": "token-1"}`
+				case "/api/v1/dagSources/token-1":
+					sourceCalls++
+					content, _ := json.Marshal(map[string]string{"content": source})
+					respString = string(content)
+				default:
+					return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(strings.NewReader(respString)),
+				}, nil
+			},
+		}
+		air := airflow2.NewScheduler(nil, client)
+
+		t.Run("should fetch file token of the dag once across the chain", func(t *testing.T) {
+			detailCalls, sourceCalls = 0, 0
+			chainCtx := airflow2.WithCallChain(ctx)
+
+			deployed, err := air.GetDagSource(chainCtx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, source, string(deployed))
+			differs, err := air.Diff(chainCtx, projectSpec, "sample_select", deployed)
+			assert.Nil(t, err)
+			assert.False(t, differs)
+
+			assert.Equal(t, 1, detailCalls)
+			assert.Equal(t, 2, sourceCalls)
+		})
+		t.Run("should fetch file token on every call outside a chain", func(t *testing.T) {
+			detailCalls, sourceCalls = 0, 0
+
+			deployed, err := air.GetDagSource(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			_, err = air.Diff(ctx, projectSpec, "sample_select", deployed)
+			assert.Nil(t, err)
+
+			assert.Equal(t, 2, detailCalls)
+		})
+	})
+	t.Run("SetPausedBulk", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should pause dags of jobs found and return errors of missing ones", func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			var paused []string
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					mu.Lock()
+					inFlight++
+					if inFlight > maxInFlight {
+						maxInFlight = inFlight
+					}
+					mu.Unlock()
+					time.Sleep(10 * time.Millisecond)
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+
+					assert.Equal(t, http.MethodPatch, req.Method)
+					assert.Equal(t, "update_mask=is_paused", req.URL.RawQuery)
+					body, _ := ioutil.ReadAll(req.Body)
+					assert.JSONEq(t, `{"is_paused": true}`, string(body))
+					if strings.Contains(req.URL.Path, "missing") {
+						return &http.Response{
+							StatusCode: http.StatusNotFound,
+							Body:       ioutil.NopCloser(strings.NewReader(`{"title": "DAG not found"}`)),
+						}, nil
+					}
+					mu.Lock()
+					paused = append(paused, strings.TrimPrefix(req.URL.Path, "/api/v1/dags/"))
+					mu.Unlock()
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"is_paused": true}`)),
+					}, nil
+				},
+			}
+
+			errs := airflow2.NewScheduler(nil, client).SetPausedBulk(ctx, projectSpec,
+				[]string{"job_a", "missing_b", "job_c", "missing_d"}, true, 2)
+			assert.Len(t, errs, 2)
+			assert.Contains(t, errs[0].Error(), "missing_b")
+			assert.Contains(t, errs[1].Error(), "missing_d")
+			assert.True(t, errors.Is(errs[0], airflow2.ErrNotFound))
+			assert.ElementsMatch(t, []string{"job_a", "job_c"}, paused)
+			assert.LessOrEqual(t, maxInFlight, 2)
+		})
+	})
+	t.Run("DataInterval", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should parse data interval of runs when reported", func(t *testing.T) {
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(strings.NewReader(`{"dag_runs": [
+							{"execution_date": "2020-03-25T02:00:00+00:00", "state": "success",
+								"data_interval_start": "2020-03-25T02:00:00+00:00", "data_interval_end": "2020-03-26T02:00:00+00:00"},
+							{"execution_date": "2020-03-26T02:00:00+00:00", "state": "running",
+								"data_interval_start": null, "data_interval_end": null}
+						], "total_entries": 2}`)),
+					}, nil
+				},
+			}
+
+			status, err := airflow2.NewScheduler(nil, client).GetJobStatus(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Len(t, status, 2)
+			assert.Equal(t, timeRef("2020-03-25T02:00:00+00:00"), status[0].DataIntervalStart)
+			assert.Equal(t, timeRef("2020-03-26T02:00:00+00:00"), status[0].DataIntervalEnd)
+			assert.Nil(t, status[1].DataIntervalStart)
+			assert.Nil(t, status[1].DataIntervalEnd)
+
+			window := &models.JobSpecTaskWindow{Size: 24 * time.Hour, TruncateTo: "d"}
+			status = window.AttachTo(status)
+			assert.Equal(t, time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC), status[0].WindowEnd)
+			assert.Equal(t, time.Date(2020, 3, 26, 0, 0, 0, 0, time.UTC), status[1].WindowEnd)
+		})
+	})
+	t.Run("ClearDates", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		t.Run("should clear each date and report the dates which failed", func(t *testing.T) {
+			var cleared []string
+			client := &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "http://airflow.example.io/api/v1/dags/sample_select/clearTaskInstances", req.URL.String())
+					var clearReq map[string]interface{}
+					assert.Nil(t, json.NewDecoder(req.Body).Decode(&clearReq))
+					assert.Equal(t, clearReq["start_date"], clearReq["end_date"])
+					if clearReq["start_date"] == "2020-03-12T02:00:00+00:00" {
+						return &http.Response{
+							StatusCode: http.StatusInternalServerError,
+							Body:       ioutil.NopCloser(strings.NewReader(`INTERNAL ERROR`)),
+						}, nil
+					}
+					cleared = append(cleared, clearReq["start_date"].(string))
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"task_instances": []}`)),
+					}, nil
+				},
+			}
+
+			err := airflow2.NewScheduler(nil, client).ClearDates(ctx, projectSpec, "sample_select", []time.Time{
+				time.Date(2020, 3, 1, 2, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 12, 2, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC),
+			})
+			assert.Equal(t, []string{"2020-03-01T02:00:00+00:00", "2020-03-25T02:00:00+00:00"}, cleared)
+
+			var clearErr *airflow2.ClearDatesError
+			assert.True(t, errors.As(err, &clearErr))
+			assert.Equal(t, []time.Time{time.Date(2020, 3, 12, 2, 0, 0, 0, time.UTC)}, clearErr.Dates)
+			assert.True(t, errors.Is(clearErr.Errs[0], airflow2.ErrTransient))
+			assert.Contains(t, err.Error(), "failed to clear 1 of the dates: 2020-03-12T02:00:00+00:00")
+		})
+	})
+	t.Run("MethodOverride", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost: "http://airflow.example.io",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+		newClient := func(methods *[]string) *MockHttpClient {
+			return &MockHttpClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					*methods = append(*methods, fmt.Sprintf("%s %s", req.Method, req.Header.Get("X-HTTP-Method-Override")))
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"dag_id": "sample_select", "is_paused": true}`)),
+					}, nil
+				},
+			}
+		}
+		t.Run("should send PATCH as POST with the override header when enabled", func(t *testing.T) {
+			var methods []string
+			air := airflow2.NewScheduler(nil, newClient(&methods), airflow2.WithMethodOverride())
+			assert.Nil(t, air.SetPaused(ctx, projectSpec, "sample_select", true))
+			_, err := air.IsPaused(ctx, projectSpec, "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"POST PATCH", "GET "}, methods)
+		})
+		t.Run("should send PATCH as is by default", func(t *testing.T) {
+			var methods []string
+			air := airflow2.NewScheduler(nil, newClient(&methods))
+			assert.Nil(t, air.SetPaused(ctx, projectSpec, "sample_select", true))
+			assert.Equal(t, []string{"PATCH "}, methods)
+		})
+	})
 }
@@ -191,5 +191,164 @@ func TestCompiler(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Equal(t, string(CompiledTemplate), string(job.Contents))
 		})
+		t.Run("should render dag args for start modes", func(t *testing.T) {
+			startDate := `"start_date": datetime.strptime("2000-11-11T00:00:00", "%Y-%m-%dT%H:%M:%S"),`
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			com.Now = func() time.Time {
+				return time.Date(2021, 3, 4, 15, 30, 0, 0, time.UTC)
+			}
+
+			fromNowSpec := spec
+			fromNowSpec.Behavior.StartMode = models.JobStartFromNow
+			job, err := com.Compile(namespaceSpec, fromNowSpec)
+			assert.Nil(t, err)
+			assert.Contains(t, string(job.Contents), `"start_date": datetime.strptime("2021-03-04T00:00:00", "%Y-%m-%dT%H:%M:%S"),`)
+			assert.Contains(t, string(job.Contents), "catchup = False")
+
+			fromNowSpec.Schedule.StartDate = time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+			job, err = com.Compile(namespaceSpec, fromNowSpec)
+			assert.Nil(t, err)
+			assert.Contains(t, string(job.Contents), `"start_date": datetime.strptime("2021-05-01T00:00:00", "%Y-%m-%dT%H:%M:%S"),`)
+
+			fromStartDateSpec := spec
+			fromStartDateSpec.Behavior.CatchUp = false
+			fromStartDateSpec.Behavior.StartMode = models.JobStartFromStartDate
+			job, err = com.Compile(namespaceSpec, fromStartDateSpec)
+			assert.Nil(t, err)
+			assert.Contains(t, string(job.Contents), startDate)
+			assert.Contains(t, string(job.Contents), "catchup = True")
+		})
+		t.Run("should use start mode of project for jobs without one", func(t *testing.T) {
+			projectNamespaceSpec := namespaceSpec
+			projectNamespaceSpec.ProjectSpec.Config = map[string]string{
+				models.ProjectJobStartModeKey: string(models.JobStartFromNow),
+			}
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			noCatchUpSpec := spec
+			noCatchUpSpec.Behavior.CatchUp = false
+			job, err := com.Compile(projectNamespaceSpec, noCatchUpSpec)
+			assert.Nil(t, err)
+			assert.Contains(t, string(job.Contents), "catchup = False")
+		})
+		t.Run("should prefer catch up of the job over start mode of project", func(t *testing.T) {
+			projectNamespaceSpec := namespaceSpec
+			projectNamespaceSpec.ProjectSpec.Config = map[string]string{
+				models.ProjectJobStartModeKey: string(models.JobStartFromNow),
+			}
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			job, err := com.Compile(projectNamespaceSpec, spec)
+			assert.Nil(t, err)
+			assert.Contains(t, string(job.Contents), "catchup = True")
+			assert.Contains(t, string(job.Contents), `"start_date": datetime.strptime("2000-11-11T00:00:00", "%Y-%m-%dT%H:%M:%S"),`)
+		})
+		t.Run("should fail for an unknown start mode", func(t *testing.T) {
+			badSpec := spec
+			badSpec.Behavior.StartMode = "yesterday"
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			_, err := com.Compile(namespaceSpec, badSpec)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("ValidateDag", func(t *testing.T) {
+		t.Run("should pass for a valid compiled dag", func(t *testing.T) {
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			job, err := com.Compile(namespaceSpec, spec)
+			assert.Nil(t, err)
+			assert.Nil(t, ValidateDag(job.Contents))
+		})
+		t.Run("should fail for unbalanced brackets caused by a bad template value", func(t *testing.T) {
+			badHookUnit := new(mock.BasePlugin)
+			badHookUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+				Name:     "bad-hook",
+				HookType: models.HookTypePost,
+				Image:    "example.io/namespace/bad-image:latest\"}",
+			}, nil)
+			badSpec := spec
+			badSpec.Hooks = []models.JobSpecHook{
+				{
+					Config: []models.JobSpecConfigItem{},
+					Unit:   &models.Plugin{Base: badHookUnit},
+				},
+			}
+
+			com := job.NewCompiler(NewScheduler(nil, nil).GetTemplate(), "http://airflow.example.io")
+			job, err := com.Compile(namespaceSpec, badSpec)
+			assert.Nil(t, err)
+			err = ValidateDag(job.Contents)
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "closing '}' does not match '('")
+		})
+		t.Run("should fail for an unterminated string", func(t *testing.T) {
+			err := ValidateDag([]byte("dag = DAG(\n    dag_id=\"foo,\n)\n"))
+			assert.EqualError(t, err, "invalid dag: line 2: unterminated string")
+		})
+		t.Run("should fail if dag definition is missing", func(t *testing.T) {
+			err := ValidateDag([]byte("default_args = {}\n"))
+			assert.NotNil(t, err)
+		})
+		t.Run("should ignore brackets in strings and comments", func(t *testing.T) {
+			err := ValidateDag([]byte("# closing ) in comment\ndag = DAG(\n    doc=\"\"\"multi (\nline\"\"\",\n    name='a]b'\n)\n"))
+			assert.Nil(t, err)
+		})
+	})
+}
+
+func BenchmarkCompiler(b *testing.B) {
+	execUnit := new(mock.BasePlugin)
+	execUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+		Name:  "bq",
+		Image: "example.io/namespace/image:latest",
+	}, nil)
+	namespaceSpec := models.NamespaceSpec{
+		Name: "bar-namespace",
+		ProjectSpec: models.ProjectSpec{
+			Name: "foo-project",
+		},
+	}
+	spec := models.JobSpec{
+		Name:  "foo",
+		Owner: "mee@mee",
+		Schedule: models.JobSpecSchedule{
+			StartDate: time.Date(2000, 11, 11, 0, 0, 0, 0, time.UTC),
+			Interval:  "* * * * *",
+		},
+		Task: models.JobSpecTask{
+			Unit:     &models.Plugin{Base: execUnit},
+			Priority: 2000,
+			Window: models.JobSpecTaskWindow{
+				Size:       time.Hour,
+				TruncateTo: "d",
+			},
+		},
+		Dependencies: map[string]models.JobSpecDependency{},
+	}
+
+	b.Run("base dag parsed per compile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			com := job.NewCompiler(resBaseDAG, "http://airflow.example.io")
+			if _, err := com.Compile(namespaceSpec, spec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("base dag parsed once", func(b *testing.B) {
+		com := job.NewCompiler(resBaseDAG, "http://airflow.example.io")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := com.Compile(namespaceSpec, spec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("base dag parsed once compiled in parallel", func(b *testing.B) {
+		com := job.NewCompiler(resBaseDAG, "http://airflow.example.io")
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := com.Compile(namespaceSpec, spec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	})
 }
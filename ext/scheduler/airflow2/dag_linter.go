@@ -0,0 +1,120 @@
+package airflow2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
+)
+
+// DagLintProblem is a problem an external linter reported for a dag
+type DagLintProblem struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// DagLintError is returned for dags an external linter reported problems for
+type DagLintError struct {
+	JobName  string
+	Problems []DagLintProblem
+}
+
+func (e *DagLintError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		problems = append(problems, fmt.Sprintf("line %d: %s", problem.Line, problem.Message))
+	}
+	return fmt.Sprintf("dag of job %s failed linting: %s", e.JobName, strings.Join(problems, "; "))
+}
+
+// LintDag posts the rendered dag to the external linter configured for the
+// project with models.ProjectSchedulerDagLinterURL, for checks airflow only
+// does once it parses a deployed dag. The linter is sent the dag as
+// {"dag_id": ..., "content": ...} and responds with the problems it found as
+// {"errors": [{"line": ..., "message": ...}]}, which are returned as a
+// DagLintError. Dags of projects without a linter pass
+func LintDag(ctx context.Context, httpClient HttpClient, projSpec models.ProjectSpec, job models.Job) error {
+	linterURL := projSpec.Config[models.ProjectSchedulerDagLinterURL]
+	if linterURL == "" {
+		return nil
+	}
+	payload, err := json.Marshal(map[string]string{
+		"dag_id":  job.Name,
+		"content": string(job.Contents),
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, linterURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return errors.Wrapf(err, "failed to build http request for %s", linterURL)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call dag linter %s", linterURL)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, defaultMaxResponseSize))
+	if err != nil {
+		return errors.Wrap(err, "failed to read dag linter response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to call dag linter %s: %d", linterURL, resp.StatusCode)
+	}
+
+	var lintResp struct {
+		Errors []DagLintProblem `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &lintResp); err != nil {
+		return errors.Wrapf(err, "json error: %s", string(body))
+	}
+	if len(lintResp.Errors) > 0 {
+		return &DagLintError{
+			JobName:  job.Name,
+			Problems: lintResp.Errors,
+		}
+	}
+	return nil
+}
+
+// lintingCompiler lints dags right after they are compiled, failing the
+// deploy of dags the linter reports problems for
+type lintingCompiler struct {
+	compiler   models.JobCompiler
+	httpClient HttpClient
+	timeout    time.Duration
+}
+
+// NewLintingCompiler wraps the compiler to lint compiled dags with LintDag,
+// failing compiles the linter doesn't respond to within timeout
+func NewLintingCompiler(compiler models.JobCompiler, httpClient HttpClient, timeout time.Duration) models.JobCompiler {
+	return &lintingCompiler{
+		compiler:   compiler,
+		httpClient: httpClient,
+		timeout:    timeout,
+	}
+}
+
+func (c *lintingCompiler) Compile(namespaceSpec models.NamespaceSpec, jobSpec models.JobSpec) (models.Job, error) {
+	job, err := c.compiler.Compile(namespaceSpec, jobSpec)
+	if err != nil {
+		return models.Job{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := LintDag(ctx, c.httpClient, namespaceSpec.ProjectSpec, job); err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
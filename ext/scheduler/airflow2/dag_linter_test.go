@@ -0,0 +1,120 @@
+package airflow2_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odpf/optimus/ext/scheduler/airflow2"
+	mocked "github.com/odpf/optimus/mock"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintingCompiler(t *testing.T) {
+	namespaceSpec := models.NamespaceSpec{
+		Name: "bar-namespace",
+		ProjectSpec: models.ProjectSpec{
+			Name: "foo-project",
+			Config: map[string]string{
+				models.ProjectSchedulerDagLinterURL: "http://linter.example.io/lint",
+			},
+		},
+	}
+	jobSpec := models.JobSpec{
+		Name: "foo",
+	}
+	compiledJob := models.Job{
+		Name:     "foo",
+		Contents: []byte("dag = DAG(\n    dag_id=\"foo\",\n)\n"),
+	}
+	linterFor := func(response string) *MockHttpClient {
+		return &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "http://linter.example.io/lint", req.URL.String())
+				var lintReq map[string]string
+				assert.Nil(t, json.NewDecoder(req.Body).Decode(&lintReq))
+				assert.Equal(t, "foo", lintReq["dag_id"])
+				assert.Equal(t, string(compiledJob.Contents), lintReq["content"])
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(strings.NewReader(response)),
+				}, nil
+			},
+		}
+	}
+
+	t.Run("should fail compile for dags the linter reports problems for", func(t *testing.T) {
+		compiler := new(mocked.Compiler)
+		defer compiler.AssertExpectations(t)
+		compiler.On("Compile", namespaceSpec, jobSpec).Return(compiledJob, nil)
+
+		linter := linterFor(`{"errors": [
+			{"line": 2, "message": "dag_id doesn't match file name"},
+			{"line": 3, "message": "missing schedule_interval"}
+		]}`)
+		_, err := airflow2.NewLintingCompiler(compiler, linter, time.Minute).Compile(namespaceSpec, jobSpec)
+		assert.EqualError(t, err, "dag of job foo failed linting: line 2: dag_id doesn't match file name; line 3: missing schedule_interval")
+
+		var lintErr *airflow2.DagLintError
+		assert.True(t, errors.As(err, &lintErr))
+		assert.Len(t, lintErr.Problems, 2)
+	})
+	t.Run("should return compiled dag if the linter reports no problems", func(t *testing.T) {
+		compiler := new(mocked.Compiler)
+		defer compiler.AssertExpectations(t)
+		compiler.On("Compile", namespaceSpec, jobSpec).Return(compiledJob, nil)
+
+		job, err := airflow2.NewLintingCompiler(compiler, linterFor(`{"errors": []}`), time.Minute).Compile(namespaceSpec, jobSpec)
+		assert.Nil(t, err)
+		assert.Equal(t, compiledJob, job)
+	})
+	t.Run("should skip linting for projects without a linter", func(t *testing.T) {
+		plainNamespaceSpec := namespaceSpec
+		plainNamespaceSpec.ProjectSpec.Config = map[string]string{}
+		compiler := new(mocked.Compiler)
+		defer compiler.AssertExpectations(t)
+		compiler.On("Compile", plainNamespaceSpec, jobSpec).Return(compiledJob, nil)
+
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				t.Fatal("linter shouldn't be called")
+				return nil, nil
+			},
+		}
+		_, err := airflow2.NewLintingCompiler(compiler, client, time.Minute).Compile(plainNamespaceSpec, jobSpec)
+		assert.Nil(t, err)
+	})
+	t.Run("should fail compile if the linter doesn't respond in time", func(t *testing.T) {
+		compiler := new(mocked.Compiler)
+		defer compiler.AssertExpectations(t)
+		compiler.On("Compile", namespaceSpec, jobSpec).Return(compiledJob, nil)
+
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			},
+		}
+		_, err := airflow2.NewLintingCompiler(compiler, client, 10*time.Millisecond).Compile(namespaceSpec, jobSpec)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+	t.Run("should fail if the linter can't be called", func(t *testing.T) {
+		client := &MockHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}, nil
+			},
+		}
+		err := airflow2.LintDag(context.Background(), client, namespaceSpec.ProjectSpec, compiledJob)
+		assert.EqualError(t, err, "failed to call dag linter http://linter.example.io/lint: 502")
+	})
+}
@@ -0,0 +1,109 @@
+package airflow2
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// requiredDagMarkers must be present in every rendered dag for airflow
+	// to pick it up
+	requiredDagMarkers = []string{
+		"dag = DAG(",
+	}
+
+	closingBrackets = map[byte]byte{
+		')': '(',
+		']': '[',
+		'}': '{',
+	}
+)
+
+type openBracket struct {
+	char byte
+	line int
+}
+
+// ValidateDag does a best effort check of rendered dag contents for syntax
+// errors a bad template value can introduce, like unbalanced brackets or
+// unterminated strings, without a full python parser
+func ValidateDag(contents []byte) error {
+	for _, marker := range requiredDagMarkers {
+		if !bytes.Contains(contents, []byte(marker)) {
+			return errors.Errorf("invalid dag: missing required %q", marker)
+		}
+	}
+
+	var stack []openBracket
+	line := 1
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+		switch c {
+		case '\n':
+			line++
+		case '#':
+			// skip comment till end of line
+			for i+1 < len(contents) && contents[i+1] != '\n' {
+				i++
+			}
+		case '"', '\'':
+			end, lines, err := skipPythonString(contents, i)
+			if err != nil {
+				return errors.Wrapf(err, "invalid dag: line %d", line)
+			}
+			i = end
+			line += lines
+		case '(', '[', '{':
+			stack = append(stack, openBracket{char: c, line: line})
+		case ')', ']', '}':
+			if len(stack) == 0 {
+				return errors.Errorf("invalid dag: line %d: unexpected closing %q", line, c)
+			}
+			top := stack[len(stack)-1]
+			if top.char != closingBrackets[c] {
+				return errors.Errorf("invalid dag: line %d: closing %q does not match %q opened at line %d",
+					line, c, top.char, top.line)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return errors.Errorf("invalid dag: %q opened at line %d is never closed", top.char, top.line)
+	}
+	return nil
+}
+
+// skipPythonString returns the index of the quote closing the string
+// starting at start along with the number of new lines it spans
+func skipPythonString(contents []byte, start int) (int, int, error) {
+	quote := contents[start]
+	delimiter := string(quote)
+	if bytes.HasPrefix(contents[start:], []byte(strings.Repeat(delimiter, 3))) {
+		delimiter = strings.Repeat(delimiter, 3)
+	}
+	multiline := len(delimiter) == 3
+
+	lines := 0
+	for i := start + len(delimiter); i < len(contents); i++ {
+		switch contents[i] {
+		case '\\':
+			if i+1 < len(contents) && contents[i+1] == '\n' {
+				lines++
+			}
+			i++
+		case '\n':
+			if !multiline {
+				return 0, 0, errors.New("unterminated string")
+			}
+			lines++
+		case quote:
+			if bytes.HasPrefix(contents[i:], []byte(delimiter)) {
+				return i + len(delimiter) - 1, lines, nil
+			}
+		}
+	}
+	return 0, 0, errors.Errorf("unterminated string %s", delimiter)
+}
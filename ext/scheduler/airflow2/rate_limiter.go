@@ -0,0 +1,85 @@
+package airflow2
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows bursts of up to burst operations, refilling tokens at
+// rate per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks till a token is available or the context is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// projectRateLimiter keeps a separate token bucket per project so a mass
+// clear in one project doesn't starve others
+type projectRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+func newProjectRateLimiter(rate float64, burst int) *projectRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &projectRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Wait blocks till the project is allowed another operation or the
+// context is done
+func (l *projectRateLimiter) Wait(ctx context.Context, project string) error {
+	l.mu.Lock()
+	bucket, ok := l.buckets[project]
+	if !ok {
+		bucket = newTokenBucket(l.rate, l.burst)
+		l.buckets[project] = bucket
+	}
+	l.mu.Unlock()
+	return bucket.Wait(ctx)
+}
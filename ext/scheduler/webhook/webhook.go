@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/odpf/optimus/ext/scheduler/airflow2"
+	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
+
+	_ "embed"
+)
+
+//go:embed resources/job.json
+var resBaseJob []byte
+
+const (
+	bootstrapURL = "bootstrap"
+	jobStatusURL = "jobs/%s/status"
+	jobClearURL  = "jobs/%s/clear"
+	dateFormat   = time.RFC3339
+)
+
+// scheduler pushes optimus operations to a generic orchestrator listening
+// for json payloads at the project's SCHEDULER_HOST, for teams that are not
+// running airflow
+type scheduler struct {
+	httpClient airflow2.HttpClient
+}
+
+func NewScheduler(httpClient airflow2.HttpClient) *scheduler {
+	return &scheduler{
+		httpClient: httpClient,
+	}
+}
+
+func (s *scheduler) GetName() string {
+	return "webhook"
+}
+
+func (s *scheduler) GetJobsDir() string {
+	return "jobs"
+}
+
+func (s *scheduler) GetJobsExtension() string {
+	return ".json"
+}
+
+func (s *scheduler) GetTemplate() []byte {
+	return resBaseJob
+}
+
+func (s *scheduler) Bootstrap(ctx context.Context, proj models.ProjectSpec) error {
+	payload, err := json.Marshal(map[string]string{
+		"project":      proj.Name,
+		"storage_path": proj.Config[models.ProjectStoragePathKey],
+		"jobs_dir":     s.GetJobsDir(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.call(ctx, proj, http.MethodPost, bootstrapURL, payload)
+	return err
+}
+
+func (s *scheduler) GetJobStatus(ctx context.Context, projSpec models.ProjectSpec, jobName string) ([]models.JobStatus, error) {
+	body, err := s.call(ctx, projSpec, http.MethodGet, fmt.Sprintf(jobStatusURL, jobName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	//{
+	//	"runs": [
+	//		{
+	//			"scheduled_at": "2020-03-25T02:00:00+00:00",
+	//			"state": "success"
+	//		}
+	//	]
+	//}
+	var responseJson struct {
+		Runs []struct {
+			ScheduledAt string `json:"scheduled_at"`
+			State       string `json:"state"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(body, &responseJson); err != nil {
+		return nil, errors.Wrapf(err, "json error: %s", string(body))
+	}
+
+	var jobStatus []models.JobStatus
+	for _, run := range responseJson.Runs {
+		scheduledAt, err := time.Parse(dateFormat, run.ScheduledAt)
+		if err != nil {
+			return nil, errors.Errorf("error parsing date for %s, %s", jobName, run.ScheduledAt)
+		}
+		jobStatus = append(jobStatus, models.JobStatus{
+			ScheduledAt: scheduledAt.UTC(),
+			State:       models.JobStatusState(run.State),
+		})
+	}
+	return jobStatus, nil
+}
+
+func (s *scheduler) Clear(ctx context.Context, projSpec models.ProjectSpec, jobName string, startDate, endDate time.Time) error {
+	payload, err := json.Marshal(map[string]string{
+		"start_date": startDate.UTC().Format(dateFormat),
+		"end_date":   endDate.UTC().Format(dateFormat),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.call(ctx, projSpec, http.MethodPost, fmt.Sprintf(jobClearURL, jobName), payload)
+	return err
+}
+
+func (s *scheduler) GetDagRunStatus(ctx context.Context, projSpec models.ProjectSpec, jobName string, startDate time.Time,
+	endDate time.Time, batchSize int) ([]models.JobStatus, error) {
+	allStatus, err := s.GetJobStatus(ctx, projSpec, jobName)
+	if err != nil {
+		return nil, err
+	}
+	var jobStatus []models.JobStatus
+	for _, status := range allStatus {
+		if status.ScheduledAt.Before(startDate) || status.ScheduledAt.After(endDate) {
+			continue
+		}
+		jobStatus = append(jobStatus, status)
+	}
+	return jobStatus, nil
+}
+
+// call sends payload to the webhook path relative to the project scheduler
+// host and returns the response body
+func (s *scheduler) call(ctx context.Context, projSpec models.ProjectSpec, method, path string, payload []byte) ([]byte, error) {
+	schdHost, ok := projSpec.Config[models.ProjectSchedulerHost]
+	if !ok {
+		return nil, errors.Errorf("scheduler host not set for %s", projSpec.Name)
+	}
+	callURL := fmt.Sprintf("%s/%s", strings.Trim(schdHost, "/"), path)
+
+	request, err := http.NewRequestWithContext(ctx, method, callURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build http request for %s", callURL)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if authToken, ok := projSpec.Secret.GetByName(models.ProjectSchedulerAuth); ok {
+		request.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(authToken))))
+	}
+
+	resp, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to call webhook %s", callURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, errors.Errorf("failed to call webhook %s: %d", callURL, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read webhook response")
+	}
+	return body, nil
+}
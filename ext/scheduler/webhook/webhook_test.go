@@ -0,0 +1,130 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/odpf/optimus/ext/scheduler/webhook"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	projectSpecFor := func(host string) models.ProjectSpec {
+		return models.ProjectSpec{
+			Name: "test-proj",
+			Config: map[string]string{
+				models.ProjectSchedulerHost:  host,
+				models.ProjectStoragePathKey: "gs://mybucket/hello",
+			},
+			Secret: []models.ProjectSecretItem{
+				{
+					Name:  models.ProjectSchedulerAuth,
+					Value: "admin:admin",
+				},
+			},
+		}
+	}
+
+	t.Run("GetName", func(t *testing.T) {
+		assert.Equal(t, "webhook", webhook.NewScheduler(nil).GetName())
+	})
+	t.Run("Bootstrap", func(t *testing.T) {
+		t.Run("should post project details to bootstrap hook", func(t *testing.T) {
+			var received map[string]string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/bootstrap", r.URL.Path)
+				assert.Equal(t, http.MethodPost, r.Method)
+				user, pass, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "admin", user)
+				assert.Equal(t, "admin", pass)
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Nil(t, json.Unmarshal(body, &received))
+			}))
+			defer srv.Close()
+
+			err := webhook.NewScheduler(srv.Client()).Bootstrap(ctx, projectSpecFor(srv.URL))
+			assert.Nil(t, err)
+			assert.Equal(t, "test-proj", received["project"])
+			assert.Equal(t, "gs://mybucket/hello", received["storage_path"])
+		})
+		t.Run("should fail if scheduler host is not set", func(t *testing.T) {
+			err := webhook.NewScheduler(nil).Bootstrap(ctx, models.ProjectSpec{
+				Name:   "test-proj",
+				Config: map[string]string{},
+			})
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("GetJobStatus", func(t *testing.T) {
+		t.Run("should return job status from hook response", func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/jobs/sample_select/status", r.URL.Path)
+				assert.Equal(t, http.MethodGet, r.Method)
+				w.Write([]byte(`{"runs": [
+					{"scheduled_at": "2020-03-25T02:00:00+00:00", "state": "success"},
+					{"scheduled_at": "2020-03-26T02:00:00+00:00", "state": "failed"}
+				]}`))
+			}))
+			defer srv.Close()
+
+			status, err := webhook.NewScheduler(srv.Client()).GetJobStatus(ctx, projectSpecFor(srv.URL), "sample_select")
+			assert.Nil(t, err)
+			assert.Equal(t, []models.JobStatus{
+				{
+					ScheduledAt: time.Date(2020, 3, 25, 2, 0, 0, 0, time.UTC),
+					State:       models.JobStatusStateSuccess,
+				},
+				{
+					ScheduledAt: time.Date(2020, 3, 26, 2, 0, 0, 0, time.UTC),
+					State:       models.JobStatusStateFailed,
+				},
+			}, status)
+		})
+		t.Run("should fail if hook fails to return OK", func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer srv.Close()
+
+			status, err := webhook.NewScheduler(srv.Client()).GetJobStatus(ctx, projectSpecFor(srv.URL), "sample_select")
+			assert.NotNil(t, err)
+			assert.Len(t, status, 0)
+		})
+	})
+	t.Run("Clear", func(t *testing.T) {
+		t.Run("should post clear range to hook", func(t *testing.T) {
+			var received map[string]string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/jobs/sample_select/clear", r.URL.Path)
+				assert.Equal(t, http.MethodPost, r.Method)
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Nil(t, json.Unmarshal(body, &received))
+			}))
+			defer srv.Close()
+
+			startDate := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+			endDate := time.Date(2021, 5, 25, 0, 0, 0, 0, time.UTC)
+			err := webhook.NewScheduler(srv.Client()).Clear(ctx, projectSpecFor(srv.URL), "sample_select", startDate, endDate)
+			assert.Nil(t, err)
+			assert.Equal(t, "2021-05-20T00:00:00Z", received["start_date"])
+			assert.Equal(t, "2021-05-25T00:00:00Z", received["end_date"])
+		})
+		t.Run("should fail if hook fails to return OK", func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+			defer srv.Close()
+
+			err := webhook.NewScheduler(srv.Client()).Clear(ctx, projectSpecFor(srv.URL), "sample_select", time.Now(), time.Now())
+			assert.NotNil(t, err)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package instance
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AssetValidator checks a rendered asset is valid for its declared type
+type AssetValidator func(content string) error
+
+// DefaultAssetValidators are lightweight checks of rendered assets keyed by
+// file extension, these catch templates rendering to obviously broken
+// output and are no substitute for a parser
+func DefaultAssetValidators() map[string]AssetValidator {
+	return map[string]AssetValidator{
+		".json": ValidateJSONAsset,
+		".sql":  ValidateSQLAsset,
+	}
+}
+
+// ValidateJSONAsset checks the asset is a valid json document
+func ValidateJSONAsset(content string) error {
+	if !json.Valid([]byte(content)) {
+		return errors.New("invalid json")
+	}
+	return nil
+}
+
+// ValidateSQLAsset checks parentheses of the asset are balanced, ignoring
+// those in quoted strings, identifiers and comments. Characters escaped
+// with a backslash don't end a quote
+func ValidateSQLAsset(content string) error {
+	depth := 0
+scan:
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for ; end < len(content) && content[end] != c; end++ {
+				if content[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(content) {
+				return errors.Errorf("unterminated quote %c", c)
+			}
+			i = end
+		case strings.HasPrefix(content[i:], "--"):
+			end := strings.IndexByte(content[i:], '\n')
+			if end == -1 {
+				break scan
+			}
+			i += end
+		case strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end == -1 {
+				return errors.New("unterminated comment")
+			}
+			i += end + 3
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return errors.New("unbalanced parentheses, unexpected )")
+			}
+			depth--
+		}
+	}
+	if depth > 0 {
+		return errors.Errorf("unbalanced parentheses, %d left open", depth)
+	}
+	return nil
+}
+
+// validateAssets runs the validator registered for the extension of each
+// asset, assets of other extensions are not checked
+func validateAssets(fileMap map[string]string, validators map[string]AssetValidator) error {
+	for name, content := range fileMap {
+		validate, ok := validators[strings.ToLower(filepath.Ext(name))]
+		if !ok {
+			continue
+		}
+		if err := validate(content); err != nil {
+			return errors.Wrapf(err, "asset %s is not valid after rendering", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package instance_test
+
+import (
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSQLAsset(t *testing.T) {
+	t.Run("should accept balanced parentheses ignoring quotes and comments", func(t *testing.T) {
+		err := instance.ValidateSQLAsset(`
+-- count (per day
+select count(*), ')' as a, "col(" from (select 1) /* ) */ t`)
+		assert.Nil(t, err)
+	})
+	t.Run("should fail for unbalanced parentheses", func(t *testing.T) {
+		assert.EqualError(t, instance.ValidateSQLAsset("select count(* from (select 1)"),
+			"unbalanced parentheses, 1 left open")
+		assert.EqualError(t, instance.ValidateSQLAsset("select 1)"),
+			"unbalanced parentheses, unexpected )")
+	})
+	t.Run("should fail for unterminated quotes", func(t *testing.T) {
+		assert.NotNil(t, instance.ValidateSQLAsset("select 'a from t"))
+	})
+	t.Run("should skip quotes escaped with a backslash", func(t *testing.T) {
+		assert.Nil(t, instance.ValidateSQLAsset(`select 'it\'s (' as a, "\"(" as b`))
+		assert.NotNil(t, instance.ValidateSQLAsset(`select 'a\'`))
+	})
+	t.Run("should check parentheses before a trailing line comment", func(t *testing.T) {
+		assert.EqualError(t, instance.ValidateSQLAsset("select count(* -- no newline"),
+			"unbalanced parentheses, 1 left open")
+		assert.Nil(t, instance.ValidateSQLAsset("select count(*) -- no newline"))
+	})
+}
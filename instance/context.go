@@ -3,9 +3,17 @@ package instance
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/odpf/optimus/core/cron"
 	"github.com/odpf/optimus/models"
+	"github.com/odpf/optimus/store"
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +25,21 @@ const (
 	// ProjectConfigPrefix will be used to prefix all the config variables of
 	// a project, i.e. registered entities
 	ProjectConfigPrefix = "GLOBAL__"
+
+	// ConfConfigPrefix will be used to prefix all the run conf variables passed
+	// while triggering an instance
+	ConfConfigPrefix = "CONF__"
+
+	// HookOutputPrefix will be used to prefix the values published by hooks,
+	// available to hooks running after them as HOOK__<hook name>__<key>
+	HookOutputPrefix = "HOOK__"
+
+	// hookOutputSeparator separates hook name and key of a published value
+	hookOutputSeparator = "__"
+
+	// DeploymentSeparator separates key of a config from the deployment it
+	// is overridden for, e.g. region@prod overrides region in prod
+	DeploymentSeparator = "@"
 )
 
 var (
@@ -37,6 +60,446 @@ type ContextManager struct {
 	namespace models.NamespaceSpec
 	jobSpec   models.JobSpec
 	engine    models.TemplateEngine
+
+	// deprecated variables mapped to the variables replacing them
+	deprecatedVariables map[string]string
+
+	// options and warnings of the Generate call in progress
+	options  generateOptions
+	warnings []Warning
+
+	metrics models.MetricsRecorder
+
+	// reads snippets of shared library included in templates, if set
+	libReader store.ObjectReader
+
+	// set when the job has no window of its own and uses the default
+	// window of the project
+	usesProjectWindow bool
+
+	// layers of global configs below the project and above the namespace
+	orgConfig       map[string]string
+	jobGlobalConfig map[string]string
+
+	// resolves SECRET__ variables referenced in templates, defaults to the
+	// secrets of the project
+	secretProvider models.SecretProvider
+
+	// selects overrides of configs keyed with DeploymentSeparator, none
+	// are used if empty
+	deployment string
+
+	// resolves outputs of upstream jobs referenced with the upstream
+	// template function, if set
+	upstreamLookup UpstreamLookup
+}
+
+const (
+	metricGenerateTotal    = "instance_generate_total"
+	metricGenerateErrors   = "instance_generate_errors_total"
+	metricGenerateDuration = "instance_generate_duration"
+)
+
+// Warning is a non fatal issue noticed while generating context of an instance
+type Warning string
+
+// GenerateOption tunes the behaviour of a single Generate call
+type GenerateOption func(*generateOptions)
+
+type generateOptions struct {
+	missingKey          MissingKeyPolicy
+	normalizeLineEnding bool
+	posixEnvKeys        bool
+	rejectEmptyAssets   bool
+	shellEscapeEnvs     bool
+
+	// validators of rendered assets by extension, nil if not validated
+	assetValidators map[string]AssetValidator
+
+	// variables added to the template context with lowest precedence
+	extraVariables map[string]string
+
+	// generation is aborted once ctx is done or the timeout elapses
+	ctx           context.Context
+	renderTimeout time.Duration
+
+	// scheduled time generation is previewed for, zero if not overridden
+	referenceTime time.Time
+
+	// collects values of secrets resolved during generation if set
+	resolvedSecrets *[]string
+
+	// limits names of generated envs, nil if not validated
+	envNameRules *EnvNameRules
+
+	// prepended to keys of generated envs, empty if not prefixed
+	envKeyPrefix string
+
+	// trims whitespace around values of variables rendered in templates
+	trimValues bool
+
+	// bytes rendered assets are limited to, no limit if zero
+	maxAssetSize int
+
+	// adds MetaFileName describing generated envs to the files
+	metaFile bool
+
+	// layout times of generated variables like DSTART are rendered with
+	timeLayout string
+}
+
+// DefaultReservedEnvNames are envs of shells and runtimes which generated
+// envs shouldn't override
+var DefaultReservedEnvNames = []string{
+	"PATH", "HOME", "SHELL", "USER", "PWD", "HOSTNAME", "LANG", "TERM", "IFS", "LD_LIBRARY_PATH", "LD_PRELOAD",
+}
+
+// EnvNameRules limits names of generated envs, see WithEnvNameRules
+type EnvNameRules struct {
+	// MaxLength of env names, no limit if zero
+	MaxLength int
+
+	// Reserved names generated envs must not use, e.g. DefaultReservedEnvNames
+	Reserved []string
+
+	// Strict fails generation on violations instead of warning
+	Strict bool
+}
+
+// WithMissingKey sets how templates referencing variables missing from the
+// context are handled, defaults to MissingKeyError
+func WithMissingKey(policy MissingKeyPolicy) GenerateOption {
+	return func(o *generateOptions) {
+		o.missingKey = policy
+	}
+}
+
+// WithLFLineEndings converts CRLF line endings of rendered asset files to LF,
+// useful for assets authored on windows
+func WithLFLineEndings() GenerateOption {
+	return func(o *generateOptions) {
+		o.normalizeLineEnding = true
+	}
+}
+
+// WithPOSIXEnvKeys sanitizes keys of generated envs to the uppercase form
+// shells accept, e.g. my-config.key becomes MY_CONFIG_KEY. Keys colliding
+// after sanitization are reported as warnings
+func WithPOSIXEnvKeys() GenerateOption {
+	return func(o *generateOptions) {
+		o.posixEnvKeys = true
+	}
+}
+
+// WithNonEmptyAssets fails generation if any asset renders to empty or
+// whitespace only content, which is almost always a templating mistake
+func WithNonEmptyAssets() GenerateOption {
+	return func(o *generateOptions) {
+		o.rejectEmptyAssets = true
+	}
+}
+
+// WithMaxAssetSize fails generation if any asset renders to more than
+// maxBytes, for engines capping length of queries
+func WithMaxAssetSize(maxBytes int) GenerateOption {
+	return func(o *generateOptions) {
+		o.maxAssetSize = maxBytes
+	}
+}
+
+// WithAssetValidation validates rendered assets with the validator
+// registered for their extension, nil validators use DefaultAssetValidators
+func WithAssetValidation(validators map[string]AssetValidator) GenerateOption {
+	return func(o *generateOptions) {
+		if validators == nil {
+			validators = DefaultAssetValidators()
+		}
+		o.assetValidators = validators
+	}
+}
+
+// WithEnvNameRules validates names of generated envs against the rules,
+// for runtimes rejecting long names or envs overriding reserved ones
+func WithEnvNameRules(rules EnvNameRules) GenerateOption {
+	return func(o *generateOptions) {
+		o.envNameRules = &rules
+	}
+}
+
+// WithEnvKeyPrefix prepends the prefix to keys of generated envs, e.g. FOO_
+// generates FOO_DSTART, avoiding collisions when envs of multiple jobs are
+// merged. Templates keep referencing variables without the prefix
+func WithEnvKeyPrefix(prefix string) GenerateOption {
+	return func(o *generateOptions) {
+		o.envKeyPrefix = prefix
+	}
+}
+
+// WithTrimmedValues trims leading and trailing whitespace of variables
+// rendered in configs and assets, e.g. a table name configured with a
+// trailing newline renders inline in sql. Templates can still trim text
+// around actions with {{- and -}}
+func WithTrimmedValues() GenerateOption {
+	return func(o *generateOptions) {
+		o.trimValues = true
+	}
+}
+
+// WithMetaFile adds MetaFileName to the generated files, describing the
+// source of each generated env and if it was defaulted or holds a secret,
+// for observability of runs. Values of envs, secret or not, are left out
+func WithMetaFile() GenerateOption {
+	return func(o *generateOptions) {
+		o.metaFile = true
+	}
+}
+
+// WithShellEscapedEnvs quotes values of generated envs for safe use in
+// shell commands, see ShellQuote
+func WithShellEscapedEnvs() GenerateOption {
+	return func(o *generateOptions) {
+		o.shellEscapeEnvs = true
+	}
+}
+
+// WithContext aborts generation once the context is done, rendering in
+// progress stops the same way as with WithRenderTimeout
+func WithContext(ctx context.Context) GenerateOption {
+	return func(o *generateOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithRenderTimeout aborts generation taking longer than the timeout, e.g.
+// templates ranging over huge inputs. Rendering stops at the next output a
+// template writes after the timeout, a template function blocking or
+// looping without output keeps running till it returns
+func WithRenderTimeout(timeout time.Duration) GenerateOption {
+	return func(o *generateOptions) {
+		o.renderTimeout = timeout
+	}
+}
+
+// WithReferenceTime generates as if the instance was scheduled at the
+// reference time instead, with its window and execution time derived from
+// it, answering what a run at that time would produce without creating
+// instances
+func WithReferenceTime(referenceTime time.Time) GenerateOption {
+	return func(o *generateOptions) {
+		o.referenceTime = referenceTime
+	}
+}
+
+// WithGeneratedTimeLayout renders times of generated variables, like DSTART,
+// DEND and EXECUTION_TIME, in layout to display them differently without
+// affecting models.InstanceScheduledAtTimeLayout, which times exchanged
+// with schedulers keep and generated times default to
+func WithGeneratedTimeLayout(layout string) GenerateOption {
+	return func(o *generateOptions) {
+		o.timeLayout = layout
+	}
+}
+
+// missingKeyConfigurable is implemented by engines which allow tuning the
+// handling of variables missing from the context
+type missingKeyConfigurable interface {
+	WithMissingKey(MissingKeyPolicy) models.TemplateEngine
+}
+
+// timeLayoutConfigurable is implemented by engines which allow tuning the
+// layout their time functions, like Date, parse times with
+type timeLayoutConfigurable interface {
+	WithTimeLayout(layout string) models.TemplateEngine
+}
+
+var secretReference = regexp.MustCompile(`\b` + SecretEnvPrefix + `(\w+)`)
+
+// resolveSecrets adds SECRET__ variables referenced in templates to the
+// template context, fetching each from the secret provider once
+func (fm *ContextManager) resolveSecrets(templateContext map[string]interface{}, templates []string) error {
+	provider := fm.secrets()
+	for _, tmpl := range templates {
+		for _, match := range secretReference.FindAllStringSubmatch(tmpl, -1) {
+			if _, ok := templateContext[match[0]]; ok {
+				continue
+			}
+			val, err := provider.Get(match[1])
+			if err != nil {
+				return errors.Wrapf(err, "failed to resolve %s", match[0])
+			}
+			templateContext[match[0]] = val
+			if fm.options.resolvedSecrets != nil {
+				*fm.options.resolvedSecrets = append(*fm.options.resolvedSecrets, val)
+			}
+		}
+	}
+	return nil
+}
+
+// secrets returns the provider secrets are resolved from
+func (fm *ContextManager) secrets() models.SecretProvider {
+	if fm.secretProvider == nil {
+		return fm.namespace.ProjectSpec.Secret
+	}
+	return fm.secretProvider
+}
+
+// hasSecretFn returns a template function telling if the secret is
+// configured, for jobs behaving differently with optional secrets e.g.
+// {{ if hasSecret "api_token" }}...{{ end }}
+func hasSecretFn(provider models.SecretProvider) func(string) (bool, error) {
+	return func(name string) (bool, error) {
+		_, err := provider.Get(name)
+		if err == nil {
+			return true, nil
+		}
+		if errors.Is(err, models.ErrSecretNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to check secret %s", name)
+	}
+}
+
+// bindWindowFuncs makes functions operating on the window of the instance
+// available to templates, like partitions
+func (fm *ContextManager) bindWindowFuncs(instanceEnvMap map[string]interface{}) error {
+	engine, ok := fm.engine.(funcsConfigurable)
+	if !ok {
+		return nil
+	}
+	dstart, _ := instanceEnvMap[ConfigKeyDstart].(string)
+	dend, _ := instanceEnvMap[ConfigKeyDend].(string)
+	if dstart == "" || dend == "" {
+		return nil
+	}
+	start, err := time.Parse(fm.options.timeLayout, dstart)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s of instance", ConfigKeyDstart)
+	}
+	end, err := time.Parse(fm.options.timeLayout, dend)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s of instance", ConfigKeyDend)
+	}
+	fm.engine = engine.WithExtraFuncs(template.FuncMap{
+		partitionsFnName: partitionsFn(start, end, fm.options.timeLayout),
+	})
+	return nil
+}
+
+// partitionsFn returns a template function listing start of each day, or
+// hour if grain h is asked for, between start and end of the window e.g.
+// {{ range partitions }}{{ Date . }}{{ end }}
+func partitionsFn(start, end time.Time, layout string) func(...string) ([]string, error) {
+	return func(grain ...string) ([]string, error) {
+		step := 24 * time.Hour
+		if len(grain) > 0 {
+			switch grain[0] {
+			case "d":
+			case "h":
+				step = time.Hour
+			default:
+				return nil, errors.Errorf("partitions grain can be d or h, got %s", grain[0])
+			}
+		}
+		var partitions []string
+		for partition := start; partition.Before(end); partition = partition.Add(step) {
+			partitions = append(partitions, partition.Format(layout))
+		}
+		return partitions, nil
+	}
+}
+
+// resolveWindow makes jobs without a window of their own use the default
+// window of the project, if any
+func (fm *ContextManager) resolveWindow() error {
+	window, ok, err := fm.namespace.ProjectSpec.WindowOf(fm.jobSpec.Task.Window)
+	if err != nil || !ok {
+		return err
+	}
+	fm.jobSpec.Task.Window = window
+	fm.usesProjectWindow = true
+	fm.addWarning(Warning(fmt.Sprintf("window of job %s not configured, defaulted to window of project %s",
+		fm.jobSpec.Name, fm.namespace.ProjectSpec.Name)))
+	return nil
+}
+
+// funcsConfigurable is implemented by engines which allow adding template
+// functions bound to a single generation
+type funcsConfigurable interface {
+	WithExtraFuncs(template.FuncMap) models.TemplateEngine
+}
+
+// contextConfigurable is implemented by engines which can stop rendering
+// once the context of the generation is done
+type contextConfigurable interface {
+	WithContext(context.Context) models.TemplateEngine
+}
+
+// SetLibReader enables the libInclude template function which inlines
+// snippets read from the shared library configured for the project, reads
+// are cached within a generation
+func (fm *ContextManager) SetLibReader(reader store.ObjectReader) {
+	fm.libReader = reader
+}
+
+// DeprecateVariable keeps a deprecated variable resolving to the value of
+// the preferred variable, while warning whenever a template uses it
+func (fm *ContextManager) DeprecateVariable(deprecated, preferred string) {
+	fm.deprecatedVariables[deprecated] = preferred
+}
+
+// SetSecretProvider sets where SECRET__ variables referenced in templates
+// are resolved from, e.g. a vault. Only secrets referenced are fetched
+func (fm *ContextManager) SetSecretProvider(provider models.SecretProvider) {
+	fm.secretProvider = provider
+}
+
+// SetUpstreamLookup enables the upstream template function resolving outputs
+// published by upstream jobs, e.g. {{ upstream "producer" "output_path" }}
+// for jobs consuming data another job produces
+func (fm *ContextManager) SetUpstreamLookup(lookup UpstreamLookup) {
+	fm.upstreamLookup = lookup
+}
+
+// SetOrgConfig sets configs shared by all projects of the organization,
+// these are available to templates as GLOBAL__ variables unless the
+// project, namespace or job configure the same key
+func (fm *ContextManager) SetOrgConfig(config map[string]string) {
+	fm.orgConfig = config
+}
+
+// SetJobGlobalConfig sets global configs overridden for the job alone, these
+// take precedence over configs of the org, project and namespace
+func (fm *ContextManager) SetJobGlobalConfig(config map[string]string) {
+	fm.jobGlobalConfig = config
+}
+
+// SetDeployment selects the deployment, e.g. prod or staging, the instance
+// is generated for. Configs keyed as key@deployment override key for the
+// selected deployment, overrides of other deployments are dropped
+func (fm *ContextManager) SetDeployment(deployment string) {
+	fm.deployment = deployment
+}
+
+// ResolveGlobalConfig merges layers of global configs where org defaults are
+// overridden by project configs, which are overridden by namespace configs,
+// which in turn are overridden by configs of the job
+func ResolveGlobalConfig(org, project, namespace, job map[string]string) map[string]string {
+	resolved := map[string]string{}
+	for _, layer := range []map[string]string{org, project, namespace, job} {
+		for key, val := range layer {
+			resolved[key] = val
+		}
+	}
+	return resolved
+}
+
+// SetMetrics sets the recorder of render counts, errors and durations
+func (fm *ContextManager) SetMetrics(recorder models.MetricsRecorder) {
+	if recorder == nil {
+		recorder = models.NoopMetrics{}
+	}
+	fm.metrics = recorder
 }
 
 // Generate fetches and compiles all config data related to an instance and
@@ -46,19 +509,320 @@ func (fm *ContextManager) Generate(
 	instanceSpec models.InstanceSpec,
 	runType models.InstanceType,
 	runName string,
+	opts ...GenerateOption,
 ) (envMap map[string]string, fileMap map[string]string, err error) {
-	projectPrefixedConfig, projRawConfig := fm.projectEnvs()
+	envMap, fileMap, _, err = fm.GenerateWithWarnings(instanceSpec, runType, runName, opts...)
+	return envMap, fileMap, err
+}
 
-	// instance env will be used for templating
-	instanceEnvMap, instanceFileMap := fm.getInstanceData(instanceSpec)
+// GenerateWithWarnings works like Generate and additionally returns the non
+// fatal issues noticed during generation, e.g. use of deprecated variables,
+// windows defaulted from the project or configs rendering empty
+func (fm *ContextManager) GenerateWithWarnings(
+	instanceSpec models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+	opts ...GenerateOption,
+) (envMap map[string]string, fileMap map[string]string, warnings []Warning, err error) {
+	labels := map[string]string{
+		"run_type": runType.String(),
+	}
+	fm.metrics.IncCounter(metricGenerateTotal, labels)
+	defer func(began time.Time) {
+		if err != nil {
+			fm.metrics.IncCounter(metricGenerateErrors, labels)
+		}
+		fm.metrics.ObserveDuration(metricGenerateDuration, labels, time.Since(began))
+	}(time.Now())
 
-	// merge both
-	projectInstanceContext := MergeInterfaceMapToInterface(instanceEnvMap, projectPrefixedConfig)
-	projectInstanceContext["proj"] = projRawConfig
-	projectInstanceContext["inst"] = instanceEnvMap
+	scoped, err := fm.withOptions(opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if runType == models.InstanceTypeTask {
+		if err := scoped.selectTask(runName); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	ctx := scoped.options.ctx
+	if scoped.options.renderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scoped.options.renderTimeout)
+		defer cancel()
+	}
+	if !scoped.options.referenceTime.IsZero() {
+		instanceSpec = scoped.atReferenceTime(instanceSpec)
+	}
+	if envMap, fileMap, err = scoped.generateWithContext(ctx, instanceSpec, runType, runName); err != nil {
+		return nil, nil, nil, err
+	}
+	return envMap, fileMap, scoped.warnings, nil
+}
+
+// atReferenceTime returns a copy of the instance rescheduled at the
+// reference time, with data derived from its schedule updated accordingly
+func (fm *ContextManager) atReferenceTime(instanceSpec models.InstanceSpec) models.InstanceSpec {
+	scheduledAt := fm.options.referenceTime.UTC()
+	derived := map[string]string{
+		ConfigKeyExecutionTime: scheduledAt.Format(models.InstanceScheduledAtTimeLayout),
+		ConfigKeyDstart:        fm.jobSpec.Task.Window.GetStart(scheduledAt).Format(models.InstanceScheduledAtTimeLayout),
+		ConfigKeyDend:          fm.jobSpec.Task.Window.GetEnd(scheduledAt).Format(models.InstanceScheduledAtTimeLayout),
+	}
+
+	instanceSpec.ScheduledAt = scheduledAt
+	data := make([]models.InstanceSpecData, 0, len(instanceSpec.Data))
+	for _, item := range instanceSpec.Data {
+		if val, ok := derived[item.Name]; ok && item.Type == models.InstanceDataTypeEnv {
+			item.Value = val
+			delete(derived, item.Name)
+		}
+		data = append(data, item)
+	}
+	for _, name := range []string{ConfigKeyExecutionTime, ConfigKeyDstart, ConfigKeyDend} {
+		if val, ok := derived[name]; ok {
+			data = append(data, models.InstanceSpecData{
+				Name:  name,
+				Value: val,
+				Type:  models.InstanceDataTypeEnv,
+			})
+		}
+	}
+	instanceSpec.Data = data
+	return instanceSpec
+}
+
+// selectTask scopes generation to the task of the name, which can be the
+// task of the job or one of its subtasks. Jobs without subtasks have a
+// single task which is generated whatever the name
+func (fm *ContextManager) selectTask(name string) error {
+	if len(fm.jobSpec.Task.Subtasks) == 0 {
+		return nil
+	}
+	task, err := fm.jobSpec.Task.GetTaskByName(name)
+	if err != nil {
+		return errors.Wrapf(err, "requested task not found %s", name)
+	}
+	for _, subtask := range fm.jobSpec.Task.Subtasks {
+		if subtask.Name != name || len(subtask.Assets) == 0 {
+			continue
+		}
+		var assets []models.JobSpecAsset
+		for _, assetName := range subtask.Assets {
+			asset, err := fm.jobSpec.Assets.GetByName(assetName)
+			if err != nil {
+				return errors.Wrapf(err, "asset %s of task %s", assetName, name)
+			}
+			assets = append(assets, asset)
+		}
+		fm.jobSpec.Assets = *models.JobAssets{}.New(assets)
+	}
+	fm.jobSpec.Task = task
+	return nil
+}
+
+// generateWithContext stops waiting for generation once the context is
+// done, templates can't be interrupted so a runaway render is left to
+// finish in background with its result discarded
+func (fm *ContextManager) generateWithContext(
+	ctx context.Context,
+	instanceSpec models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+) (map[string]string, map[string]string, error) {
+	if ctx.Done() == nil {
+		return fm.generate(ctx, instanceSpec, runType, runName)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrapf(err, "aborted generating %s context of %s", runType, runName)
+	}
+
+	type generated struct {
+		envMap, fileMap map[string]string
+		err             error
+	}
+	done := make(chan generated, 1)
+	go func() {
+		envMap, fileMap, err := fm.generate(ctx, instanceSpec, runType, runName)
+		done <- generated{envMap: envMap, fileMap: fileMap, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, nil, errors.Wrapf(ctx.Err(), "aborted generating %s context of %s", runType, runName)
+	case result := <-done:
+		return result.envMap, result.fileMap, result.err
+	}
+}
+
+// GenerateWith works like Generate making the extra variables available in
+// templates as well, useful to inject ad-hoc values not sourced from config
+// e.g. in tests. Variables of the instance, project and job take precedence
+// over extra variables of the same name
+func (fm *ContextManager) GenerateWith(
+	instanceSpec models.InstanceSpec,
+	extra map[string]string,
+	runType models.InstanceType,
+	runName string,
+	opts ...GenerateOption,
+) (envMap map[string]string, fileMap map[string]string, err error) {
+	opts = append([]GenerateOption{func(o *generateOptions) {
+		o.extraVariables = extra
+	}}, opts...)
+	return fm.Generate(instanceSpec, runType, runName, opts...)
+}
+
+// MaskedValue replaces secrets in masked copies of generated envs and files
+const MaskedValue = "***"
+
+// GenerateMasked works like Generate and additionally returns copies of the
+// envs and files with values of SECRET__ variables replaced by MaskedValue,
+// safe for logging. Envs flagged with SecretEnvPrefix are masked entirely
+func (fm *ContextManager) GenerateMasked(
+	instanceSpec models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+	opts ...GenerateOption,
+) (envMap, fileMap, maskedEnvMap, maskedFileMap map[string]string, err error) {
+	var secrets []string
+	opts = append(opts, func(o *generateOptions) {
+		o.resolvedSecrets = &secrets
+	})
+	if envMap, fileMap, err = fm.Generate(instanceSpec, runType, runName, opts...); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// longer secrets first, in case one contains another
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	var replacements []string
+	for _, secret := range secrets {
+		if secret != "" {
+			replacements = append(replacements, secret, MaskedValue)
+		}
+	}
+	masker := strings.NewReplacer(replacements...)
+
+	maskedEnvMap = map[string]string{}
+	for key, val := range envMap {
+		if isSecretEnv(key) {
+			maskedEnvMap[key] = MaskedValue
+			continue
+		}
+		maskedEnvMap[key] = masker.Replace(val)
+	}
+	maskedFileMap = map[string]string{}
+	for name, content := range fileMap {
+		maskedFileMap[name] = masker.Replace(content)
+	}
+	return envMap, fileMap, maskedEnvMap, maskedFileMap, nil
+}
+
+// GenerateResult is the outcome of generating context of a single instance
+// in a batch, Err is set if generation failed
+type GenerateResult struct {
+	// identity of the instance generated for
+	InstanceID  uuid.UUID
+	ScheduledAt time.Time
+
+	EnvMap  map[string]string
+	FileMap map[string]string
+	Err     error
+}
+
+// GenerateBatch generates context of each instance, collecting failures
+// instead of stopping at the first so callers can retry or report the
+// instances which failed. Results are in order of the instances
+func (fm *ContextManager) GenerateBatch(
+	instanceSpecs []models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+	opts ...GenerateOption,
+) []GenerateResult {
+	results := make([]GenerateResult, 0, len(instanceSpecs))
+	for _, instanceSpec := range instanceSpecs {
+		envMap, fileMap, err := fm.Generate(instanceSpec, runType, runName, opts...)
+		results = append(results, GenerateResult{
+			InstanceID:  instanceSpec.ID,
+			ScheduledAt: instanceSpec.ScheduledAt,
+			EnvMap:      envMap,
+			FileMap:     fileMap,
+			Err:         err,
+		})
+	}
+	return results
+}
+
+// withOptions returns a copy of the manager scoped to a single Generate call
+func (fm *ContextManager) withOptions(opts []GenerateOption) (*ContextManager, error) {
+	scoped := *fm
+	scoped.warnings = nil
+	scoped.options = generateOptions{
+		missingKey: MissingKeyError,
+		ctx:        context.Background(),
+		timeLayout: models.InstanceScheduledAtTimeLayout,
+	}
+	for _, opt := range opts {
+		opt(&scoped.options)
+	}
+
+	if err := scoped.options.missingKey.Validate(); err != nil {
+		return nil, err
+	}
+	if err := scoped.resolveWindow(); err != nil {
+		return nil, err
+	}
+	if engine, ok := fm.engine.(missingKeyConfigurable); ok {
+		scoped.engine = engine.WithMissingKey(scoped.options.missingKey)
+	}
+	if engine, ok := scoped.engine.(timeLayoutConfigurable); ok {
+		scoped.engine = engine.WithTimeLayout(scoped.options.timeLayout)
+	} else if scoped.options.timeLayout != models.InstanceScheduledAtTimeLayout {
+		return nil, errors.Errorf("template engine doesn't support time layout %s", scoped.options.timeLayout)
+	}
+	if engine, ok := scoped.engine.(funcsConfigurable); ok && fm.libReader != nil {
+		scoped.engine = engine.WithExtraFuncs(template.FuncMap{
+			libIncludeFnName: newLibIncluder(fm.libReader, fm.namespace.ProjectSpec).Include,
+		})
+	}
+	if engine, ok := scoped.engine.(funcsConfigurable); ok {
+		scoped.engine = engine.WithExtraFuncs(template.FuncMap{
+			hasSecretFnName: hasSecretFn(fm.secrets()),
+			upstreamFnName:  upstreamFn(fm.upstreamLookup),
+		})
+	}
+	return &scoped, nil
+}
+
+func (fm *ContextManager) generate(
+	ctx context.Context,
+	instanceSpec models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+) (envMap map[string]string, fileMap map[string]string, err error) {
+	if engine, ok := fm.engine.(contextConfigurable); ok && ctx.Done() != nil {
+		fm.engine = engine.WithContext(ctx)
+	}
+	projectInstanceContext, instanceEnvMap, instanceFileMap := fm.projectInstanceContext(instanceSpec)
+	if err = fm.bindWindowFuncs(instanceEnvMap); err != nil {
+		return nil, nil, err
+	}
+
+	// resolve secrets referenced by configs and assets of the job
+	templates := []string{}
+	for _, config := range fm.jobSpec.Task.Config {
+		templates = append(templates, config.Value)
+	}
+	for _, hook := range fm.jobSpec.OrderedHooks() {
+		for _, config := range hook.Config {
+			templates = append(templates, config.Value)
+		}
+	}
+	if err = fm.resolveSecrets(projectInstanceContext, templates); err != nil {
+		return nil, nil, err
+	}
 
 	// prepare configs
-	envMap, err = fm.generateEnvs(runName, runType, projectInstanceContext)
+	envMap, err = fm.generateEnvs(instanceSpec, runName, runType, projectInstanceContext)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -69,10 +833,37 @@ func (fm *ContextManager) Generate(
 			envMap[k] = vs
 		}
 	}
+	var variables []VariableMeta
+	if fm.options.metaFile {
+		if variables, err = fm.describeEnvs(envMap, instanceEnvMap, runName, runType); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if fm.options.envKeyPrefix != "" {
+		prefixed := make(map[string]string, len(envMap))
+		for key, val := range envMap {
+			prefixed[fm.options.envKeyPrefix+key] = val
+		}
+		envMap = prefixed
+	}
+	if fm.options.posixEnvKeys {
+		envMap = fm.sanitizeEnvKeys(envMap)
+	}
+	if fm.options.shellEscapeEnvs {
+		for key, val := range envMap {
+			envMap[key] = ShellQuote(val)
+		}
+	}
+	if fm.options.envNameRules != nil {
+		if err = fm.validateEnvNames(envMap, *fm.options.envNameRules); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// do the same for asset files
 	// check if task needs to override the compilation behaviour
-	compiledAssetResponse, err := fm.jobSpec.Task.Unit.CLIMod.CompileAssets(context.Background(), models.CompileAssetsRequest{
+	compiledAssetResponse, err := fm.jobSpec.Task.Unit.CLIMod.CompileAssets(ctx, models.CompileAssetsRequest{
 		Window:           fm.jobSpec.Task.Window,
 		Config:           models.PluginConfigs{}.FromJobSpec(fm.jobSpec.Task.Config),
 		Assets:           models.PluginAssets{}.FromJobSpec(fm.jobSpec.Assets),
@@ -85,32 +876,197 @@ func (fm *ContextManager) Generate(
 
 	// append job spec assets to list of files need to write
 	fileMap = MergeStringMap(instanceFileMap, compiledAssetResponse.Assets.ToJobSpec().ToMap())
-	if fileMap, err = fm.engine.CompileFiles(fileMap, projectInstanceContext); err != nil {
+	templates = templates[:0]
+	for _, content := range fileMap {
+		fm.warnDeprecatedUsage(content)
+		templates = append(templates, content)
+	}
+	if err = fm.resolveSecrets(projectInstanceContext, templates); err != nil {
+		return nil, nil, err
+	}
+	if fileMap, err = fm.engine.CompileFiles(fileMap, fm.renderContext(projectInstanceContext)); err != nil {
 		return
 	}
+	if fileMap, err = fm.compileFileNames(fileMap, projectInstanceContext); err != nil {
+		return nil, nil, err
+	}
+	if fm.options.rejectEmptyAssets {
+		for name, content := range fileMap {
+			if strings.TrimSpace(content) == "" {
+				return nil, nil, errors.Errorf("asset %s is empty after rendering", name)
+			}
+		}
+	}
+	if fm.options.maxAssetSize > 0 {
+		names := make([]string, 0, len(fileMap))
+		for name := range fileMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if size := len(fileMap[name]); size > fm.options.maxAssetSize {
+				return nil, nil, errors.Errorf("asset %s is %d bytes after rendering, exceeding max of %d bytes",
+					name, size, fm.options.maxAssetSize)
+			}
+		}
+	}
+	if fm.options.assetValidators != nil {
+		if err = validateAssets(fileMap, fm.options.assetValidators); err != nil {
+			return nil, nil, err
+		}
+	}
+	if fm.options.normalizeLineEnding {
+		for name, content := range fileMap {
+			fileMap[name] = strings.ReplaceAll(content, "\r\n", "\n")
+		}
+	}
+	if fm.options.metaFile {
+		if _, ok := fileMap[MetaFileName]; ok {
+			return nil, nil, errors.Errorf("asset %s collides with description of generated envs", MetaFileName)
+		}
+		if fileMap[MetaFileName], err = fm.metaFile(variables, envMap); err != nil {
+			return nil, nil, err
+		}
+	}
 	return envMap, fileMap, nil
 }
 
+// AvailableVariables returns every variable usable in templates of the
+// requested run along with its resolved value, e.g. EXECUTION_TIME, DSTART,
+// GLOBAL__* and for hooks TASK__*
+func (fm *ContextManager) AvailableVariables(
+	instanceSpec models.InstanceSpec,
+	runType models.InstanceType,
+	runName string,
+) (map[string]string, error) {
+	scoped, err := fm.withOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+	templateContext, _, _ := scoped.projectInstanceContext(instanceSpec)
+	if runType == models.InstanceTypeHook {
+		transformationConfigs, _, err := scoped.getConfigMaps(scoped.jobSpec, runName, runType)
+		if err != nil {
+			return nil, err
+		}
+		if transformationConfigs, err = scoped.compileTemplates(transformationConfigs, templateContext); err != nil {
+			return nil, err
+		}
+		for k, v := range transformationConfigs {
+			templateContext[fmt.Sprintf("%s%s", TaskConfigPrefix, k)] = v
+		}
+	}
+	// nested maps like .proj and .inst are skipped, their values are
+	// available with prefixed names already
+	variables := MergeInterfaceMapToString(templateContext, nil)
+	// IS_CATCHUP is a bool for conditionals in templates, which merging
+	// to strings skips
+	variables[ConfigKeyIsCatchup] = strconv.FormatBool(scoped.isCatchup(instanceSpec))
+	return variables, nil
+}
+
+// projectInstanceContext merges project and instance variables into the
+// context used for templating, returning the instance envs and files too
+func (fm *ContextManager) projectInstanceContext(instanceSpec models.InstanceSpec) (map[string]interface{},
+	map[string]interface{}, map[string]string) {
+	projectPrefixedConfig, projRawConfig := fm.projectEnvs()
+
+	// instance env will be used for templating
+	instanceEnvMap, instanceFileMap := fm.getInstanceData(instanceSpec)
+	if fm.usesProjectWindow {
+		instanceEnvMap[ConfigKeyDstart] = fm.jobSpec.Task.Window.GetStart(instanceSpec.ScheduledAt).Format(models.InstanceScheduledAtTimeLayout)
+		instanceEnvMap[ConfigKeyDend] = fm.jobSpec.Task.Window.GetEnd(instanceSpec.ScheduledAt).Format(models.InstanceScheduledAtTimeLayout)
+	}
+
+	var dendInclusive string
+	if dend, ok := instanceEnvMap[ConfigKeyDend].(string); ok {
+		if end, err := time.Parse(models.InstanceScheduledAtTimeLayout, dend); err == nil {
+			dendInclusive = end.Add(-time.Second).Format(fm.options.timeLayout)
+		}
+	}
+	for _, name := range []string{ConfigKeyExecutionTime, ConfigKeyDstart, ConfigKeyDend} {
+		if val, ok := instanceEnvMap[name].(string); ok {
+			instanceEnvMap[name] = toGeneratedLayout(val, fm.options.timeLayout)
+		}
+	}
+
+	// merge both
+	projectInstanceContext := MergeInterfaceMapToInterface(instanceEnvMap, projectPrefixedConfig)
+	projectInstanceContext["proj"] = projRawConfig
+	projectInstanceContext["inst"] = instanceEnvMap
+	projectInstanceContext[ConfigKeyIsCatchup] = fm.isCatchup(instanceSpec)
+	if dendInclusive != "" {
+		projectInstanceContext[ConfigKeyDendInclusive] = dendInclusive
+	}
+	projectInstanceContext[ConfigKeyScheduleInterval] = fm.jobSpec.Schedule.Interval
+	projectInstanceContext[ConfigKeyStartDate] = fm.jobSpec.Schedule.StartDate.Format(models.JobDatetimeLayout)
+	fm.aliasDeprecatedVariables(projectInstanceContext)
+	for key, val := range fm.options.extraVariables {
+		if _, ok := projectInstanceContext[key]; !ok {
+			projectInstanceContext[key] = val
+		}
+	}
+	return projectInstanceContext, instanceEnvMap, instanceFileMap
+}
+
+// toGeneratedLayout renders a time exchanged with schedulers in the layout
+// of generated variables, values not in the scheduled at layout are kept
+func toGeneratedLayout(value, layout string) string {
+	if layout == models.InstanceScheduledAtTimeLayout {
+		return value
+	}
+	t, err := time.Parse(models.InstanceScheduledAtTimeLayout, value)
+	if err != nil {
+		return value
+	}
+	return t.Format(layout)
+}
+
+// isCatchup tells if the instance is running behind its schedule, i.e. a
+// later schedule of the job was already due when it was executed, as
+// happens with backfills and catchup runs
+func (fm *ContextManager) isCatchup(instanceSpec models.InstanceSpec) bool {
+	var executedAt time.Time
+	for _, data := range instanceSpec.Data {
+		if data.Name == ConfigKeyExecutionTime && data.Type == models.InstanceDataTypeEnv {
+			var err error
+			if executedAt, err = time.Parse(models.InstanceScheduledAtTimeLayout, data.Value); err != nil {
+				return false
+			}
+		}
+	}
+	if executedAt.IsZero() {
+		return false
+	}
+	schedule, err := cron.ParseCronSchedule(fm.jobSpec.Schedule.Interval)
+	if err != nil {
+		return false
+	}
+	return !schedule.Next(instanceSpec.ScheduledAt).After(executedAt)
+}
+
 func (fm *ContextManager) projectEnvs() (map[string]interface{}, map[string]interface{}) {
 	// project configs will be used for templating
 	// prefix project configs to avoid conflicts with project/instance configs
 	projectPrefixedConfig := map[string]interface{}{}
 	projRawConfig := map[string]interface{}{}
-	for key, val := range fm.getProjectConfigMap() {
-		projectPrefixedConfig[fmt.Sprintf("%s%s", ProjectConfigPrefix, key)] = val
-		projRawConfig[key] = val
-	}
 
-	// use namespace configs for templating. also, override project config with
-	// namespace's configs when present
-	for key, val := range fm.getNamespaceConfigMap() {
+	// use org, project, namespace and job configs for templating, each
+	// overriding the configs of layers before it when present
+	globalConfig := ResolveGlobalConfig(
+		fm.withDeploymentOverrides(fm.orgConfig),
+		fm.withDeploymentOverrides(fm.getProjectConfigMap()),
+		fm.withDeploymentOverrides(fm.getNamespaceConfigMap()),
+		fm.withDeploymentOverrides(fm.jobGlobalConfig),
+	)
+	for key, val := range globalConfig {
 		projectPrefixedConfig[fmt.Sprintf("%s%s", ProjectConfigPrefix, key)] = val
 		projRawConfig[key] = val
 	}
 	return projectPrefixedConfig, projRawConfig
 }
 
-func (fm *ContextManager) generateEnvs(runName string, runType models.InstanceType,
+func (fm *ContextManager) generateEnvs(instanceSpec models.InstanceSpec, runName string, runType models.InstanceType,
 	projectInstanceContext map[string]interface{}) (map[string]string, error) {
 	transformationConfigs, hookConfigs, err := fm.getConfigMaps(fm.jobSpec, runName, runType)
 	if err != nil {
@@ -127,6 +1083,11 @@ func (fm *ContextManager) generateEnvs(runName string, runType models.InstanceTy
 		return MergeInterfaceMapToString(transformationConfigs, nil), nil
 	}
 
+	// fail early with a clear error for hooks referencing unknown task configs
+	if err := fm.jobSpec.ValidateHookReferences(); err != nil {
+		return nil, err
+	}
+
 	// prefix transformation configs to avoid conflicts with project/instance configs
 	prefixedTransformationConfigs := map[string]interface{}{}
 	for k, v := range transformationConfigs {
@@ -136,6 +1097,15 @@ func (fm *ContextManager) generateEnvs(runName string, runType models.InstanceTy
 	// templatize configs of hook with transformation, project and instance
 	projectInstanceTransformationConfigs := MergeInterfaceMapToInterface(projectInstanceContext, prefixedTransformationConfigs)
 	projectInstanceTransformationConfigs["task"] = transformationConfigs
+
+	// templatize with values published by hooks running before this one
+	hookOutputs, err := fm.hookOutputs(instanceSpec, runName, hookConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hookOutputs {
+		projectInstanceTransformationConfigs[k] = v
+	}
 	if hookConfigs, err = fm.compileTemplates(hookConfigs, projectInstanceTransformationConfigs); err != nil {
 		return nil, err
 	}
@@ -144,21 +1114,246 @@ func (fm *ContextManager) generateEnvs(runName string, runType models.InstanceTy
 	return MergeInterfaceMapToString(prefixedTransformationConfigs, hookConfigs), nil
 }
 
+var hookOutputReference = regexp.MustCompile(HookOutputPrefix + `([\w-]+?)` + hookOutputSeparator + `\w+`)
+
+// hookOutputs returns values published by hooks running before the hook,
+// failing if its configs reference hooks which don't run before it
+func (fm *ContextManager) hookOutputs(instanceSpec models.InstanceSpec, hookName string,
+	hookConfigs map[string]interface{}) (map[string]interface{}, error) {
+	for _, val := range hookConfigs {
+		valString, ok := val.(string)
+		if !ok {
+			continue
+		}
+		for _, match := range hookOutputReference.FindAllStringSubmatch(valString, -1) {
+			if !fm.hookRunsBefore(match[1], hookName) {
+				return nil, errors.Errorf("hook %s references %s but hook %s doesn't run before it",
+					hookName, match[0], match[1])
+			}
+		}
+	}
+
+	outputs := map[string]interface{}{}
+	for _, data := range instanceSpec.Data {
+		if data.Type != models.InstanceDataTypeHookOutput {
+			continue
+		}
+		parts := strings.SplitN(data.Name, hookOutputSeparator, 2)
+		if len(parts) != 2 || !fm.hookRunsBefore(parts[0], hookName) {
+			continue
+		}
+		outputs[HookOutputPrefix+data.Name] = data.Value
+	}
+	return outputs, nil
+}
+
+// hookRunsBefore tells if the first hook always finishes before the second
+// one starts, either as pre hook of a post/fail hook or as its dependency
+func (fm *ContextManager) hookRunsBefore(first, second string) bool {
+	firstHook, err := fm.jobSpec.GetHookByName(first)
+	if err != nil || first == second {
+		return false
+	}
+	secondHook, err := fm.jobSpec.GetHookByName(second)
+	if err != nil {
+		return false
+	}
+	if firstHook.Unit.Info().HookType == models.HookTypePre &&
+		secondHook.Unit.Info().HookType != models.HookTypePre {
+		return true
+	}
+
+	visited := map[string]bool{}
+	pending := secondHook.DependsOn
+	for len(pending) > 0 {
+		dependency := pending[0]
+		pending = pending[1:]
+		name := dependency.Unit.Info().Name
+		if name == first {
+			return true
+		}
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		pending = append(pending, dependency.DependsOn...)
+	}
+	return false
+}
+
 func (fm *ContextManager) compileTemplates(templateValueMap, templateContext map[string]interface{}) (map[string]interface{}, error) {
 	for key, val := range templateValueMap {
 		valString, ok := val.(string)
 		if !ok {
 			continue
 		}
-		compiledValue, err := fm.engine.CompileString(valString, templateContext)
+		fm.warnDeprecatedUsage(valString)
+		compiledValue, err := fm.engine.CompileString(valString, fm.renderContext(templateContext))
 		if err != nil {
 			return nil, err
 		}
+		if strings.TrimSpace(compiledValue) == "" {
+			fm.addWarning(Warning(fmt.Sprintf("config %s is empty", key)))
+		}
 		templateValueMap[key] = compiledValue
 	}
 	return templateValueMap, nil
 }
 
+// renderContext returns the context templates are rendered with, with
+// values trimmed if asked
+func (fm *ContextManager) renderContext(templateContext map[string]interface{}) map[string]interface{} {
+	if !fm.options.trimValues {
+		return templateContext
+	}
+	return trimContextValues(templateContext)
+}
+
+func trimContextValues(templateContext map[string]interface{}) map[string]interface{} {
+	trimmed := make(map[string]interface{}, len(templateContext))
+	for key, val := range templateContext {
+		switch typed := val.(type) {
+		case string:
+			trimmed[key] = strings.TrimSpace(typed)
+		case map[string]interface{}:
+			trimmed[key] = trimContextValues(typed)
+		default:
+			trimmed[key] = val
+		}
+	}
+	return trimmed
+}
+
+// compileFileNames renders file names containing templates, e.g.
+// report_{{.DSTART | Date}}.sql, making sure they stay safe to write
+func (fm *ContextManager) compileFileNames(fileMap map[string]string,
+	templateContext map[string]interface{}) (map[string]string, error) {
+	compiled := map[string]string{}
+	for name, content := range fileMap {
+		compiledName := name
+		if strings.Contains(name, "{{") {
+			var err error
+			if compiledName, err = fm.engine.CompileString(name, templateContext); err != nil {
+				return nil, errors.Wrapf(err, "failed to compile file name %s", name)
+			}
+			if !isSafeFileName(compiledName) {
+				return nil, errors.Errorf("file name %s compiles to an invalid name %q", name, compiledName)
+			}
+		}
+		if _, ok := compiled[compiledName]; ok {
+			return nil, errors.Errorf("file name %s compiles to %s which already exists", name, compiledName)
+		}
+		compiled[compiledName] = content
+	}
+	return compiled, nil
+}
+
+func isSafeFileName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/\\\x00")
+}
+
+// aliasDeprecatedVariables resolves deprecated variables to the value of
+// variables replacing them
+func (fm *ContextManager) aliasDeprecatedVariables(templateContext map[string]interface{}) {
+	for deprecated, preferred := range fm.deprecatedVariables {
+		if _, ok := templateContext[deprecated]; ok {
+			continue
+		}
+		if val, ok := templateContext[preferred]; ok {
+			templateContext[deprecated] = val
+		}
+	}
+}
+
+// warnDeprecatedUsage records a warning for each deprecated variable used
+// in the template, once per Generate call
+func (fm *ContextManager) warnDeprecatedUsage(tmpl string) {
+	for deprecated, preferred := range fm.deprecatedVariables {
+		if !regexp.MustCompile(`\b` + regexp.QuoteMeta(deprecated) + `\b`).MatchString(tmpl) {
+			continue
+		}
+		fm.addWarning(Warning(fmt.Sprintf("variable %s is deprecated, use %s instead", deprecated, preferred)))
+	}
+}
+
+var posixEnvKeyIllegalChars = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// sanitizeEnvKeys converts env keys to POSIX safe names, where keys collide
+// the first in sorted order is kept
+func (fm *ContextManager) sanitizeEnvKeys(envMap map[string]string) map[string]string {
+	keys := make([]string, 0, len(envMap))
+	for key := range envMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sanitized := map[string]string{}
+	sources := map[string]string{}
+	for _, key := range keys {
+		safeKey := posixEnvKey(key)
+		if source, ok := sources[safeKey]; ok {
+			fm.addWarning(Warning(fmt.Sprintf("env %s collides with %s as %s, keeping value of %s", key, source, safeKey, source)))
+			continue
+		}
+		sources[safeKey] = key
+		sanitized[safeKey] = envMap[key]
+	}
+	return sanitized
+}
+
+// posixEnvKey upper cases the key replacing characters not allowed in POSIX
+// env names with underscores, prefixing keys starting with a digit too
+func posixEnvKey(key string) string {
+	safeKey := posixEnvKeyIllegalChars.ReplaceAllString(strings.ToUpper(key), "_")
+	if safeKey == "" || (safeKey[0] >= '0' && safeKey[0] <= '9') {
+		safeKey = "_" + safeKey
+	}
+	return safeKey
+}
+
+// validateEnvNames checks names of envs against the rules, violations are
+// warned unless the rules are strict
+func (fm *ContextManager) validateEnvNames(envMap map[string]string, rules EnvNameRules) error {
+	reserved := map[string]bool{}
+	for _, name := range rules.Reserved {
+		reserved[name] = true
+	}
+	keys := make([]string, 0, len(envMap))
+	for key := range envMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var violation string
+		switch {
+		case rules.MaxLength > 0 && len(key) > rules.MaxLength:
+			violation = fmt.Sprintf("env %s is longer than %d characters", key, rules.MaxLength)
+		case reserved[key]:
+			violation = fmt.Sprintf("env %s collides with a reserved name", key)
+		default:
+			continue
+		}
+		if rules.Strict {
+			return errors.New(violation)
+		}
+		fm.addWarning(Warning(violation))
+	}
+	return nil
+}
+
+func (fm *ContextManager) addWarning(warning Warning) {
+	for _, existing := range fm.warnings {
+		if existing == warning {
+			return
+		}
+	}
+	fm.warnings = append(fm.warnings, warning)
+}
+
 func (fm *ContextManager) getProjectConfigMap() map[string]string {
 	configMap := map[string]string{}
 	for key, val := range fm.namespace.ProjectSpec.Config {
@@ -186,6 +1381,8 @@ func (fm *ContextManager) getInstanceData(instanceSpec models.InstanceSpec) (map
 				fileMap[jobRunData.Name] = jobRunData.Value
 			case models.InstanceDataTypeEnv:
 				envMap[jobRunData.Name] = jobRunData.Value
+			case models.InstanceDataTypeConf:
+				envMap[fmt.Sprintf("%s%s", ConfConfigPrefix, jobRunData.Name)] = jobRunData.Value
 			}
 		}
 	}
@@ -195,9 +1392,13 @@ func (fm *ContextManager) getInstanceData(instanceSpec models.InstanceSpec) (map
 func (fm *ContextManager) getConfigMaps(jobSpec models.JobSpec, runName string,
 	runType models.InstanceType) (map[string]interface{},
 	map[string]interface{}, error) {
-	transformationMap := map[string]interface{}{}
+	transformationConfig := map[string]string{}
 	for _, val := range jobSpec.Task.Config {
-		transformationMap[val.Name] = val.Value
+		transformationConfig[val.Name] = val.Value
+	}
+	transformationMap := map[string]interface{}{}
+	for key, val := range fm.withDeploymentOverrides(transformationConfig) {
+		transformationMap[key] = val
 	}
 
 	hookMap := map[string]interface{}{}
@@ -206,18 +1407,45 @@ func (fm *ContextManager) getConfigMaps(jobSpec models.JobSpec, runName string,
 		if err != nil {
 			return nil, nil, errors.Wrapf(err, "requested hook not found %s", runName)
 		}
+		hookConfig := map[string]string{}
 		for _, val := range hook.Config {
-			hookMap[val.Name] = val.Value
+			hookConfig[val.Name] = val.Value
+		}
+		for key, val := range fm.withDeploymentOverrides(hookConfig) {
+			hookMap[key] = val
 		}
 	}
 	return transformationMap, hookMap, nil
 }
 
+// withDeploymentOverrides resolves configs keyed for the selected deployment
+// over the configs they override, dropping overrides of other deployments
+func (fm *ContextManager) withDeploymentOverrides(config map[string]string) map[string]string {
+	resolved := map[string]string{}
+	overrides := map[string]string{}
+	for key, val := range config {
+		idx := strings.LastIndex(key, DeploymentSeparator)
+		if idx < 0 {
+			resolved[key] = val
+			continue
+		}
+		if fm.deployment != "" && key[idx+len(DeploymentSeparator):] == fm.deployment {
+			overrides[key[:idx]] = val
+		}
+	}
+	for key, val := range overrides {
+		resolved[key] = val
+	}
+	return resolved
+}
+
 func NewContextManager(namespace models.NamespaceSpec, jobSpec models.JobSpec, engine models.TemplateEngine) *ContextManager {
 	return &ContextManager{
-		namespace: namespace,
-		jobSpec:   jobSpec,
-		engine:    engine,
+		namespace:           namespace,
+		jobSpec:             jobSpec,
+		engine:              engine,
+		deprecatedVariables: map[string]string{},
+		metrics:             models.NoopMetrics{},
 	}
 }
 
@@ -2,8 +2,13 @@ package instance_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,6 +16,7 @@ import (
 	"github.com/odpf/optimus/mock"
 	"github.com/odpf/optimus/models"
 	"github.com/stretchr/testify/assert"
+	mock2 "github.com/stretchr/testify/mock"
 )
 
 func TestContextManager(t *testing.T) {
@@ -130,7 +136,7 @@ func TestContextManager(t *testing.T) {
 			}}, nil)
 
 			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec,
-				instance.NewGoEngine()).Generate(instanceSpec, models.InstanceTypeTask, "bq")
+				newGoEngine(t)).Generate(instanceSpec, models.InstanceTypeTask, "bq")
 			assert.Nil(t, err)
 
 			assert.Equal(t, "2020-11-11T00:00:00Z", envMap["DEND"])
@@ -283,8 +289,8 @@ func TestContextManager(t *testing.T) {
 				},
 			}}, nil)
 
-			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, instance.NewGoEngine()).Generate(
-				instanceSpec, models.InstanceTypeHook, transporterHook)
+			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+				instanceSpec, models.InstanceTypeHook, transporterHook, instance.WithMissingKey(instance.MissingKeyInvalid))
 			assert.Nil(t, err)
 
 			assert.Equal(t, "2020-11-11T00:00:00Z", envMap["DEND"])
@@ -418,7 +424,7 @@ func TestContextManager(t *testing.T) {
 				},
 			}}, nil)
 
-			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, instance.NewGoEngine()).Generate(instanceSpec, models.InstanceTypeTask, "bq")
+			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(instanceSpec, models.InstanceTypeTask, "bq")
 			assert.Nil(t, err)
 
 			assert.Equal(t, "2020-11-11T00:00:00Z", envMap["DEND"])
@@ -435,5 +441,1161 @@ func TestContextManager(t *testing.T) {
 				fileMap["query.sql"],
 			)
 		})
+		t.Run("should render configs and assets of the task", func(t *testing.T) {
+			envNameRules := instance.EnvNameRules{
+				MaxLength: 32,
+				Reserved:  instance.DefaultReservedEnvNames,
+			}
+			projectSecrets := models.ProjectSecrets{
+				{
+					Name:  "api_token",
+					Value: "project-token",
+				},
+				{
+					Name:  "pii_key",
+					Value: "k3y",
+				},
+			}
+			testCases := []struct {
+				Name    string
+				Configs models.JobSpecConfigs
+				Assets  []models.JobSpecAsset
+				Prepare func(namespaceSpec *models.NamespaceSpec, jobSpec *models.JobSpec, instanceSpec *models.InstanceSpec)
+				Setup   func(contextManager *instance.ContextManager)
+				Options []instance.GenerateOption
+
+				Envs     map[string]string
+				NoEnvs   []string
+				Files    map[string]string
+				Warnings []instance.Warning
+				Err      string
+			}{
+				{
+					Name:    "should render variables missing in context as empty with zero policy",
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where id = '{{.UNKNOWN}}'"}},
+					Options: []instance.GenerateOption{instance.WithMissingKey(instance.MissingKeyZero)},
+					Files:   map[string]string{"query.sql": "select * from table where id = ''"},
+				},
+				{
+					Name:    "should render variables missing in context as placeholder with invalid policy",
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where id = '{{.UNKNOWN}}'"}},
+					Options: []instance.GenerateOption{instance.WithMissingKey(instance.MissingKeyInvalid)},
+					Files:   map[string]string{"query.sql": "select * from table where id = '<no value>'"},
+				},
+				{
+					Name:    "should fail on variables missing in context with error policy",
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where id = '{{.UNKNOWN}}'"}},
+					Options: []instance.GenerateOption{instance.WithMissingKey(instance.MissingKeyError)},
+					Err:     "no entry for key",
+				},
+				{
+					Name:    "should fail on variables missing in context by default",
+					Configs: models.JobSpecConfigs{{Name: "UNKNOWN", Value: "{{.task.TT}}"}},
+					Err:     "no entry for key",
+				},
+				{
+					Name:    "should fail for an unknown missing key policy",
+					Options: []instance.GenerateOption{instance.WithMissingKey("skip")},
+					Err:     "invalid missing key policy: skip",
+				},
+				{
+					Name:    "should expose run conf passed at trigger time as variables",
+					Configs: models.JobSpecConfigs{{Name: "REGION", Value: "{{.CONF__region}}"}},
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from table where region = '{{.CONF__region}}' limit {{.CONF__limit}}"},
+					},
+					Prepare: func(_ *models.NamespaceSpec, _ *models.JobSpec, instanceSpec *models.InstanceSpec) {
+						instanceSpec.Data = append(instanceSpec.Data, models.InstanceSpecData{
+							Name:  "region",
+							Value: "apac",
+							Type:  models.InstanceDataTypeConf,
+						}, models.InstanceSpecData{
+							Name:  "limit",
+							Value: "10",
+							Type:  models.InstanceDataTypeConf,
+						})
+					},
+					Envs:  map[string]string{"REGION": "apac", "CONF__region": "apac"},
+					Files: map[string]string{"query.sql": "select * from table where region = 'apac' limit 10"},
+				},
+				{
+					Name:    "should resolve deprecated variable and warn about its usage",
+					Configs: models.JobSpecConfigs{{Name: "SCHEDULED", Value: "{{.SCHEDULE_TIME}}"}},
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where event_timestamp > '{{.SCHEDULE_TIME}}'"}},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.DeprecateVariable("SCHEDULE_TIME", instance.ConfigKeyExecutionTime)
+					},
+					Envs:     map[string]string{"SCHEDULED": "2020-11-11T02:00:00Z"},
+					Files:    map[string]string{"query.sql": "select * from table where event_timestamp > '2020-11-11T02:00:00Z'"},
+					Warnings: []instance.Warning{"variable SCHEDULE_TIME is deprecated, use EXECUTION_TIME instead"},
+				},
+				{
+					Name:   "should not warn when deprecated variables are not used",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where event_timestamp > '{{.EXECUTION_TIME}}'"}},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.DeprecateVariable("SCHEDULE_TIME", instance.ConfigKeyExecutionTime)
+					},
+					Warnings: []instance.Warning{},
+				},
+				{
+					Name:    "should normalize line endings of rendered assets when asked",
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select *\r\nfrom table\r\nwhere event_timestamp > '{{.EXECUTION_TIME}}'\r\n"}},
+					Options: []instance.GenerateOption{instance.WithLFLineEndings()},
+					Files:   map[string]string{"query.sql": "select *\nfrom table\nwhere event_timestamp > '2020-11-11T02:00:00Z'\n"},
+				},
+				{
+					Name:   "should keep line endings of rendered assets by default",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select *\r\nfrom table\r\nwhere event_timestamp > '{{.EXECUTION_TIME}}'\r\n"}},
+					Files:  map[string]string{"query.sql": "select *\r\nfrom table\r\nwhere event_timestamp > '2020-11-11T02:00:00Z'\r\n"},
+				},
+				{
+					Name:   "should compile templated asset file names",
+					Assets: []models.JobSpecAsset{{Name: "report_{{ .DSTART | Date }}.sql", Value: "select * from table where event_timestamp >= '{{.DSTART}}'"}},
+					Files:  map[string]string{"report_2020-11-10.sql": "select * from table where event_timestamp >= '2020-11-10T00:00:00Z'"},
+				},
+				{
+					Name:   "should fail if templated asset file name is not a safe file name",
+					Assets: []models.JobSpecAsset{{Name: "{{.GLOBAL__bucket}}.sql", Value: "select 1"}},
+					Err:    "compiles to an invalid name",
+				},
+				{
+					Name:   "should tell assets the instance is not a catchup run",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table{{if .IS_CATCHUP}}_sampled{{end}}"}},
+					Prepare: func(_ *models.NamespaceSpec, _ *models.JobSpec, instanceSpec *models.InstanceSpec) {
+						instanceSpec.Data[0].Value = time.Date(2020, 11, 11, 2, 10, 0, 0, time.UTC).Format(models.InstanceScheduledAtTimeLayout)
+					},
+					Files: map[string]string{"query.sql": "select * from table"},
+				},
+				{
+					Name:   "should tell assets the instance is a catchup run",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table{{if .IS_CATCHUP}}_sampled{{end}}"}},
+					Prepare: func(_ *models.NamespaceSpec, _ *models.JobSpec, instanceSpec *models.InstanceSpec) {
+						instanceSpec.Data[0].Value = time.Date(2020, 11, 14, 5, 0, 0, 0, time.UTC).Format(models.InstanceScheduledAtTimeLayout)
+					},
+					Files: map[string]string{"query.sql": "select * from table_sampled"},
+				},
+				{
+					Name: "should inline snippets included from shared library",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "{{ libInclude \"udfs/clean.sql\" }}\nselect clean(name) from table\n{{ libInclude \"udfs/clean.sql\" }}"},
+					},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config[models.ProjectSharedLibPathKey] = "gs://shared-bucket/snippets"
+					},
+					Setup: func(contextManager *instance.ContextManager) {
+						reader := new(mock.ObjectReader)
+						reader.On("NewReader", "shared-bucket", "snippets/udfs/clean.sql").Return(
+							ioutil.NopCloser(strings.NewReader("create temp function clean(x string) as (trim(x));")), nil).Once()
+						contextManager.SetLibReader(reader)
+					},
+					Files: map[string]string{"query.sql": "create temp function clean(x string) as (trim(x));\nselect clean(name) from table\n" +
+						"create temp function clean(x string) as (trim(x));"},
+				},
+				{
+					Name:   "should fail to include snippets outside shared library",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "{{ libInclude \"../secrets.sql\" }}"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config[models.ProjectSharedLibPathKey] = "gs://shared-bucket/snippets"
+					},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetLibReader(new(mock.ObjectReader))
+					},
+					Err: "invalid shared library snippet path ../secrets.sql",
+				},
+				{
+					Name:   "should use default window of project for jobs without a window",
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from table where ts >= '{{.DSTART}}' and ts < '{{.DEND}}'"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, jobSpec *models.JobSpec, _ *models.InstanceSpec) {
+						jobSpec.Task.Window = models.JobSpecTaskWindow{}
+						namespaceSpec.ProjectSpec.Config[models.ProjectDefaultWindowSizeKey] = "48h"
+						namespaceSpec.ProjectSpec.Config[models.ProjectDefaultWindowTruncateToKey] = "d"
+					},
+					Envs:  map[string]string{"DSTART": "2020-11-09T00:00:00Z", "DEND": "2020-11-11T00:00:00Z"},
+					Files: map[string]string{"query.sql": "select * from table where ts >= '2020-11-09T00:00:00Z' and ts < '2020-11-11T00:00:00Z'"},
+				},
+				{
+					Name: "should prefer window of the job over default window of project",
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config[models.ProjectDefaultWindowSizeKey] = "48h"
+					},
+					Envs: map[string]string{"DSTART": "2020-11-10T00:00:00Z"},
+				},
+				{
+					Name:    "should warn for defaulted window and empty configs",
+					Configs: models.JobSpecConfigs{{Name: "LABELS", Value: "{{.GLOBAL__labels}}"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, jobSpec *models.JobSpec, _ *models.InstanceSpec) {
+						jobSpec.Task.Window = models.JobSpecTaskWindow{}
+						namespaceSpec.ProjectSpec.Config[models.ProjectDefaultWindowSizeKey] = "48h"
+						namespaceSpec.ProjectSpec.Config[models.ProjectDefaultWindowTruncateToKey] = "d"
+					},
+					Options: []instance.GenerateOption{instance.WithMissingKey(instance.MissingKeyZero)},
+					Envs:    map[string]string{"LABELS": ""},
+					Warnings: []instance.Warning{
+						"window of job foo not configured, defaulted to window of project humara-projectSpec",
+						"config LABELS is empty",
+					},
+				},
+				{
+					Name: "should sanitize env keys to POSIX safe names when asked",
+					Configs: models.JobSpecConfigs{
+						{Name: "my-config.key", Value: "first"},
+						{Name: "my_config_key", Value: "second"},
+					},
+					Options: []instance.GenerateOption{instance.WithPOSIXEnvKeys()},
+					Envs:    map[string]string{"MY_CONFIG_KEY": "first"},
+					NoEnvs:  []string{"my-config.key"},
+					Warnings: []instance.Warning{
+						"env my_config_key collides with my-config.key as MY_CONFIG_KEY, keeping value of my-config.key",
+					},
+				},
+				{
+					Name: "should iterate over partitions of the window in templates",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "{{ range partitions }}select * from t where dt = '{{ Date . }}';\n{{ end }}"},
+						{Name: "hours.txt", Value: `{{ len (partitions "h") }}`},
+					},
+					Prepare: func(_ *models.NamespaceSpec, _ *models.JobSpec, instanceSpec *models.InstanceSpec) {
+						instanceSpec.Data[1].Value = "2020-11-08T00:00:00Z"
+					},
+					Files: map[string]string{
+						"query.sql": "select * from t where dt = '2020-11-08';\n" +
+							"select * from t where dt = '2020-11-09';\n" +
+							"select * from t where dt = '2020-11-10';\n",
+						"hours.txt": "72",
+					},
+				},
+				{
+					Name: "should resolve globals with job over project over org precedence",
+					Configs: models.JobSpecConfigs{
+						{Name: "REGION", Value: "{{.GLOBAL__region}}"},
+						{Name: "BUCKET", Value: "{{.GLOBAL__bucket}}"},
+						{Name: "DATASET", Value: "{{.GLOBAL__dataset}}"},
+					},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["dataset"] = "project_dataset"
+					},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetOrgConfig(map[string]string{
+							"region":  "asia-southeast1",
+							"bucket":  "gs://org_folder",
+							"dataset": "org_dataset",
+						})
+						contextManager.SetJobGlobalConfig(map[string]string{
+							"dataset": "job_dataset",
+						})
+					},
+					Envs: map[string]string{"REGION": "asia-southeast1", "BUCKET": "gs://some_folder", "DATASET": "job_dataset"},
+				},
+				{
+					Name: "should render schedule of the job in templates",
+					Configs: models.JobSpecConfigs{
+						{Name: "CRON", Value: "{{.SCHEDULE_INTERVAL}}"},
+						{Name: "SINCE", Value: "{{.START_DATE}}"},
+					},
+					Envs: map[string]string{"CRON": "0 2 * * *", "SINCE": "2000-11-11"},
+				},
+				{
+					Name: "should keep assets rendering to whitespace by default",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select 1"},
+						{Name: "cleanup.sql", Value: "{{ if .IS_CATCHUP }}delete from t{{ end }}\n  "},
+					},
+					Files: map[string]string{"query.sql": "select 1", "cleanup.sql": "\n  "},
+				},
+				{
+					Name: "should fail for assets rendering to whitespace when asked",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select 1"},
+						{Name: "cleanup.sql", Value: "{{ if .IS_CATCHUP }}delete from t{{ end }}\n  "},
+					},
+					Options: []instance.GenerateOption{instance.WithNonEmptyAssets()},
+					Err:     "asset cleanup.sql is empty after rendering",
+				},
+				{
+					Name:    "should resolve referenced secrets from the secret provider",
+					Configs: models.JobSpecConfigs{{Name: "SECRET__TOKEN", Value: "{{.SECRET__api_token}}"}},
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select '{{.SECRET__api_token}}'"}},
+					Setup: func(contextManager *instance.ContextManager) {
+						secretProvider := new(mock.SecretProvider)
+						secretProvider.On("Get", "api_token").Return("vault-token", nil).Once()
+						contextManager.SetSecretProvider(secretProvider)
+					},
+					Envs:  map[string]string{"SECRET__TOKEN": "vault-token"},
+					Files: map[string]string{"query.sql": "select 'vault-token'"},
+				},
+				{
+					Name:    "should resolve referenced secrets from the project by default",
+					Configs: models.JobSpecConfigs{{Name: "TOKEN", Value: "{{.SECRET__api_token}}"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Secret = projectSecrets
+					},
+					Envs: map[string]string{"TOKEN": "project-token"},
+				},
+				{
+					Name:    "should fail for referenced secrets missing from the project",
+					Configs: models.JobSpecConfigs{{Name: "TOKEN", Value: "{{.SECRET__api_token}}"}},
+					Err:     "failed to resolve SECRET__api_token: secret api_token not found",
+				},
+				{
+					Name: "should escape env values for shell when asked",
+					Configs: models.JobSpecConfigs{
+						{Name: "QUERY", Value: "select * from t where name = 'a b'"},
+						{Name: "PRICE", Value: "$100"},
+					},
+					Options: []instance.GenerateOption{instance.WithShellEscapedEnvs()},
+					Envs:    map[string]string{"QUERY": `'select * from t where name = '"'"'a b'"'"''`, "PRICE": "'$100'"},
+				},
+				{
+					Name: "should keep assets rendering to malformed json unless validated",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from (select 1)"},
+						{Name: "schema.json", Value: `{"partition": "{{.DSTART}}",}`},
+					},
+					Files: map[string]string{"query.sql": "select * from (select 1)", "schema.json": `{"partition": "2020-11-10T00:00:00Z",}`},
+				},
+				{
+					Name: "should fail for assets rendering to malformed json when validated",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from (select 1)"},
+						{Name: "schema.json", Value: `{"partition": "{{.DSTART}}",}`},
+					},
+					Options: []instance.GenerateOption{instance.WithAssetValidation(nil)},
+					Err:     "asset schema.json is not valid after rendering: invalid json",
+				},
+				{
+					Name:    "should template with inclusive end of the window",
+					Configs: models.JobSpecConfigs{{Name: "FILTER", Value: "ts >= '{{.DSTART}}' and ts <= '{{.DEND_INCLUSIVE}}'"}},
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: "select * from t where ts < '{{.DEND}}' and ts <= '{{.DEND_INCLUSIVE}}'"}},
+					Envs:    map[string]string{"FILTER": "ts >= '2020-11-10T00:00:00Z' and ts <= '2020-11-10T23:59:59Z'"},
+					NoEnvs:  []string{"DEND_INCLUSIVE"},
+					Files:   map[string]string{"query.sql": "select * from t where ts < '2020-11-11T00:00:00Z' and ts <= '2020-11-10T23:59:59Z'"},
+				},
+				{
+					Name: "should warn for names of generated envs breaking the rules",
+					Configs: models.JobSpecConfigs{
+						{Name: "DESTINATION_TABLE_OF_THE_DAILY_AGGREGATES", Value: "events"},
+						{Name: "PATH", Value: "/tmp"},
+					},
+					Options: []instance.GenerateOption{instance.WithEnvNameRules(envNameRules)},
+					Envs:    map[string]string{"PATH": "/tmp"},
+					Warnings: []instance.Warning{
+						"env DESTINATION_TABLE_OF_THE_DAILY_AGGREGATES is longer than 32 characters",
+						"env PATH collides with a reserved name",
+					},
+				},
+				{
+					Name: "should fail for names of generated envs longer than allowed with strict rules",
+					Configs: models.JobSpecConfigs{
+						{Name: "DESTINATION_TABLE_OF_THE_DAILY_AGGREGATES", Value: "events"},
+						{Name: "PATH", Value: "/tmp"},
+					},
+					Options: []instance.GenerateOption{instance.WithEnvNameRules(instance.EnvNameRules{
+						MaxLength: 32,
+						Reserved:  instance.DefaultReservedEnvNames,
+						Strict:    true,
+					})},
+					Err: "env DESTINATION_TABLE_OF_THE_DAILY_AGGREGATES is longer than 32 characters",
+				},
+				{
+					Name: "should fail for names of generated envs which are reserved with strict rules",
+					Configs: models.JobSpecConfigs{
+						{Name: "DESTINATION_TABLE_OF_THE_DAILY_AGGREGATES", Value: "events"},
+						{Name: "PATH", Value: "/tmp"},
+					},
+					Options: []instance.GenerateOption{instance.WithEnvNameRules(instance.EnvNameRules{
+						Reserved: instance.DefaultReservedEnvNames,
+						Strict:   true,
+					})},
+					Err: "env PATH collides with a reserved name",
+				},
+				{
+					Name:    "should prefix keys of generated envs when asked",
+					Configs: models.JobSpecConfigs{{Name: "BUCKET", Value: "{{.GLOBAL__bucket}}"}},
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from t where ts >= '{{.DSTART}}' and path = '{{.GLOBAL__bucket}}'"},
+					},
+					Options: []instance.GenerateOption{instance.WithEnvKeyPrefix("FOO_")},
+					Envs:    map[string]string{"FOO_BUCKET": "gs://some_folder", "FOO_DSTART": "2020-11-10T00:00:00Z"},
+					NoEnvs:  []string{"BUCKET", "DSTART"},
+					Files:   map[string]string{"query.sql": "select * from t where ts >= '2020-11-10T00:00:00Z' and path = 'gs://some_folder'"},
+				},
+				{
+					Name: "should resolve config overrides of the selected deployment",
+					Configs: models.JobSpecConfigs{
+						{Name: "REGION", Value: "{{.GLOBAL__region}}"},
+						{Name: "DATASET", Value: "events"},
+						{Name: "DATASET@staging", Value: "events_staging"},
+					},
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from {{.GLOBAL__region}}.t"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["region"] = "asia"
+						namespaceSpec.ProjectSpec.Config["region@prod"] = "europe"
+						namespaceSpec.ProjectSpec.Config["region@staging"] = "us"
+					},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetDeployment("staging")
+					},
+					Envs:   map[string]string{"REGION": "us", "DATASET": "events_staging"},
+					NoEnvs: []string{"DATASET@staging"},
+					Files:  map[string]string{"query.sql": "select * from us.t"},
+				},
+				{
+					Name: "should resolve configs without overrides of the selected deployment",
+					Configs: models.JobSpecConfigs{
+						{Name: "REGION", Value: "{{.GLOBAL__region}}"},
+						{Name: "DATASET", Value: "events"},
+						{Name: "DATASET@staging", Value: "events_staging"},
+					},
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from {{.GLOBAL__region}}.t"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["region"] = "asia"
+						namespaceSpec.ProjectSpec.Config["region@prod"] = "europe"
+						namespaceSpec.ProjectSpec.Config["region@staging"] = "us"
+					},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetDeployment("prod")
+					},
+					Envs:   map[string]string{"REGION": "europe", "DATASET": "events"},
+					NoEnvs: []string{"DATASET@staging"},
+					Files:  map[string]string{"query.sql": "select * from europe.t"},
+				},
+				{
+					Name: "should resolve configs without overrides when no deployment is selected",
+					Configs: models.JobSpecConfigs{
+						{Name: "REGION", Value: "{{.GLOBAL__region}}"},
+						{Name: "DATASET", Value: "events"},
+						{Name: "DATASET@staging", Value: "events_staging"},
+					},
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from {{.GLOBAL__region}}.t"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["region"] = "asia"
+						namespaceSpec.ProjectSpec.Config["region@prod"] = "europe"
+						namespaceSpec.ProjectSpec.Config["region@staging"] = "us"
+					},
+					Envs:   map[string]string{"REGION": "asia", "DATASET": "events"},
+					NoEnvs: []string{"DATASET@staging"},
+					Files:  map[string]string{"query.sql": "select * from asia.t"},
+				},
+				{
+					Name: "should keep whitespace around rendered values by default",
+					Configs: models.JobSpecConfigs{
+						{Name: "SOURCE", Value: "{{.GLOBAL__dataset}}.events"},
+					},
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from {{.GLOBAL__dataset}}.events where ts >= '{{.DSTART}}'"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["dataset"] = " playground\n"
+					},
+					Envs:  map[string]string{"SOURCE": " playground\n.events"},
+					Files: map[string]string{"query.sql": "select * from  playground\n.events where ts >= '2020-11-10T00:00:00Z'"},
+				},
+				{
+					Name: "should trim whitespace around rendered values when asked",
+					Configs: models.JobSpecConfigs{
+						{Name: "TABLE", Value: "  events\n"},
+						{Name: "SOURCE", Value: "{{.GLOBAL__dataset}}.events"},
+					},
+					Assets: []models.JobSpecAsset{{Name: "query.sql", Value: "select * from {{.GLOBAL__dataset}}.events where ts >= '{{.DSTART}}'"}},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["dataset"] = " playground\n"
+					},
+					Options: []instance.GenerateOption{instance.WithTrimmedValues()},
+					Envs:    map[string]string{"SOURCE": "playground.events", "TABLE": "  events\n"},
+					Files:   map[string]string{"query.sql": "select * from playground.events where ts >= '2020-11-10T00:00:00Z'"},
+				},
+				{
+					Name:    "should render for absence of optional secrets",
+					Configs: models.JobSpecConfigs{{Name: "AUTH_MODE", Value: `{{ if hasSecret "api_token" }}token{{ else }}anonymous{{ end }}`}},
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: `select * from t{{ if hasSecret "pii_key" }} where decrypt(email) is not null{{ end }}`},
+					},
+					Envs:  map[string]string{"AUTH_MODE": "anonymous"},
+					Files: map[string]string{"query.sql": "select * from t"},
+				},
+				{
+					Name:    "should render for presence of optional secrets",
+					Configs: models.JobSpecConfigs{{Name: "AUTH_MODE", Value: `{{ if hasSecret "api_token" }}token{{ else }}anonymous{{ end }}`}},
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: `select * from t{{ if hasSecret "pii_key" }} where decrypt(email) is not null{{ end }}`},
+					},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Secret = projectSecrets
+					},
+					Envs:   map[string]string{"AUTH_MODE": "token"},
+					NoEnvs: []string{"SECRET__api_token"},
+					Files:  map[string]string{"query.sql": "select * from t where decrypt(email) is not null"},
+				},
+				{
+					Name:    "should fail if presence of a secret can't be checked",
+					Configs: models.JobSpecConfigs{{Name: "AUTH_MODE", Value: `{{ if hasSecret "api_token" }}token{{ end }}`}},
+					Setup: func(contextManager *instance.ContextManager) {
+						secretProvider := new(mock.SecretProvider)
+						secretProvider.On("Get", "api_token").Return("", errors.New("vault unreachable"))
+						contextManager.SetSecretProvider(secretProvider)
+					},
+					Err: "failed to check secret api_token: vault unreachable",
+				},
+				{
+					Name:    "should resolve outputs of upstream jobs",
+					Configs: models.JobSpecConfigs{{Name: "SOURCE_PATH", Value: `{{ upstream "producer" "output_path" }}`}},
+					Assets:  []models.JobSpecAsset{{Name: "query.sql", Value: `load data from '{{ upstream "producer" "output_path" }}/*.parquet'`}},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetUpstreamLookup(instance.UpstreamOutputs{
+							"producer": {
+								"output_path": "gs://bucket/producer/2020-11-10",
+							},
+						})
+					},
+					Envs:  map[string]string{"SOURCE_PATH": "gs://bucket/producer/2020-11-10"},
+					Files: map[string]string{"query.sql": "load data from 'gs://bucket/producer/2020-11-10/*.parquet'"},
+				},
+				{
+					Name:    "should fail for outputs upstream jobs don't have",
+					Configs: models.JobSpecConfigs{{Name: "SOURCE_PATH", Value: `{{ upstream "producer" "output_path" }}`}},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetUpstreamLookup(instance.UpstreamOutputs{
+							"producer": {},
+						})
+					},
+					Err: "failed to resolve output output_path of upstream job producer: upstream job producer has no output output_path",
+				},
+				{
+					Name:    "should fail for outputs of unknown upstream jobs",
+					Configs: models.JobSpecConfigs{{Name: "SOURCE_PATH", Value: `{{ upstream "producer" "output_path" }}`}},
+					Setup: func(contextManager *instance.ContextManager) {
+						contextManager.SetUpstreamLookup(instance.UpstreamOutputs{})
+					},
+					Err: "unknown upstream job producer",
+				},
+				{
+					Name: "should render assets within max size",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from t where dt >= '{{.DSTART}}'"},
+						{Name: "cleanup.sql", Value: "delete from t"},
+					},
+					Options: []instance.GenerateOption{instance.WithMaxAssetSize(64)},
+					Files:   map[string]string{"query.sql": "select * from t where dt >= '2020-11-10T00:00:00Z'", "cleanup.sql": "delete from t"},
+				},
+				{
+					Name: "should fail for assets rendering above max size when asked",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "select * from t where dt >= '{{.DSTART}}'"},
+						{Name: "cleanup.sql", Value: "delete from t"},
+					},
+					Options: []instance.GenerateOption{instance.WithMaxAssetSize(32)},
+					Err:     "asset query.sql is 50 bytes after rendering, exceeding max of 32 bytes",
+				},
+				{
+					Name: "should iterate yaml list configs in assets",
+					Assets: []models.JobSpecAsset{
+						{Name: "query.sql", Value: "{{ range $i, $table := fromYaml .GLOBAL__tables }}{{ if $i }}\nunion all\n{{ end }}select * from {{ $table }}{{ end }}"},
+					},
+					Prepare: func(namespaceSpec *models.NamespaceSpec, _ *models.JobSpec, _ *models.InstanceSpec) {
+						namespaceSpec.ProjectSpec.Config["tables"] = "- events\n- clicks\n"
+					},
+					Files: map[string]string{"query.sql": "select * from events\nunion all\nselect * from clicks"},
+				},
+			}
+			for _, testCase := range testCases {
+				t.Run(testCase.Name, func(t *testing.T) {
+					namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(testCase.Configs, testCase.Assets)
+					if testCase.Prepare != nil {
+						testCase.Prepare(&namespaceSpec, &jobSpec, &instanceSpec)
+					}
+					contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+					if testCase.Setup != nil {
+						testCase.Setup(contextManager)
+					}
+
+					envMap, fileMap, warnings, err := contextManager.GenerateWithWarnings(
+						instanceSpec, models.InstanceTypeTask, "bq", testCase.Options...)
+					if testCase.Err != "" {
+						assert.NotNil(t, err)
+						if err != nil {
+							assert.Contains(t, err.Error(), testCase.Err)
+						}
+						return
+					}
+					assert.Nil(t, err)
+					for key, value := range testCase.Envs {
+						assert.Equal(t, value, envMap[key], key)
+					}
+					for _, key := range testCase.NoEnvs {
+						assert.NotContains(t, envMap, key)
+					}
+					if testCase.Files != nil {
+						assert.Equal(t, testCase.Files, fileMap)
+					}
+					if testCase.Warnings != nil {
+						assert.ElementsMatch(t, testCase.Warnings, warnings)
+					}
+				})
+			}
+		})
+		t.Run("should render assets using custom template functions", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select * from {{ tableFor .JOB_DESTINATION }}",
+				},
+			})
+			engine := newGoEngine(t, instance.WithFuncs(template.FuncMap{
+				"tableFor": func(destination string) string {
+					return "`" + destination + "`"
+				},
+			}))
+			instanceSpec.Data = append(instanceSpec.Data, models.InstanceSpecData{
+				Name:  "JOB_DESTINATION",
+				Value: "proj.dataset.table",
+				Type:  models.InstanceDataTypeEnv,
+			})
+
+			_, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, engine).Generate(
+				instanceSpec, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, "select * from `proj.dataset.table`", fileMap["query.sql"])
+		})
+		t.Run("should template hook configs with values published by hooks running before it", func(t *testing.T) {
+			newHook := func(name string, hookType models.HookType, configs models.JobSpecConfigs, dependsOn ...*models.JobSpecHook) models.JobSpecHook {
+				hookUnit := new(mock.BasePlugin)
+				hookUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+					Name:       name,
+					PluginType: models.PluginTypeHook,
+					HookType:   hookType,
+				}, nil)
+				return models.JobSpecHook{
+					Config:    configs,
+					Unit:      &models.Plugin{Base: hookUnit},
+					DependsOn: dependsOn,
+				}
+			}
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+			instanceSpec.Data = append(instanceSpec.Data, models.InstanceSpecData{
+				Name:  "transporter__TOPIC",
+				Value: "bq-events",
+				Type:  models.InstanceDataTypeHookOutput,
+			})
+
+			t.Run("should consume value published by an earlier hook", func(t *testing.T) {
+				transporter := newHook("transporter", models.HookTypePre, models.JobSpecConfigs{})
+				predator := newHook("predator", models.HookTypePost, models.JobSpecConfigs{
+					{
+						Name:  "SOURCE_TOPIC",
+						Value: "{{.HOOK__transporter__TOPIC}}",
+					},
+				})
+				jobSpec.Hooks = []models.JobSpecHook{transporter, predator}
+
+				envMap, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+					instanceSpec, models.InstanceTypeHook, "predator")
+				assert.Nil(t, err)
+				assert.Equal(t, "bq-events", envMap["SOURCE_TOPIC"])
+			})
+			t.Run("should fail for reference to a hook not running before it", func(t *testing.T) {
+				transporter := newHook("transporter", models.HookTypePost, models.JobSpecConfigs{})
+				predator := newHook("predator", models.HookTypePost, models.JobSpecConfigs{
+					{
+						Name:  "SOURCE_TOPIC",
+						Value: "{{.HOOK__transporter__TOPIC}}",
+					},
+				})
+				jobSpec.Hooks = []models.JobSpecHook{transporter, predator}
+
+				_, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+					instanceSpec, models.InstanceTypeHook, "predator")
+				assert.NotNil(t, err)
+			})
+			t.Run("should consume value published by a hook it depends on", func(t *testing.T) {
+				transporter := newHook("transporter", models.HookTypePost, models.JobSpecConfigs{})
+				predator := newHook("predator", models.HookTypePost, models.JobSpecConfigs{
+					{
+						Name:  "SOURCE_TOPIC",
+						Value: "{{.HOOK__transporter__TOPIC}}",
+					},
+				}, &transporter)
+				jobSpec.Hooks = []models.JobSpecHook{transporter, predator}
+
+				envMap, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+					instanceSpec, models.InstanceTypeHook, "predator")
+				assert.Nil(t, err)
+				assert.Equal(t, "bq-events", envMap["SOURCE_TOPIC"])
+			})
+		})
+		t.Run("should record metrics of generation", func(t *testing.T) {
+			labels := map[string]string{"run_type": "task"}
+
+			t.Run("for a successful render", func(t *testing.T) {
+				namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+				metrics := new(mock.MetricsRecorder)
+				metrics.On("IncCounter", "instance_generate_total", labels).Return()
+				metrics.On("ObserveDuration", "instance_generate_duration", labels, mock2.Anything).Return()
+				defer metrics.AssertExpectations(t)
+
+				contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+				contextManager.SetMetrics(metrics)
+				_, _, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq")
+				assert.Nil(t, err)
+				metrics.AssertNotCalled(t, "IncCounter", "instance_generate_errors_total", labels)
+			})
+			t.Run("for a failed render", func(t *testing.T) {
+				namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+					{
+						Name:  "query.sql",
+						Value: "select * from {{.UNKNOWN}}",
+					},
+				})
+				metrics := new(mock.MetricsRecorder)
+				metrics.On("IncCounter", "instance_generate_total", labels).Return()
+				metrics.On("IncCounter", "instance_generate_errors_total", labels).Return()
+				metrics.On("ObserveDuration", "instance_generate_duration", labels, mock2.Anything).Return()
+				defer metrics.AssertExpectations(t)
+
+				contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+				contextManager.SetMetrics(metrics)
+				_, _, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq")
+				assert.NotNil(t, err)
+			})
+		})
+		t.Run("should template with extra variables having lowest precedence", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "OWNER",
+					Value: "{{.OWNER}}",
+				},
+				{
+					Name:  "BUCKET",
+					Value: "{{.GLOBAL__bucket}}",
+				},
+			}, nil)
+
+			envMap, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).GenerateWith(
+				instanceSpec, map[string]string{
+					"OWNER":          "data-team",
+					"GLOBAL__bucket": "gs://shadowed",
+				}, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, "data-team", envMap["OWNER"])
+			assert.Equal(t, "gs://some_folder", envMap["BUCKET"])
+			assert.NotContains(t, envMap, "GLOBAL__bucket")
+		})
+		t.Run("should abort rendering exceeding the timeout", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select {{ slow }}",
+				},
+			})
+			release := make(chan struct{})
+			defer close(release)
+			engine := newGoEngine(t, instance.WithFuncs(template.FuncMap{
+				"slow": func() string {
+					<-release
+					return "1"
+				},
+			}))
+
+			began := time.Now()
+			_, _, err := instance.NewContextManager(namespaceSpec, jobSpec, engine).Generate(
+				instanceSpec, models.InstanceTypeTask, "bq", instance.WithRenderTimeout(50*time.Millisecond))
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+			assert.Less(t, int64(time.Since(began)), int64(time.Second))
+		})
+		t.Run("should not continue rendering after the timeout", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "{{ range items }}{{ tick }}{{ end }}",
+				},
+			})
+			var ticks int32
+			engine := newGoEngine(t, instance.WithFuncs(template.FuncMap{
+				"items": func() []int {
+					return make([]int, 100000)
+				},
+				"tick": func() string {
+					time.Sleep(time.Millisecond)
+					atomic.AddInt32(&ticks, 1)
+					return "x"
+				},
+			}))
+
+			_, _, err := instance.NewContextManager(namespaceSpec, jobSpec, engine).Generate(
+				instanceSpec, models.InstanceTypeTask, "bq", instance.WithRenderTimeout(20*time.Millisecond))
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+			// a tick in progress at the timeout may still finish
+			time.Sleep(10 * time.Millisecond)
+			ticksAfterTimeout := atomic.LoadInt32(&ticks)
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, ticksAfterTimeout, atomic.LoadInt32(&ticks))
+		})
+		t.Run("should abort rendering once the context is cancelled", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+				instanceSpec, models.InstanceTypeTask, "bq", instance.WithContext(ctx))
+			assert.NotNil(t, err)
+		})
+		t.Run("should fail for hooks referencing unknown task configs", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "BQ_VAL",
+					Value: "22",
+				},
+			}, nil)
+			hookUnit := new(mock.BasePlugin)
+			hookUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+				Name:       "transporter",
+				PluginType: models.PluginTypeHook,
+			}, nil)
+			jobSpec.Hooks = []models.JobSpecHook{
+				{
+					Config: models.JobSpecConfigs{
+						{
+							Name:  "INHERIT_CONFIG",
+							Value: "{{.TASK__BQ_VAL}}",
+						},
+						{
+							Name:  "TABLE",
+							Value: "{{.TASK__BQ_TABLE}}",
+						},
+					},
+					Unit: &models.Plugin{Base: hookUnit},
+				},
+			}
+
+			_, _, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+				instanceSpec, models.InstanceTypeHook, "transporter")
+			assert.True(t, errors.Is(err, models.ErrUnknownTaskReference))
+			assert.EqualError(t, err, "reference to unknown task config: config TABLE of hook transporter references TASK__BQ_TABLE")
+		})
+		t.Run("should generate for the reference time overriding schedule of the instance", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "WINDOW",
+					Value: "{{.DSTART}}/{{.DEND}}",
+				},
+			}, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select * from t where ts < '{{.EXECUTION_TIME}}'",
+				},
+			})
+			contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+
+			envMap, fileMap, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq",
+				instance.WithReferenceTime(time.Date(2021, 3, 5, 2, 0, 0, 0, time.UTC)))
+			assert.Nil(t, err)
+			assert.Equal(t, "2021-03-04T00:00:00Z/2021-03-05T00:00:00Z", envMap["WINDOW"])
+			assert.Equal(t, "select * from t where ts < '2021-03-05T02:00:00Z'", fileMap["query.sql"])
+
+			envMap, fileMap, err = contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq",
+				instance.WithReferenceTime(time.Date(2021, 7, 20, 2, 0, 0, 0, time.UTC)))
+			assert.Nil(t, err)
+			assert.Equal(t, "2021-07-19T00:00:00Z/2021-07-20T00:00:00Z", envMap["WINDOW"])
+			assert.Equal(t, "select * from t where ts < '2021-07-20T02:00:00Z'", fileMap["query.sql"])
+
+			// instance itself is left untouched
+			assert.Equal(t, time.Date(2020, 11, 11, 2, 0, 0, 0, time.UTC), instanceSpec.ScheduledAt)
+			assert.Equal(t, "2020-11-10T00:00:00Z", instanceSpec.Data[1].Value)
+		})
+		t.Run("should generate for the named task among subtasks", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "DATASET",
+					Value: "playground",
+				},
+				{
+					Name:  "TABLE",
+					Value: "events",
+				},
+			}, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select * from events",
+				},
+				{
+					Name:  "daily.sql",
+					Value: "select * from events where ts >= '{{.DSTART}}'",
+				},
+			})
+			jobSpec.Task.Subtasks = []models.JobSpecSubtask{
+				{
+					Name: "daily",
+					Config: models.JobSpecConfigs{
+						{
+							Name:  "TABLE",
+							Value: "{{.TASK_NAME}}_events",
+						},
+					},
+					Assets: []string{"daily.sql"},
+				},
+				{
+					Name: "hourly",
+				},
+			}
+			cliMod := new(mock.CLIMod)
+			cliMod.On("CompileAssets", mock2.Anything, mock2.MatchedBy(func(req models.CompileAssetsRequest) bool {
+				return len(req.Assets) == 1 && req.Assets[0].Name == "daily.sql"
+			})).Return(&models.CompileAssetsResponse{
+				Assets: models.PluginAssets{
+					{
+						Name:  "daily.sql",
+						Value: "select * from events where ts >= '{{.DSTART}}'",
+					},
+				},
+			}, nil)
+			defer cliMod.AssertExpectations(t)
+			jobSpec.Task.Unit.CLIMod = cliMod
+
+			envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).GenerateWith(
+				instanceSpec, map[string]string{"TASK_NAME": "daily"}, models.InstanceTypeTask, "daily")
+			assert.Nil(t, err)
+			assert.Equal(t, "playground", envMap["DATASET"])
+			assert.Equal(t, "daily_events", envMap["TABLE"])
+			assert.Equal(t, map[string]string{
+				"daily.sql": "select * from events where ts >= '2020-11-10T00:00:00Z'",
+			}, fileMap)
+
+			_, _, err = instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+				instanceSpec, models.InstanceTypeTask, "weekly")
+			assert.True(t, errors.Is(err, models.ErrNoSuchTask))
+		})
+		t.Run("should collect failures of a batch identifying the instances", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select * from t where ts >= '{{.DSTART}}'",
+				},
+			})
+			var instanceSpecs []models.InstanceSpec
+			for day := 0; day < 5; day++ {
+				batchInstance := instanceSpec
+				batchInstance.ID = uuid.Must(uuid.NewRandom())
+				batchInstance.ScheduledAt = instanceSpec.ScheduledAt.AddDate(0, 0, day)
+				if day == 1 || day == 3 {
+					batchInstance.Data = append([]models.InstanceSpecData{{
+						Name:  "broken.sql",
+						Value: "select '{{.UNKNOWN}}'",
+						Type:  models.InstanceDataTypeFile,
+					}}, instanceSpec.Data...)
+				}
+				instanceSpecs = append(instanceSpecs, batchInstance)
+			}
+
+			results := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).GenerateBatch(
+				instanceSpecs, models.InstanceTypeTask, "bq")
+			assert.Len(t, results, 5)
+			var failed []uuid.UUID
+			for i, result := range results {
+				assert.Equal(t, instanceSpecs[i].ID, result.InstanceID)
+				assert.Equal(t, instanceSpecs[i].ScheduledAt, result.ScheduledAt)
+				if result.Err != nil {
+					assert.Nil(t, result.FileMap)
+					failed = append(failed, result.InstanceID)
+					continue
+				}
+				assert.Equal(t, "select * from t where ts >= '2020-11-10T00:00:00Z'", result.FileMap["query.sql"])
+			}
+			assert.Equal(t, []uuid.UUID{instanceSpecs[1].ID, instanceSpecs[3].ID}, failed)
+		})
+		t.Run("should mask secret sourced values in masked copies", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "SECRET__TOKEN",
+					Value: "{{.SECRET__api_token}}",
+				},
+				{
+					Name:  "CONNECTION",
+					Value: "https://user:{{.SECRET__api_token}}@{{.GLOBAL__bucket}}",
+				},
+			}, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select '{{.SECRET__api_token}}' from t where ts >= '{{.DSTART}}'",
+				},
+			})
+			secretProvider := new(mock.SecretProvider)
+			secretProvider.On("Get", "api_token").Return("vault-token", nil).Once()
+			defer secretProvider.AssertExpectations(t)
+
+			contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+			contextManager.SetSecretProvider(secretProvider)
+			envMap, fileMap, maskedEnvMap, maskedFileMap, err := contextManager.GenerateMasked(
+				instanceSpec, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, "vault-token", envMap["SECRET__TOKEN"])
+			assert.Equal(t, "https://user:vault-token@gs://some_folder", envMap["CONNECTION"])
+			assert.Equal(t, "select 'vault-token' from t where ts >= '2020-11-10T00:00:00Z'", fileMap["query.sql"])
+
+			assert.Equal(t, "***", maskedEnvMap["SECRET__TOKEN"])
+			assert.Equal(t, "https://user:***@gs://some_folder", maskedEnvMap["CONNECTION"])
+			assert.Equal(t, "2020-11-10T00:00:00Z", maskedEnvMap["DSTART"])
+			assert.Equal(t, "select '***' from t where ts >= '2020-11-10T00:00:00Z'", maskedFileMap["query.sql"])
+		})
+		t.Run("should render generated times in their own layout", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, []models.JobSpecAsset{
+				{
+					Name:  "query.sql",
+					Value: "select * from t where ts >= '{{.DSTART}}' and ts <= '{{.DEND_INCLUSIVE}}'",
+				},
+				{
+					Name:  "partitions.sql",
+					Value: "{{ range partitions }}{{ Date . }}{{ end }}",
+				},
+			})
+			assert.Equal(t, "2020-11-10T00:00:00Z", instanceSpec.Data[1].Value)
+			contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+
+			envMap, fileMap, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq",
+				instance.WithGeneratedTimeLayout("2006-01-02 15:04:05"))
+			assert.Nil(t, err)
+			assert.Equal(t, "2020-11-11 02:00:00", envMap["EXECUTION_TIME"])
+			assert.Equal(t, "2020-11-10 00:00:00", envMap["DSTART"])
+			assert.Equal(t, "2020-11-11 00:00:00", envMap["DEND"])
+			assert.Equal(t, "select * from t where ts >= '2020-11-10 00:00:00' and ts <= '2020-11-10 23:59:59'", fileMap["query.sql"])
+			assert.Equal(t, "2020-11-10", fileMap["partitions.sql"])
+			assert.Equal(t, time.RFC3339, models.InstanceScheduledAtTimeLayout)
+
+			envMap, fileMap, err = contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, "2020-11-10T00:00:00Z", envMap["DSTART"])
+			assert.Equal(t, "2020-11-10", fileMap["partitions.sql"])
+		})
+		t.Run("should fail for a time layout the engine doesn't support", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+			contextManager := instance.NewContextManager(namespaceSpec, jobSpec, instance.NewJinjaEngine())
+
+			_, _, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq",
+				instance.WithGeneratedTimeLayout("2006-01-02 15:04:05"))
+			assert.EqualError(t, err, "template engine doesn't support time layout 2006-01-02 15:04:05")
+		})
 	})
+	t.Run("AvailableVariables", func(t *testing.T) {
+		t.Run("should return variables usable in templates of a transformation", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+				{
+					Name:  "BQ_VAL",
+					Value: "22",
+				},
+			}, nil)
+
+			variables, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).AvailableVariables(
+				instanceSpec, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]string{
+				"EXECUTION_TIME":    "2020-11-11T02:00:00Z",
+				"DSTART":            "2020-11-10T00:00:00Z",
+				"DEND":              "2020-11-11T00:00:00Z",
+				"DEND_INCLUSIVE":    "2020-11-10T23:59:59Z",
+				"GLOBAL__bucket":    "gs://some_folder",
+				"SCHEDULE_INTERVAL": "0 2 * * *",
+				"START_DATE":        "2000-11-11",
+				"IS_CATCHUP":        "false",
+			}, variables)
+		})
+		t.Run("should list catchup of instances executed behind their schedule", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+			for i, data := range instanceSpec.Data {
+				if data.Name == instance.ConfigKeyExecutionTime {
+					instanceSpec.Data[i].Value = "2020-11-13T02:00:00Z"
+				}
+			}
+
+			variables, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).AvailableVariables(
+				instanceSpec, models.InstanceTypeTask, "bq")
+			assert.Nil(t, err)
+			assert.Equal(t, "true", variables["IS_CATCHUP"])
+		})
+		t.Run("should fail for an unknown hook", func(t *testing.T) {
+			namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+
+			_, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).AvailableVariables(
+				instanceSpec, models.InstanceTypeHook, "transporter")
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+// newGenerateFixture prepares a namespace, a task job spec with provided configs
+// and assets and its instance scheduled at 2020-11-11 with the instance data
+// registered by the instance service
+func newGenerateFixture(configs models.JobSpecConfigs, assets []models.JobSpecAsset) (models.NamespaceSpec, models.JobSpec, models.InstanceSpec) {
+	projectSpec := models.ProjectSpec{
+		ID:   uuid.Must(uuid.NewRandom()),
+		Name: "humara-projectSpec",
+		Config: map[string]string{
+			"bucket": "gs://some_folder",
+		},
+	}
+	namespaceSpec := models.NamespaceSpec{
+		ID:          uuid.Must(uuid.NewRandom()),
+		Name:        "namespace-1",
+		Config:      map[string]string{},
+		ProjectSpec: projectSpec,
+	}
+
+	execUnit := new(mock.BasePlugin)
+	execUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+		Name: "bq",
+	}, nil)
+	jobAssets := *models.JobAssets{}.New(assets)
+	cliMod := new(mock.CLIMod)
+	cliMod.On("CompileAssets", mock2.Anything, mock2.Anything).Return(&models.CompileAssetsResponse{
+		Assets: models.PluginAssets{}.FromJobSpec(jobAssets),
+	}, nil)
+
+	jobSpec := models.JobSpec{
+		Name:  "foo",
+		Owner: "mee@mee",
+		Schedule: models.JobSpecSchedule{
+			StartDate: time.Date(2000, 11, 11, 0, 0, 0, 0, time.UTC),
+			Interval:  "0 2 * * *",
+		},
+		Task: models.JobSpecTask{
+			Unit:     &models.Plugin{Base: execUnit, CLIMod: cliMod},
+			Priority: 2000,
+			Window: models.JobSpecTaskWindow{
+				Size:       24 * time.Hour,
+				Offset:     0,
+				TruncateTo: "d",
+			},
+			Config: configs,
+		},
+		Dependencies: map[string]models.JobSpecDependency{},
+		Assets:       jobAssets,
+	}
+
+	scheduledAt := time.Date(2020, 11, 11, 2, 0, 0, 0, time.UTC)
+	instanceSpec := models.InstanceSpec{
+		Job:         jobSpec,
+		ScheduledAt: scheduledAt,
+		State:       models.InstanceStateRunning,
+		Data: []models.InstanceSpecData{
+			{
+				Name:  instance.ConfigKeyExecutionTime,
+				Value: scheduledAt.Format(models.InstanceScheduledAtTimeLayout),
+				Type:  models.InstanceDataTypeEnv,
+			},
+			{
+				Name:  instance.ConfigKeyDstart,
+				Value: jobSpec.Task.Window.GetStart(scheduledAt).Format(models.InstanceScheduledAtTimeLayout),
+				Type:  models.InstanceDataTypeEnv,
+			},
+			{
+				Name:  instance.ConfigKeyDend,
+				Value: jobSpec.Task.Window.GetEnd(scheduledAt).Format(models.InstanceScheduledAtTimeLayout),
+				Type:  models.InstanceDataTypeEnv,
+			},
+		},
+	}
+	return namespaceSpec, jobSpec, instanceSpec
+}
+
+func newGoEngine(t *testing.T, opts ...instance.GoEngineOption) *instance.GoEngine {
+	t.Helper()
+	engine, err := instance.NewGoEngine(opts...)
+	assert.Nil(t, err)
+	return engine
 }
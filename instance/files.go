@@ -0,0 +1,36 @@
+package instance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFilesToDir writes the generated files of an instance under dir, for
+// local development and debugging. Subdirectories in file names are created
+// as needed, file names escaping dir are rejected
+func WriteFilesToDir(fileMap map[string]string, dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve directory %s", dir)
+	}
+	for fileName, content := range fileMap {
+		if filepath.IsAbs(fileName) {
+			return errors.Errorf("file %s must be relative to %s", fileName, dir)
+		}
+		filePath := filepath.Join(root, fileName)
+		if !strings.HasPrefix(filePath, root+string(filepath.Separator)) {
+			return errors.Errorf("file %s escapes %s", fileName, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return errors.Wrapf(err, "failed to create directory for %s", fileName)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s", fileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package instance_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFilesToDir(t *testing.T) {
+	t.Run("should write files creating nested directories", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "optimus-instance")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		err = instance.WriteFilesToDir(map[string]string{
+			"query.sql":            "select 1",
+			"macros/partition.sql": "select 2",
+		}, dir)
+		assert.Nil(t, err)
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, "query.sql"))
+		assert.Nil(t, err)
+		assert.Equal(t, "select 1", string(content))
+		content, err = ioutil.ReadFile(filepath.Join(dir, "macros", "partition.sql"))
+		assert.Nil(t, err)
+		assert.Equal(t, "select 2", string(content))
+	})
+	t.Run("should reject files escaping the directory", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "optimus-instance")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		err = instance.WriteFilesToDir(map[string]string{
+			"../query.sql": "select 1",
+		}, filepath.Join(dir, "assets"))
+		assert.NotNil(t, err)
+		_, err = os.Stat(filepath.Join(dir, "query.sql"))
+		assert.True(t, os.IsNotExist(err))
+
+		err = instance.WriteFilesToDir(map[string]string{
+			"/tmp/query.sql": "select 1",
+		}, dir)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,67 @@
+package instance
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
+)
+
+var globalReference = regexp.MustCompile(`\b` + ProjectConfigPrefix + `(\w+)`)
+
+// ValidateGlobalRefs checks every GLOBAL__ variable referenced in configs
+// and assets of the job is configured for the project, catching missing
+// configs at deploy instead of at instance run. Assets skipped from
+// rendering, see IgnoreTemplateRenderExtension, are not checked. Configs
+// configured only for some deployments, e.g. region@prod, count as present
+func ValidateGlobalRefs(projectSpec models.ProjectSpec, jobSpec models.JobSpec) error {
+	configured := map[string]bool{}
+	for key := range projectSpec.Config {
+		if idx := strings.LastIndex(key, DeploymentSeparator); idx >= 0 {
+			key = key[:idx]
+		}
+		configured[key] = true
+	}
+
+	missing := map[string][]string{}
+	check := func(location, tmpl string) {
+		for _, match := range globalReference.FindAllStringSubmatch(tmpl, -1) {
+			if configured[match[1]] {
+				continue
+			}
+			if locations := missing[match[0]]; len(locations) > 0 && locations[len(locations)-1] == location {
+				continue
+			}
+			missing[match[0]] = append(missing[match[0]], location)
+		}
+	}
+
+	for _, config := range jobSpec.Task.Config {
+		check(fmt.Sprintf("task config %s", config.Name), config.Value)
+	}
+	for _, hook := range jobSpec.Hooks {
+		for _, config := range hook.Config {
+			check(fmt.Sprintf("hook config %s", config.Name), config.Value)
+		}
+	}
+	for _, asset := range jobSpec.Assets.GetAll() {
+		if shouldIgnoreFile(asset.Name) {
+			continue
+		}
+		check(fmt.Sprintf("asset %s", asset.Name), asset.Value)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var refs []string
+	for ref, locations := range missing {
+		refs = append(refs, fmt.Sprintf("%s (%s)", ref, strings.Join(locations, ", ")))
+	}
+	sort.Strings(refs)
+	return errors.Errorf("job %s references configs missing from project %s: %s",
+		jobSpec.Name, projectSpec.Name, strings.Join(refs, "; "))
+}
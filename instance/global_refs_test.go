@@ -0,0 +1,69 @@
+package instance_test
+
+import (
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGlobalRefs(t *testing.T) {
+	projectSpec := models.ProjectSpec{
+		Name: "humara-projectSpec",
+		Config: map[string]string{
+			"bucket": "gs://some_folder",
+		},
+	}
+	newJobSpec := func(assets []models.JobSpecAsset) models.JobSpec {
+		return models.JobSpec{
+			Name: "foo",
+			Task: models.JobSpecTask{
+				Config: models.JobSpecConfigs{
+					{
+						Name:  "BUCKET",
+						Value: "{{.GLOBAL__bucket}}",
+					},
+				},
+			},
+			Hooks: []models.JobSpecHook{
+				{
+					Config: models.JobSpecConfigs{
+						{
+							Name:  "TOPIC",
+							Value: "{{.GLOBAL__kafka_topic}}",
+						},
+					},
+				},
+			},
+			Assets: *models.JobAssets{}.New(assets),
+		}
+	}
+
+	t.Run("should catch global references missing from project configs", func(t *testing.T) {
+		err := instance.ValidateGlobalRefs(projectSpec, newJobSpec([]models.JobSpecAsset{
+			{
+				Name:  "query.sql",
+				Value: "select * from {{.GLOBAL__dataset}}.t1 join {{.GLOBAL__dataset}}.t2 where path = '{{.GLOBAL__bucket}}'",
+			},
+		}))
+		assert.EqualError(t, err, "job foo references configs missing from project humara-projectSpec: "+
+			"GLOBAL__dataset (asset query.sql); GLOBAL__kafka_topic (hook config TOPIC)")
+	})
+	t.Run("should skip assets which are not rendered", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Name: "humara-projectSpec",
+			Config: map[string]string{
+				"bucket":      "gs://some_folder",
+				"kafka_topic": "events",
+			},
+		}
+		err := instance.ValidateGlobalRefs(projectSpec, newJobSpec([]models.JobSpecAsset{
+			{
+				Name:  "query.sql.tmpl",
+				Value: "select * from {{.GLOBAL__dataset}}.t1",
+			},
+		}))
+		assert.Nil(t, err)
+	})
+}
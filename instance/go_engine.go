@@ -2,37 +2,144 @@ package instance
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"regexp"
 	"strings"
 	"text/template"
+	"text/template/parse"
 	"time"
 
 	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
 
 	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v2"
 )
 
+// zeroMissingFnName is appended to printed pipelines of templates which
+// render missing variables empty, its leading underscore keeps it apart
+// from functions users can call
+const zeroMissingFnName = "_zeroMissing"
+
+// names of functions the context manager binds to the engine for each
+// generation, custom functions can't take them as they'd be shadowed
+const (
+	libIncludeFnName = "libInclude"
+	hasSecretFnName  = "hasSecret"
+	upstreamFnName   = "upstream"
+	partitionsFnName = "partitions"
+)
+
+var reservedFnNames = map[string]bool{
+	libIncludeFnName: true,
+	hasSecretFnName:  true,
+	upstreamFnName:   true,
+	partitionsFnName: true,
+}
+
+// MissingKeyPolicy controls how a template behaves when it references a
+// variable which is not present in the context
+type MissingKeyPolicy string
+
+const (
+	// MissingKeyError stops rendering with an error
+	MissingKeyError MissingKeyPolicy = "error"
+	// MissingKeyZero renders an empty value in place of the variable
+	MissingKeyZero MissingKeyPolicy = "zero"
+	// MissingKeyInvalid renders "<no value>", default behaviour of go templates
+	MissingKeyInvalid MissingKeyPolicy = "invalid"
+)
+
+func (p MissingKeyPolicy) Validate() error {
+	switch p {
+	case MissingKeyError, MissingKeyZero, MissingKeyInvalid:
+		return nil
+	}
+	return errors.Errorf("invalid missing key policy: %s", p)
+}
+
 // GoEngine compiles a set of defined macros using the provided context
 type GoEngine struct {
-	baseFns template.FuncMap
+	baseFns    template.FuncMap
+	missingKey MissingKeyPolicy
+
+	// Date was overridden at construction and is kept by WithTimeLayout
+	customDate bool
+
+	// rendering stops at the next output written once ctx is done
+	ctx context.Context
+}
+
+// GoEngineOption customizes a GoEngine at construction
+type GoEngineOption func(*goEngineOptions)
+
+type goEngineOptions struct {
+	funcs         template.FuncMap
+	allowOverride bool
+}
+
+// WithFuncs registers custom functions usable in templates along with
+// the built-in ones
+func WithFuncs(funcs template.FuncMap) GoEngineOption {
+	return func(o *goEngineOptions) {
+		if o.funcs == nil {
+			o.funcs = template.FuncMap{}
+		}
+		for name, fn := range funcs {
+			o.funcs[name] = fn
+		}
+	}
+}
+
+// AllowFuncOverride lets functions registered via WithFuncs replace
+// built-in functions of the same name
+func AllowFuncOverride() GoEngineOption {
+	return func(o *goEngineOptions) {
+		o.allowOverride = true
+	}
 }
 
-func NewGoEngine() *GoEngine {
+// NewGoEngine creates an engine with built-in template functions and any
+// registered via options. It fails if a custom function overrides a
+// built-in one without AllowFuncOverride, or takes the name of one bound
+// for each generation like partitions
+func NewGoEngine(opts ...GoEngineOption) (*GoEngine, error) {
+	options := goEngineOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	e := &GoEngine{}
 	e.init()
-	return e
+	for name, fn := range options.funcs {
+		if reservedFnNames[name] {
+			return nil, errors.Errorf("template function %s is reserved and can't be overridden", name)
+		}
+		if _, ok := e.baseFns[name]; ok && !options.allowOverride {
+			return nil, errors.Errorf("template function %s is built-in and can't be overridden", name)
+		}
+		e.baseFns[name] = fn
+		e.customDate = e.customDate || name == "Date"
+	}
+	return e, nil
 }
 
 func (e *GoEngine) CompileFiles(files map[string]string, context map[string]interface{}) (map[string]string, error) {
 	var err error
 	rendered := map[string]string{}
 	// prepare template list
-	root := template.New("base").Funcs(e.baseFns)
+	root := e.newTemplate("base")
 	for name, content := range files {
 		root, err = root.New(name).Parse(content)
 		if err != nil {
 			return nil, err
 		}
 	}
+	e.zeroMissingKeys(root)
 	// render templates
 	for name, content := range files {
 		// don't render files starting with
@@ -41,7 +148,7 @@ func (e *GoEngine) CompileFiles(files map[string]string, context map[string]inte
 			continue
 		}
 		var buf bytes.Buffer
-		err = root.ExecuteTemplate(&buf, name, context)
+		err = root.ExecuteTemplate(e.output(&buf), name, context)
 		if err != nil {
 			return nil, err
 		}
@@ -51,17 +158,160 @@ func (e *GoEngine) CompileFiles(files map[string]string, context map[string]inte
 }
 
 func (e *GoEngine) CompileString(input string, context map[string]interface{}) (string, error) {
-	tmpl, err := template.New("optimus_go_engine").Funcs(e.baseFns).Parse(input)
+	tmpl, err := e.newTemplate("optimus_go_engine").Parse(input)
 	if err != nil {
 		return "", err
 	}
+	e.zeroMissingKeys(tmpl)
 	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, context); err != nil {
+	if err = tmpl.Execute(e.output(&buf), context); err != nil {
 		return "", err
 	}
 	return strings.TrimSpace(buf.String()), nil
 }
 
+// WithMissingKey returns a copy of the engine handling variables missing
+// from the context as per the provided policy
+func (e *GoEngine) WithMissingKey(policy MissingKeyPolicy) models.TemplateEngine {
+	return &GoEngine{
+		baseFns:    e.baseFns,
+		missingKey: policy,
+		customDate: e.customDate,
+		ctx:        e.ctx,
+	}
+}
+
+// WithContext returns a copy of the engine which stops rendering once the
+// context is done. Templates are checked as they write output, a template
+// function blocking or looping without output is not interrupted
+func (e *GoEngine) WithContext(ctx context.Context) models.TemplateEngine {
+	return &GoEngine{
+		baseFns:    e.baseFns,
+		missingKey: e.missingKey,
+		customDate: e.customDate,
+		ctx:        ctx,
+	}
+}
+
+// WithExtraFuncs returns a copy of the engine with additional template
+// functions, used for functions bound to a single generation
+func (e *GoEngine) WithExtraFuncs(funcs template.FuncMap) models.TemplateEngine {
+	fns := template.FuncMap{}
+	for name, fn := range e.baseFns {
+		fns[name] = fn
+	}
+	for name, fn := range funcs {
+		fns[name] = fn
+	}
+	return &GoEngine{
+		baseFns:    fns,
+		missingKey: e.missingKey,
+		customDate: e.customDate,
+		ctx:        e.ctx,
+	}
+}
+
+// WithTimeLayout returns a copy of the engine whose Date parses times in
+// layout, defaults to models.InstanceScheduledAtTimeLayout
+func (e *GoEngine) WithTimeLayout(layout string) models.TemplateEngine {
+	if e.customDate {
+		return e
+	}
+	return e.WithExtraFuncs(template.FuncMap{
+		"Date": dateFn(layout),
+	})
+}
+
+// output returns the writer templates render to, failing writes once the
+// context of the engine is done
+func (e *GoEngine) output(buf *bytes.Buffer) io.Writer {
+	if e.ctx == nil {
+		return buf
+	}
+	return &contextWriter{ctx: e.ctx, w: buf}
+}
+
+// contextWriter fails writes once the context is done, which aborts the
+// template writing to it
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+func (e *GoEngine) newTemplate(name string) *template.Template {
+	tmpl := template.New(name).Funcs(e.baseFns)
+	if e.missingKey == MissingKeyError {
+		tmpl = tmpl.Option(fmt.Sprintf("missingkey=%s", e.missingKey))
+	}
+	if e.missingKey == MissingKeyZero {
+		tmpl = tmpl.Funcs(template.FuncMap{zeroMissingFnName: zeroMissingFn})
+	}
+	return tmpl
+}
+
+// zeroMissingKeys makes parsed templates print variables missing from the
+// context as empty, go templates print <no value> for them even with
+// missingkey=zero as the zero value of an interface is nil. Every pipeline
+// which prints its value is piped through zeroMissingFn, which receives
+// nil for missing variables, including fields of missing maps
+func (e *GoEngine) zeroMissingKeys(tmpl *template.Template) {
+	if e.missingKey != MissingKeyZero {
+		return
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			pipeZeroMissing(t.Tree, t.Tree.Root)
+		}
+	}
+}
+
+func pipeZeroMissing(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			pipeZeroMissing(tree, child)
+		}
+	case *parse.ActionNode:
+		// actions declaring or assigning variables print nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(zeroMissingFnName).SetTree(tree).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		pipeZeroMissing(tree, n.List)
+		pipeZeroMissing(tree, n.ElseList)
+	case *parse.RangeNode:
+		pipeZeroMissing(tree, n.List)
+		pipeZeroMissing(tree, n.ElseList)
+	case *parse.WithNode:
+		pipeZeroMissing(tree, n.List)
+		pipeZeroMissing(tree, n.ElseList)
+	}
+}
+
+// zeroMissingFn replaces the nil a missing variable evaluates to with an
+// empty string, other values are printed as is
+func zeroMissingFn(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
 func shouldIgnoreFile(name string) bool {
 	for _, ext := range IgnoreTemplateRenderExtension {
 		if strings.HasSuffix(name, ext) {
@@ -73,13 +323,72 @@ func shouldIgnoreFile(name string) bool {
 
 func (e *GoEngine) init() {
 	e.baseFns = sprig.TxtFuncMap()
-	e.baseFns["Date"] = goDateFn
+	e.baseFns["Date"] = dateFn(models.InstanceScheduledAtTimeLayout)
+	e.baseFns["seededRandom"] = seededRandomFn
+	e.baseFns["shellquote"] = ShellQuote
+	e.baseFns["fromYaml"] = fromYamlFn
 }
 
-func goDateFn(timeStr string) (string, error) {
-	t, err := time.Parse(models.InstanceScheduledAtTimeLayout, timeStr)
-	if err != nil {
-		return "", err
+// fromYamlFn parses a yaml document, e.g. a list or map authored as a
+// config value, into a structure usable with range, index and field access
+func fromYamlFn(value string) (interface{}, error) {
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, errors.Wrap(err, "fromYaml failed to parse value")
+	}
+	return normalizeYaml(parsed), nil
+}
+
+// normalizeYaml converts maps decoded by yaml to map[string]interface{},
+// as templates can only access fields of maps keyed by strings
+func normalizeYaml(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := map[string]interface{}{}
+		for key, val := range v {
+			normalized[fmt.Sprint(key)] = normalizeYaml(val)
+		}
+		return normalized
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYaml(val)
+		}
+	}
+	return value
+}
+
+// dateFn returns the Date template function, formatting times in layout
+// as dates
+func dateFn(layout string) func(string) (string, error) {
+	return func(timeStr string) (string, error) {
+		t, err := time.Parse(layout, timeStr)
+		if err != nil {
+			return "", err
+		}
+		return t.Format(models.JobDatetimeLayout), nil
+	}
+}
+
+// seededRandomFn returns a number in [0, n) which stays the same for a seed,
+// e.g. using job name as seed keeps the sampling bucket of a job stable
+// across renders
+func seededRandomFn(seed string, n int) (int, error) {
+	if n <= 0 {
+		return 0, errors.Errorf("seededRandom needs a positive upper bound, got %d", n)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return rand.New(rand.NewSource(int64(h.Sum64()))).Intn(n), nil
+}
+
+var shellSafeValue = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellQuote quotes the value so a POSIX shell reads it as a single word
+// with no expansion, e.g. for values injected in shell commands. Values
+// made only of characters shells don't interpret are returned as is
+func ShellQuote(value string) string {
+	if shellSafeValue.MatchString(value) {
+		return value
 	}
-	return t.Format(models.JobDatetimeLayout), nil
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
 }
@@ -1,7 +1,10 @@
 package instance_test
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/odpf/optimus/instance"
 	"github.com/stretchr/testify/assert"
@@ -47,7 +50,7 @@ func TestGoEngine(t *testing.T) {
 					"EXECUTION_TIME": "empty val",
 				}
 
-				comp := instance.NewGoEngine()
+				comp := newGoEngine(t)
 				compiledExpr, err := comp.CompileString(testCase.Input, values)
 
 				assert.Nil(t, err)
@@ -119,7 +122,7 @@ func TestGoEngine(t *testing.T) {
 					"EXECUTION_TIME": "empty val",
 				}
 
-				comp := instance.NewGoEngine()
+				comp := newGoEngine(t)
 				compiledExpr, err := comp.CompileFiles(testCase.Input, values)
 
 				if err != nil {
@@ -130,4 +133,157 @@ func TestGoEngine(t *testing.T) {
 			}
 		})
 	})
+	t.Run("seededRandom", func(t *testing.T) {
+		t.Run("should render same value for a seed across calls", func(t *testing.T) {
+			comp := newGoEngine(t)
+			first, err := comp.CompileString(`{{ seededRandom "sample_select" 100 }}`, map[string]interface{}{})
+			assert.Nil(t, err)
+			for i := 0; i < 5; i++ {
+				again, err := newGoEngine(t).CompileString(`{{ seededRandom "sample_select" 100 }}`, map[string]interface{}{})
+				assert.Nil(t, err)
+				assert.Equal(t, first, again)
+			}
+		})
+		t.Run("should vary values across job names", func(t *testing.T) {
+			comp := newGoEngine(t)
+			rendered := map[string]bool{}
+			for _, jobName := range []string{"job_a", "job_b", "job_c", "job_d", "job_e", "job_f"} {
+				value, err := comp.CompileString(`{{ seededRandom .JOB 1000000 }}`, map[string]interface{}{
+					"JOB": jobName,
+				})
+				assert.Nil(t, err)
+				rendered[value] = true
+			}
+			assert.Greater(t, len(rendered), 1)
+		})
+		t.Run("should fail for a non positive bound", func(t *testing.T) {
+			_, err := newGoEngine(t).CompileString(`{{ seededRandom "sample_select" 0 }}`, map[string]interface{}{})
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("shellquote", func(t *testing.T) {
+		cases := map[string]string{
+			"2020-11-10T00:00:00Z": "2020-11-10T00:00:00Z",
+			"two words":            "'two words'",
+			`it's "quoted"`:        `'it'"'"'s "quoted"'`,
+			"$HOME/`id`":           "'$HOME/`id`'",
+			"":                     "''",
+		}
+		for value, expected := range cases {
+			compiledExpr, err := newGoEngine(t).CompileString("echo {{ shellquote .VALUE }}", map[string]interface{}{
+				"VALUE": value,
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, "echo "+expected, compiledExpr)
+		}
+	})
+	t.Run("fromYaml", func(t *testing.T) {
+		t.Run("should parse yaml maps usable with field access", func(t *testing.T) {
+			compiledExpr, err := newGoEngine(t).CompileString(
+				`{{ $c := fromYaml .VALUE }}{{ $c.dataset }}:{{ range $c.columns }}{{ .name }} {{ end }}`,
+				map[string]interface{}{
+					"VALUE": "dataset: playground\ncolumns:\n  - name: id\n  - name: ts\n",
+				})
+			assert.Nil(t, err)
+			assert.Equal(t, "playground:id ts ", compiledExpr)
+		})
+		t.Run("should fail for invalid yaml", func(t *testing.T) {
+			_, err := newGoEngine(t).CompileString(`{{ fromYaml .VALUE }}`, map[string]interface{}{
+				"VALUE": "key: [unclosed",
+			})
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("WithMissingKey", func(t *testing.T) {
+		t.Run("should render variables missing in context as per missing key policy", func(t *testing.T) {
+			testCases := []struct {
+				Policy   instance.MissingKeyPolicy
+				Input    string
+				Expected string
+			}{
+				{instance.MissingKeyZero, "id = '{{.UNKNOWN}}'", "id = ''"},
+				{instance.MissingKeyZero, "id = '{{.task.UNKNOWN}}' and '{{.missing.UNKNOWN}}'", "id = '' and ''"},
+				{instance.MissingKeyZero, "{{ $id := .UNKNOWN }}id = '{{ $id }}'", "id = ''"},
+				{instance.MissingKeyZero, "{{ if .task }}id = '{{ .UNKNOWN }}'{{ end }}", "id = ''"},
+				{instance.MissingKeyZero, "note = '{{.NOTE}}' and id = '{{.UNKNOWN}}'", "note = '<no value>' and id = ''"},
+				{instance.MissingKeyInvalid, "id = '{{.UNKNOWN}}'", "id = '<no value>'"},
+			}
+			for _, testCase := range testCases {
+				values := map[string]interface{}{
+					"NOTE": "<no value>",
+					"task": map[string]interface{}{
+						"TABLE": "events",
+					},
+				}
+				comp := newGoEngine(t).WithMissingKey(testCase.Policy)
+
+				compiledExpr, err := comp.CompileString(testCase.Input, values)
+				assert.Nil(t, err, testCase.Input)
+				assert.Equal(t, testCase.Expected, compiledExpr, testCase.Input)
+
+				compiledFiles, err := comp.CompileFiles(map[string]string{"query.sql": testCase.Input}, values)
+				assert.Nil(t, err, testCase.Input)
+				assert.Equal(t, testCase.Expected, compiledFiles["query.sql"], testCase.Input)
+			}
+		})
+		t.Run("should fail on variables missing in context with error policy", func(t *testing.T) {
+			_, err := newGoEngine(t).WithMissingKey(instance.MissingKeyError).CompileString("id = '{{.UNKNOWN}}'", nil)
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("WithContext", func(t *testing.T) {
+		t.Run("should stop rendering once the context is done", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			engine := newGoEngine(t).WithContext(ctx)
+
+			_, err := engine.CompileString("select {{.DSTART}}", map[string]interface{}{"DSTART": "2021-02-10"})
+			assert.Equal(t, context.Canceled, err)
+			_, err = engine.CompileFiles(map[string]string{"query.sql": "select 1"}, nil)
+			assert.Equal(t, context.Canceled, err)
+		})
+		t.Run("should render while the context is not done", func(t *testing.T) {
+			engine := newGoEngine(t).WithContext(context.Background())
+
+			compiled, err := engine.CompileString("select {{.DSTART}}", map[string]interface{}{"DSTART": "2021-02-10"})
+			assert.Nil(t, err)
+			assert.Equal(t, "select 2021-02-10", compiled)
+		})
+	})
+	t.Run("WithFuncs", func(t *testing.T) {
+		t.Run("should render templates using custom functions", func(t *testing.T) {
+			comp := newGoEngine(t, instance.WithFuncs(template.FuncMap{
+				"shout": strings.ToUpper,
+			}))
+			compiledExpr, err := comp.CompileString("select * from {{ shout .TABLE }}", map[string]interface{}{
+				"TABLE": "events",
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, "select * from EVENTS", compiledExpr)
+		})
+		t.Run("should not allow overriding built-in functions by default", func(t *testing.T) {
+			_, err := instance.NewGoEngine(instance.WithFuncs(template.FuncMap{
+				"Date": strings.ToUpper,
+			}))
+			assert.EqualError(t, err, "template function Date is built-in and can't be overridden")
+		})
+		t.Run("should override built-in functions when allowed", func(t *testing.T) {
+			comp := newGoEngine(t, instance.AllowFuncOverride(), instance.WithFuncs(template.FuncMap{
+				"Date": strings.ToUpper,
+			}))
+			compiledExpr, err := comp.CompileString("{{ Date .DSTART }}", map[string]interface{}{
+				"DSTART": "today",
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, "TODAY", compiledExpr)
+		})
+		t.Run("should not allow functions bound for each generation even when overriding", func(t *testing.T) {
+			for _, name := range []string{"libInclude", "hasSecret", "upstream", "partitions"} {
+				_, err := instance.NewGoEngine(instance.AllowFuncOverride(), instance.WithFuncs(template.FuncMap{
+					name: strings.ToUpper,
+				}))
+				assert.EqualError(t, err, "template function "+name+" is reserved and can't be overridden")
+			}
+		})
+	})
 }
@@ -0,0 +1,118 @@
+package instance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// SecretEnvPrefix flags envs holding secrets, e.g. SECRET__TOKEN or for
+// hooks TASK__SECRET__TOKEN, which are exported to a kubernetes Secret
+// instead of a ConfigMap
+const SecretEnvPrefix = "SECRET__"
+
+// k8sDataKeyPattern matches keys kubernetes accepts in data of ConfigMaps
+// and Secrets
+var k8sDataKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+type k8sMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type k8sManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Data       map[string]string `yaml:"data"`
+}
+
+// ToK8sManifests converts the generated envs and files of an instance to a
+// ConfigMap and a Secret of the provided name, for jobs executed on
+// kubernetes. Envs flagged with SecretEnvPrefix go to the Secret, as do envs
+// the meta file describes as secrets, see WithMetaFile, which includes
+// configs referencing SECRET__ variables. The rest of the envs along with
+// the files go to the ConfigMap
+func ToK8sManifests(envMap, fileMap map[string]string, name, namespace string) (configMap []byte, secret []byte, err error) {
+	if name == "" {
+		return nil, nil, errors.New("name of kubernetes manifests is required")
+	}
+	secretEnvs, err := secretEnvsOf(fileMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configData := map[string]string{}
+	secretData := map[string]string{}
+	for key, val := range envMap {
+		if !k8sDataKeyPattern.MatchString(key) {
+			return nil, nil, errors.Errorf("env %s is not a valid kubernetes data key", key)
+		}
+		if isSecretEnv(key) || secretEnvs[key] {
+			secretData[key] = base64.StdEncoding.EncodeToString([]byte(val))
+			continue
+		}
+		configData[key] = val
+	}
+	for fileName, content := range fileMap {
+		if !k8sDataKeyPattern.MatchString(fileName) {
+			return nil, nil, errors.Errorf("file %s is not a valid kubernetes data key", fileName)
+		}
+		if _, ok := configData[fileName]; ok {
+			return nil, nil, errors.Errorf("file %s collides with env of the same name", fileName)
+		}
+		configData[fileName] = content
+	}
+
+	metadata := k8sMetadata{
+		Name:      name,
+		Namespace: namespace,
+	}
+	if configMap, err = yaml.Marshal(k8sManifest{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   metadata,
+		Data:       configData,
+	}); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to build config map manifest")
+	}
+	if secret, err = yaml.Marshal(k8sManifest{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   metadata,
+		Type:       "Opaque",
+		Data:       secretData,
+	}); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to build secret manifest")
+	}
+	return configMap, secret, nil
+}
+
+func isSecretEnv(key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, TaskConfigPrefix), SecretEnvPrefix)
+}
+
+// secretEnvsOf returns names of envs the meta file among the files describes
+// as secrets, none if the meta file is not generated
+func secretEnvsOf(fileMap map[string]string) (map[string]bool, error) {
+	content, ok := fileMap[MetaFileName]
+	if !ok {
+		return nil, nil
+	}
+	var meta Meta
+	if err := json.Unmarshal([]byte(content), &meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", MetaFileName)
+	}
+	secretEnvs := map[string]bool{}
+	for _, variable := range meta.Variables {
+		if variable.Secret {
+			secretEnvs[variable.Name] = true
+		}
+	}
+	return secretEnvs, nil
+}
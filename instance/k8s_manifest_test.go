@@ -0,0 +1,110 @@
+package instance_test
+
+import (
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestToK8sManifests(t *testing.T) {
+	type manifest struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+		Type string            `yaml:"type"`
+		Data map[string]string `yaml:"data"`
+	}
+
+	t.Run("should route secret envs to secret and the rest to config map", func(t *testing.T) {
+		envMap := map[string]string{
+			"DSTART":              "2020-11-10T00:00:00Z",
+			"SECRET__TOKEN":       "s3cr3t",
+			"TASK__SECRET__TOKEN": "t0k3n",
+		}
+		fileMap := map[string]string{
+			"query.sql": "select 1\nfrom t",
+		}
+
+		configMapYaml, secretYaml, err := instance.ToK8sManifests(envMap, fileMap, "foo-instance", "jobs")
+		assert.Nil(t, err)
+
+		var configMap manifest
+		assert.Nil(t, yaml.Unmarshal(configMapYaml, &configMap))
+		assert.Equal(t, "v1", configMap.APIVersion)
+		assert.Equal(t, "ConfigMap", configMap.Kind)
+		assert.Equal(t, "foo-instance", configMap.Metadata.Name)
+		assert.Equal(t, "jobs", configMap.Metadata.Namespace)
+		assert.Equal(t, map[string]string{
+			"DSTART":    "2020-11-10T00:00:00Z",
+			"query.sql": "select 1\nfrom t",
+		}, configMap.Data)
+
+		var secret manifest
+		assert.Nil(t, yaml.Unmarshal(secretYaml, &secret))
+		assert.Equal(t, "Secret", secret.Kind)
+		assert.Equal(t, "Opaque", secret.Type)
+		assert.Equal(t, "foo-instance", secret.Metadata.Name)
+		assert.Equal(t, map[string]string{
+			"SECRET__TOKEN":       "czNjcjN0",
+			"TASK__SECRET__TOKEN": "dDBrM24=",
+		}, secret.Data)
+	})
+	t.Run("should route configs sourced from secrets to secret", func(t *testing.T) {
+		namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+			{
+				Name:  "BQ_TOKEN",
+				Value: "{{.SECRET__bq}}",
+			},
+			{
+				Name:  "TABLE",
+				Value: "events",
+			},
+		}, nil)
+		namespaceSpec.ProjectSpec.Secret = models.ProjectSecrets{
+			{
+				Name:  "bq",
+				Value: "bq-t0k3n",
+			},
+		}
+		envMap, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+			instanceSpec, models.InstanceTypeTask, "bq", instance.WithMetaFile())
+		assert.Nil(t, err)
+
+		configMapYaml, secretYaml, err := instance.ToK8sManifests(envMap, fileMap, "foo-instance", "jobs")
+		assert.Nil(t, err)
+		assert.NotContains(t, string(configMapYaml), "bq-t0k3n")
+
+		var configMap manifest
+		assert.Nil(t, yaml.Unmarshal(configMapYaml, &configMap))
+		assert.NotContains(t, configMap.Data, "BQ_TOKEN")
+		assert.Equal(t, "events", configMap.Data["TABLE"])
+
+		var secret manifest
+		assert.Nil(t, yaml.Unmarshal(secretYaml, &secret))
+		assert.Equal(t, map[string]string{
+			"BQ_TOKEN": "YnEtdDBrM24=",
+		}, secret.Data)
+	})
+	t.Run("should fail for a malformed meta file", func(t *testing.T) {
+		_, _, err := instance.ToK8sManifests(nil, map[string]string{instance.MetaFileName: "{"}, "foo-instance", "jobs")
+		assert.NotNil(t, err)
+	})
+	t.Run("should fail for keys kubernetes doesn't accept", func(t *testing.T) {
+		_, _, err := instance.ToK8sManifests(nil, map[string]string{"dir/query.sql": ""}, "foo-instance", "jobs")
+		assert.NotNil(t, err)
+	})
+	t.Run("should fail for files colliding with envs", func(t *testing.T) {
+		_, _, err := instance.ToK8sManifests(map[string]string{"query.sql": "a"}, map[string]string{"query.sql": "b"}, "foo-instance", "jobs")
+		assert.NotNil(t, err)
+	})
+	t.Run("should fail without a name", func(t *testing.T) {
+		_, _, err := instance.ToK8sManifests(nil, nil, "", "jobs")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,61 @@
+package instance
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/odpf/optimus/models"
+	"github.com/odpf/optimus/store"
+	"github.com/pkg/errors"
+)
+
+// libIncluder reads snippets from the shared library of a project, caching
+// them for the generation it is bound to
+type libIncluder struct {
+	reader  store.ObjectReader
+	project models.ProjectSpec
+	cache   map[string]string
+}
+
+func newLibIncluder(reader store.ObjectReader, project models.ProjectSpec) *libIncluder {
+	return &libIncluder{
+		reader:  reader,
+		project: project,
+		cache:   map[string]string{},
+	}
+}
+
+// Include returns content of the snippet at the path relative to shared
+// library of the project
+func (l *libIncluder) Include(snippetPath string) (string, error) {
+	if content, ok := l.cache[snippetPath]; ok {
+		return content, nil
+	}
+
+	libPath, ok := l.project.Config[models.ProjectSharedLibPathKey]
+	if !ok {
+		return "", errors.Errorf("%s not configured for project %s", models.ProjectSharedLibPathKey, l.project.Name)
+	}
+	p, err := url.Parse(libPath)
+	if err != nil || p.Hostname() == "" {
+		return "", errors.Errorf("invalid %s %s of project %s", models.ProjectSharedLibPathKey, libPath, l.project.Name)
+	}
+	cleaned := path.Clean(snippetPath)
+	if snippetPath == "" || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.Errorf("invalid shared library snippet path %s", snippetPath)
+	}
+
+	reader, err := l.reader.NewReader(p.Hostname(), path.Join(strings.Trim(p.Path, "/"), cleaned))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read shared library snippet %s", snippetPath)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read shared library snippet %s", snippetPath)
+	}
+	l.cache[snippetPath] = string(content)
+	return l.cache[snippetPath], nil
+}
@@ -0,0 +1,141 @@
+package instance
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
+)
+
+// MetaFileName is the file describing generated envs, see WithMetaFile
+const MetaFileName = "optimus.meta.json"
+
+// VariableSource tells where the value of a generated env comes from
+type VariableSource string
+
+const (
+	// VariableSourceConfig envs are configs of the task or hook
+	VariableSourceConfig VariableSource = "config"
+
+	// VariableSourceGlobal envs are configs referencing GLOBAL__ variables
+	VariableSourceGlobal VariableSource = "global"
+
+	// VariableSourceSecret envs hold secrets, either flagged with
+	// SecretEnvPrefix or configs referencing SECRET__ variables
+	VariableSourceSecret VariableSource = "secret"
+
+	// VariableSourceInstance envs are data of the instance, like DSTART
+	VariableSourceInstance VariableSource = "instance"
+)
+
+// VariableMeta describes a generated env without its value
+type VariableMeta struct {
+	Name   string         `json:"name"`
+	Source VariableSource `json:"source"`
+
+	// Defaulted is set for window variables defaulted from the window of
+	// the project and for globals resolved from org configs alone
+	Defaulted bool `json:"defaulted"`
+
+	// Secret is set if the env holds a secret
+	Secret bool `json:"secret"`
+}
+
+// Meta is the content of MetaFileName
+type Meta struct {
+	Variables []VariableMeta `json:"variables"`
+}
+
+// describeEnvs tells the source of each generated env, keyed by names of
+// envs before they are prefixed or sanitized
+func (fm *ContextManager) describeEnvs(envMap map[string]string, instanceEnvMap map[string]interface{},
+	runName string, runType models.InstanceType) ([]VariableMeta, error) {
+	transformationConfigs, hookConfigs, err := fm.getConfigMaps(fm.jobSpec, runName, runType)
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]string{}
+	for key, val := range transformationConfigs {
+		if runType == models.InstanceTypeHook {
+			key = TaskConfigPrefix + key
+		}
+		templates[key], _ = val.(string)
+	}
+	for key, val := range hookConfigs {
+		templates[key], _ = val.(string)
+	}
+	defaulted := fm.defaultedGlobals()
+
+	keys := make([]string, 0, len(envMap))
+	for key := range envMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	variables := make([]VariableMeta, 0, len(keys))
+	for _, key := range keys {
+		variable := VariableMeta{Name: key, Source: VariableSourceConfig}
+		tmpl := templates[key]
+		if _, ok := instanceEnvMap[key].(string); ok {
+			variable.Source = VariableSourceInstance
+			variable.Defaulted = fm.usesProjectWindow && (key == ConfigKeyDstart || key == ConfigKeyDend)
+		} else if isSecretEnv(key) || secretReference.MatchString(tmpl) {
+			variable.Source = VariableSourceSecret
+			variable.Secret = true
+		} else if matches := globalReference.FindAllStringSubmatch(tmpl, -1); len(matches) > 0 {
+			variable.Source = VariableSourceGlobal
+			variable.Defaulted = true
+			for _, match := range matches {
+				variable.Defaulted = variable.Defaulted && defaulted[match[1]]
+			}
+		}
+		variables = append(variables, variable)
+	}
+	return variables, nil
+}
+
+// defaultedGlobals returns keys of global configs only the org configures
+func (fm *ContextManager) defaultedGlobals() map[string]bool {
+	overridden := ResolveGlobalConfig(
+		nil,
+		fm.withDeploymentOverrides(fm.getProjectConfigMap()),
+		fm.withDeploymentOverrides(fm.getNamespaceConfigMap()),
+		fm.withDeploymentOverrides(fm.jobGlobalConfig),
+	)
+	defaulted := map[string]bool{}
+	for key := range fm.withDeploymentOverrides(fm.orgConfig) {
+		if _, ok := overridden[key]; !ok {
+			defaulted[key] = true
+		}
+	}
+	return defaulted
+}
+
+// metaFile renders the description of envs, renaming them the same way
+// generated envs are prefixed and sanitized. Envs dropped while sanitizing
+// are left out
+func (fm *ContextManager) metaFile(variables []VariableMeta, envMap map[string]string) (string, error) {
+	described := map[string]bool{}
+	meta := Meta{Variables: make([]VariableMeta, 0, len(variables))}
+	for _, variable := range variables {
+		variable.Name = fm.options.envKeyPrefix + variable.Name
+		if fm.options.posixEnvKeys {
+			variable.Name = posixEnvKey(variable.Name)
+		}
+		if _, ok := envMap[variable.Name]; !ok || described[variable.Name] {
+			continue
+		}
+		described[variable.Name] = true
+		meta.Variables = append(meta.Variables, variable)
+	}
+	sort.Slice(meta.Variables, func(i, j int) bool {
+		return meta.Variables[i].Name < meta.Variables[j].Name
+	})
+
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to describe generated envs")
+	}
+	return string(content), nil
+}
@@ -0,0 +1,92 @@
+package instance_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/mock"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaFile(t *testing.T) {
+	t.Run("should describe generated envs without values of secrets", func(t *testing.T) {
+		namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+			{
+				Name:  "TABLE",
+				Value: "events",
+			},
+			{
+				Name:  "BUCKET",
+				Value: "{{.GLOBAL__bucket}}",
+			},
+			{
+				Name:  "REGION",
+				Value: "{{.GLOBAL__region}}",
+			},
+			{
+				Name:  "TOKEN",
+				Value: "{{.SECRET__api_token}}",
+			},
+		}, nil)
+		secretProvider := new(mock.SecretProvider)
+		secretProvider.On("Get", "api_token").Return("vault-token", nil).Once()
+		defer secretProvider.AssertExpectations(t)
+
+		contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+		contextManager.SetSecretProvider(secretProvider)
+		contextManager.SetOrgConfig(map[string]string{
+			"region": "asia-southeast1",
+			"bucket": "gs://org_folder",
+		})
+		envMap, fileMap, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq", instance.WithMetaFile())
+		assert.Nil(t, err)
+		assert.Equal(t, "vault-token", envMap["TOKEN"])
+		assert.NotContains(t, fileMap[instance.MetaFileName], "vault-token")
+		assert.NotContains(t, fileMap[instance.MetaFileName], "events")
+
+		var meta instance.Meta
+		assert.Nil(t, json.Unmarshal([]byte(fileMap[instance.MetaFileName]), &meta))
+		assert.Equal(t, []instance.VariableMeta{
+			{Name: "BUCKET", Source: instance.VariableSourceGlobal},
+			{Name: "DEND", Source: instance.VariableSourceInstance},
+			{Name: "DSTART", Source: instance.VariableSourceInstance},
+			{Name: "EXECUTION_TIME", Source: instance.VariableSourceInstance},
+			{Name: "REGION", Source: instance.VariableSourceGlobal, Defaulted: true},
+			{Name: "TABLE", Source: instance.VariableSourceConfig},
+			{Name: "TOKEN", Source: instance.VariableSourceSecret, Secret: true},
+		}, meta.Variables)
+	})
+	t.Run("should name envs the way they are generated", func(t *testing.T) {
+		namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(models.JobSpecConfigs{
+			{
+				Name:  "SECRET__TOKEN",
+				Value: "literal-token",
+			},
+		}, nil)
+		contextManager := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t))
+
+		_, fileMap, err := contextManager.Generate(instanceSpec, models.InstanceTypeTask, "bq",
+			instance.WithMetaFile(), instance.WithEnvKeyPrefix("optimus."), instance.WithPOSIXEnvKeys())
+		assert.Nil(t, err)
+		assert.NotContains(t, fileMap[instance.MetaFileName], "literal-token")
+
+		var meta instance.Meta
+		assert.Nil(t, json.Unmarshal([]byte(fileMap[instance.MetaFileName]), &meta))
+		assert.Equal(t, []instance.VariableMeta{
+			{Name: "OPTIMUS_DEND", Source: instance.VariableSourceInstance},
+			{Name: "OPTIMUS_DSTART", Source: instance.VariableSourceInstance},
+			{Name: "OPTIMUS_EXECUTION_TIME", Source: instance.VariableSourceInstance},
+			{Name: "OPTIMUS_SECRET__TOKEN", Source: instance.VariableSourceSecret, Secret: true},
+		}, meta.Variables)
+	})
+	t.Run("should not add the file unless asked", func(t *testing.T) {
+		namespaceSpec, jobSpec, instanceSpec := newGenerateFixture(nil, nil)
+
+		_, fileMap, err := instance.NewContextManager(namespaceSpec, jobSpec, newGoEngine(t)).Generate(
+			instanceSpec, models.InstanceTypeTask, "bq")
+		assert.Nil(t, err)
+		assert.NotContains(t, fileMap, instance.MetaFileName)
+	})
+}
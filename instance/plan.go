@@ -0,0 +1,52 @@
+package instance
+
+import (
+	"sort"
+	"time"
+
+	"github.com/odpf/optimus/core/cron"
+	"github.com/odpf/optimus/models"
+	"github.com/pkg/errors"
+)
+
+// Plan summarizes the first run of the job scheduled after at, with its
+// window, the envs its task runs with and the jobs it depends on. Jobs
+// without a window of their own use the default window of the project
+func Plan(projectSpec models.ProjectSpec, jobSpec models.JobSpec, at time.Time) (models.ExecutionPlan, error) {
+	schedule, err := cron.ParseCronSchedule(jobSpec.Schedule.Interval)
+	if err != nil {
+		return models.ExecutionPlan{}, errors.Wrapf(err, "failed to parse schedule interval %s of %s",
+			jobSpec.Schedule.Interval, jobSpec.Name)
+	}
+	if at.Before(jobSpec.Schedule.StartDate) {
+		// the start date itself is a valid schedule time
+		at = jobSpec.Schedule.StartDate.Add(-time.Second)
+	}
+	scheduledAt := schedule.Next(at)
+
+	window, _, err := projectSpec.WindowOf(jobSpec.Task.Window)
+	if err != nil {
+		return models.ExecutionPlan{}, err
+	}
+
+	envKeys := []string{ConfigKeyExecutionTime, ConfigKeyDstart, ConfigKeyDend, ConfigKeyDestination}
+	for _, config := range jobSpec.Task.Config {
+		envKeys = append(envKeys, config.Name)
+	}
+	sort.Strings(envKeys)
+
+	var dependencies []string
+	for name := range jobSpec.Dependencies {
+		dependencies = append(dependencies, name)
+	}
+	sort.Strings(dependencies)
+
+	return models.ExecutionPlan{
+		JobName:      jobSpec.Name,
+		ScheduledAt:  scheduledAt,
+		WindowStart:  window.GetStart(scheduledAt),
+		WindowEnd:    window.GetEnd(scheduledAt),
+		EnvKeys:      envKeys,
+		Dependencies: dependencies,
+	}, nil
+}
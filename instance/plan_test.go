@@ -0,0 +1,77 @@
+package instance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	projectSpec := models.ProjectSpec{
+		Name: "humara-projectSpec",
+		Config: map[string]string{
+			models.ProjectDefaultWindowSizeKey:       "48h",
+			models.ProjectDefaultWindowTruncateToKey: "d",
+		},
+	}
+	jobSpec := models.JobSpec{
+		Name: "foo",
+		Schedule: models.JobSpecSchedule{
+			StartDate: time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC),
+			Interval:  "0 2 * * *",
+		},
+		Task: models.JobSpecTask{
+			Window: models.JobSpecTaskWindow{
+				Size:       24 * time.Hour,
+				TruncateTo: "d",
+			},
+			Config: models.JobSpecConfigs{
+				{
+					Name:  "PROJECT",
+					Value: "{{.GLOBAL__project}}",
+				},
+				{
+					Name:  "DATASET",
+					Value: "playground",
+				},
+			},
+		},
+		Dependencies: map[string]models.JobSpecDependency{
+			"upstream-b": {},
+			"upstream-a": {},
+		},
+	}
+
+	t.Run("should plan the next run of the job", func(t *testing.T) {
+		plan, err := instance.Plan(projectSpec, jobSpec, time.Date(2020, 11, 10, 5, 0, 0, 0, time.UTC))
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", plan.JobName)
+		assert.Equal(t, time.Date(2020, 11, 11, 2, 0, 0, 0, time.UTC), plan.ScheduledAt)
+		assert.Equal(t, time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC), plan.WindowStart)
+		assert.Equal(t, time.Date(2020, 11, 11, 0, 0, 0, 0, time.UTC), plan.WindowEnd)
+		assert.Equal(t, []string{"DATASET", "DEND", "DSTART", "EXECUTION_TIME", "JOB_DESTINATION", "PROJECT"}, plan.EnvKeys)
+		assert.Equal(t, []string{"upstream-a", "upstream-b"}, plan.Dependencies)
+	})
+	t.Run("should plan the first run for jobs yet to start", func(t *testing.T) {
+		plan, err := instance.Plan(projectSpec, jobSpec, time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC))
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2020, 11, 1, 2, 0, 0, 0, time.UTC), plan.ScheduledAt)
+	})
+	t.Run("should use default window of the project for jobs without a window", func(t *testing.T) {
+		jobSpec := jobSpec
+		jobSpec.Task.Window = models.JobSpecTaskWindow{}
+		plan, err := instance.Plan(projectSpec, jobSpec, time.Date(2020, 11, 10, 5, 0, 0, 0, time.UTC))
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2020, 11, 9, 0, 0, 0, 0, time.UTC), plan.WindowStart)
+		assert.Equal(t, time.Date(2020, 11, 11, 0, 0, 0, 0, time.UTC), plan.WindowEnd)
+	})
+	t.Run("should fail for invalid schedule interval", func(t *testing.T) {
+		jobSpec := jobSpec
+		jobSpec.Schedule.Interval = "every day"
+		_, err := instance.Plan(projectSpec, jobSpec, time.Now())
+		assert.NotNil(t, err)
+	})
+}
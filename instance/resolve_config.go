@@ -0,0 +1,67 @@
+package instance
+
+import (
+	"fmt"
+
+	"github.com/odpf/optimus/models"
+)
+
+// instanceVariables are derived from an instance of the job when it runs
+var instanceVariables = []string{
+	ConfigKeyDstart,
+	ConfigKeyDend,
+	ConfigKeyDendInclusive,
+	ConfigKeyExecutionTime,
+	ConfigKeyDestination,
+	ConfigKeyIsCatchup,
+}
+
+// ResolveConfig returns the configs the task or a hook of the job sees
+// after merging and resolving templates against configs of the project,
+// without rendering assets. Unlike envs of Generate, variables derived from
+// an instance, secrets and outputs of other hooks are left as references,
+// e.g. {{.DSTART}}, as these are only known when the job runs
+func ResolveConfig(projectSpec models.ProjectSpec, jobSpec models.JobSpec, instanceType models.InstanceType,
+	name string) (map[string]string, error) {
+	engine, err := NewGoEngine()
+	if err != nil {
+		return nil, err
+	}
+	fm, err := NewContextManager(models.NamespaceSpec{ProjectSpec: projectSpec}, jobSpec, engine).
+		withOptions(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	projectPrefixedConfig, projRawConfig := fm.projectEnvs()
+	templateContext := MergeInterfaceMapToInterface(projectPrefixedConfig, nil)
+	templateContext["proj"] = projRawConfig
+	templateContext[ConfigKeyScheduleInterval] = jobSpec.Schedule.Interval
+	templateContext[ConfigKeyStartDate] = jobSpec.Schedule.StartDate.Format(models.JobDatetimeLayout)
+	for _, key := range instanceVariables {
+		templateContext[key] = variableReference(key)
+	}
+
+	var templates []string
+	for _, config := range jobSpec.Task.Config {
+		templates = append(templates, config.Value)
+	}
+	for _, hook := range jobSpec.Hooks {
+		for _, config := range hook.Config {
+			templates = append(templates, config.Value)
+		}
+	}
+	for _, tmpl := range templates {
+		for _, match := range secretReference.FindAllString(tmpl, -1) {
+			templateContext[match] = variableReference(match)
+		}
+		for _, match := range hookOutputReference.FindAllString(tmpl, -1) {
+			templateContext[match] = variableReference(match)
+		}
+	}
+	return fm.generateEnvs(models.InstanceSpec{}, name, instanceType, templateContext)
+}
+
+func variableReference(key string) string {
+	return fmt.Sprintf("{{.%s}}", key)
+}
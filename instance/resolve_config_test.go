@@ -0,0 +1,82 @@
+package instance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/odpf/optimus/mock"
+	"github.com/odpf/optimus/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveConfig(t *testing.T) {
+	projectSpec := models.ProjectSpec{
+		Name: "humara-projectSpec",
+		Config: map[string]string{
+			"bucket": "gs://some_folder",
+		},
+	}
+	hookUnit := new(mock.BasePlugin)
+	hookUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+		Name:       "transporter",
+		PluginType: models.PluginTypeHook,
+	}, nil)
+	jobSpec := models.JobSpec{
+		Name: "foo",
+		Schedule: models.JobSpecSchedule{
+			StartDate: time.Date(2000, 11, 11, 0, 0, 0, 0, time.UTC),
+			Interval:  "0 2 * * *",
+		},
+		Task: models.JobSpecTask{
+			Config: models.JobSpecConfigs{
+				{
+					Name:  "BUCKET",
+					Value: "{{.GLOBAL__bucket}}/tables",
+				},
+				{
+					Name:  "FILTER",
+					Value: "ts >= '{{.DSTART}}'",
+				},
+			},
+		},
+		Hooks: []models.JobSpecHook{
+			{
+				Config: models.JobSpecConfigs{
+					{
+						Name:  "SOURCE",
+						Value: "{{.TASK__BUCKET}}",
+					},
+					{
+						Name:  "TOKEN",
+						Value: "{{.SECRET__kafka_token}}",
+					},
+				},
+				Unit: &models.Plugin{Base: hookUnit},
+			},
+		},
+	}
+
+	t.Run("should resolve configs of the task", func(t *testing.T) {
+		config, err := instance.ResolveConfig(projectSpec, jobSpec, models.InstanceTypeTask, "bq")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"BUCKET": "gs://some_folder/tables",
+			"FILTER": "ts >= '{{.DSTART}}'",
+		}, config)
+	})
+	t.Run("should resolve configs of the hook along with inherited task configs", func(t *testing.T) {
+		config, err := instance.ResolveConfig(projectSpec, jobSpec, models.InstanceTypeHook, "transporter")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"TASK__BUCKET": "gs://some_folder/tables",
+			"TASK__FILTER": "ts >= '{{.DSTART}}'",
+			"SOURCE":       "gs://some_folder/tables",
+			"TOKEN":        "{{.SECRET__kafka_token}}",
+		}, config)
+	})
+	t.Run("should fail for unknown hooks", func(t *testing.T) {
+		_, err := instance.ResolveConfig(projectSpec, jobSpec, models.InstanceTypeHook, "predator")
+		assert.NotNil(t, err)
+	})
+}
@@ -12,10 +12,17 @@ import (
 
 const (
 	// these configs can be used as macros in task/hook config and job assets
-	ConfigKeyDstart        = "DSTART"
-	ConfigKeyDend          = "DEND"
-	ConfigKeyExecutionTime = "EXECUTION_TIME"
-	ConfigKeyDestination   = "JOB_DESTINATION"
+	ConfigKeyDstart           = "DSTART"
+	ConfigKeyDend             = "DEND"
+	ConfigKeyExecutionTime    = "EXECUTION_TIME"
+	ConfigKeyDestination      = "JOB_DESTINATION"
+	ConfigKeyIsCatchup        = "IS_CATCHUP"
+	ConfigKeyScheduleInterval = "SCHEDULE_INTERVAL"
+	ConfigKeyStartDate        = "START_DATE"
+
+	// ConfigKeyDendInclusive is the last second of the window, for engines
+	// treating the upper bound as inclusive, i.e. ts <= DEND_INCLUSIVE
+	ConfigKeyDendInclusive = "DEND_INCLUSIVE"
 )
 
 type InstanceSpecRepoFactory interface {
@@ -0,0 +1,41 @@
+package instance
+
+import (
+	"github.com/pkg/errors"
+)
+
+// UpstreamLookup resolves outputs published by upstream jobs, e.g. path of
+// the data a run of the job produced
+type UpstreamLookup interface {
+	GetOutput(jobName, key string) (string, error)
+}
+
+// UpstreamOutputs is an UpstreamLookup of outputs by key per job name
+type UpstreamOutputs map[string]map[string]string
+
+func (o UpstreamOutputs) GetOutput(jobName, key string) (string, error) {
+	outputs, ok := o[jobName]
+	if !ok {
+		return "", errors.Errorf("unknown upstream job %s", jobName)
+	}
+	val, ok := outputs[key]
+	if !ok {
+		return "", errors.Errorf("upstream job %s has no output %s", jobName, key)
+	}
+	return val, nil
+}
+
+// upstreamFn returns the upstream template function resolving outputs of
+// upstream jobs with the lookup, e.g. {{ upstream "producer" "output_path" }}
+func upstreamFn(lookup UpstreamLookup) func(string, string) (string, error) {
+	return func(jobName, key string) (string, error) {
+		if lookup == nil {
+			return "", errors.Errorf("failed to resolve output %s of upstream job %s: no upstream lookup configured", key, jobName)
+		}
+		val, err := lookup.GetOutput(jobName, key)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve output %s of upstream job %s", key, jobName)
+		}
+		return val, nil
+	}
+}
@@ -0,0 +1,29 @@
+package instance_test
+
+import (
+	"testing"
+
+	"github.com/odpf/optimus/instance"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamOutputs(t *testing.T) {
+	outputs := instance.UpstreamOutputs{
+		"producer": {
+			"output_path": "gs://bucket/producer/2020-11-10",
+		},
+	}
+	t.Run("should return output of upstream job", func(t *testing.T) {
+		val, err := outputs.GetOutput("producer", "output_path")
+		assert.Nil(t, err)
+		assert.Equal(t, "gs://bucket/producer/2020-11-10", val)
+	})
+	t.Run("should fail for unknown upstream job", func(t *testing.T) {
+		_, err := outputs.GetOutput("unknown", "output_path")
+		assert.EqualError(t, err, "unknown upstream job unknown")
+	})
+	t.Run("should fail for unknown output of upstream job", func(t *testing.T) {
+		_, err := outputs.GetOutput("producer", "row_count")
+		assert.EqualError(t, err, "upstream job producer has no output row_count")
+	})
+}
@@ -2,6 +2,8 @@ package job
 
 import (
 	"bytes"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -21,6 +23,23 @@ var (
 type Compiler struct {
 	schedulerTemplate []byte // template string for dag generation
 	hostname          string
+
+	// Now is the time jobs starting from now are compiled at
+	Now func() time.Time
+
+	// template is parsed once on first compile and shared by all compiles
+	// after, execution of a parsed template is safe for concurrent use
+	parseOnce sync.Once
+	tmpl      *template.Template
+	parseErr  error
+}
+
+// parsedTemplate returns the parsed scheduler template
+func (com *Compiler) parsedTemplate() (*template.Template, error) {
+	com.parseOnce.Do(func() {
+		com.tmpl, com.parseErr = template.New("compiler").Funcs(sprig.TxtFuncMap()).Parse(string(com.schedulerTemplate))
+	})
+	return com.tmpl, com.parseErr
 }
 
 // Compile use golang template engine to parse and insert job
@@ -30,11 +49,24 @@ func (com *Compiler) Compile(namespaceSpec models.NamespaceSpec, jobSpec models.
 		return models.Job{}, ErrEmptyTemplateFile
 	}
 
-	tmpl, err := template.New("compiler").Funcs(sprig.TxtFuncMap()).Parse(string(com.schedulerTemplate))
+	tmpl, err := com.parsedTemplate()
 	if err != nil {
 		return models.Job{}, err
 	}
 
+	// the start mode decides catch up and the date runs start from
+	startMode := jobSpec.StartModeIn(namespaceSpec.ProjectSpec)
+	if err := startMode.Validate(); err != nil {
+		return models.Job{}, errors.Wrapf(err, "failed to compile job %s", jobSpec.Name)
+	}
+	jobSpec.Behavior.CatchUp = startMode.CatchUp(jobSpec.Behavior.CatchUp)
+	jobSpec.Schedule.StartDate = startMode.StartDate(jobSpec.Schedule.StartDate, com.Now())
+
+	// jobs without a window of their own use the default of the project
+	if jobSpec.Task.Window, _, err = namespaceSpec.ProjectSpec.WindowOf(jobSpec.Task.Window); err != nil {
+		return models.Job{}, errors.Wrapf(err, "failed to compile job %s", jobSpec.Name)
+	}
+
 	var slaMissDurationInSec int64
 	for _, notify := range jobSpec.Behavior.Notify {
 		if notify.On == models.JobEventTypeSLAMiss {
@@ -90,10 +122,88 @@ func (com *Compiler) Compile(namespaceSpec models.NamespaceSpec, jobSpec models.
 	}, nil
 }
 
+// CompileCanonical works like Compile returning only the content of the dag
+// relevant for comparison, e.g. for ci checking if a change alters dags.
+// Dags uploaded to the scheduler must use Compile to keep full content
+func (com *Compiler) CompileCanonical(namespaceSpec models.NamespaceSpec, jobSpec models.JobSpec) (models.Job, error) {
+	job, err := com.Compile(namespaceSpec, jobSpec)
+	if err != nil {
+		return models.Job{}, err
+	}
+	job.Contents = CanonicalDag(job.Contents)
+	return job, nil
+}
+
+// CanonicalDag strips content of a rendered dag which varies across renders
+// without changing its behaviour, like comments carrying the generator
+// version or render time, blank lines and trailing whitespace. Python
+// string literals are kept intact, including '#' and blank lines within
+// multi-line strings
+func CanonicalDag(contents []byte) []byte {
+	var lines []string
+	quote := ""
+	for _, line := range strings.Split(string(contents), "\n") {
+		startsInString := quote != ""
+		line, quote = stripPythonComment(line, quote)
+		if quote != "" {
+			// trailing whitespace belongs to the string literal
+			lines = append(lines, line)
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if !startsInString && strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// stripPythonComment cuts the comment off a line of python source, quote is
+// the delimiter of the string literal the line starts in, empty if none. It
+// returns the delimiter of the string literal still open at the end of the
+// line, only multi-line strings and strings continued with a backslash stay
+// open across lines
+func stripPythonComment(line, quote string) (string, string) {
+	continued := false
+	for i := 0; i < len(line); {
+		if quote != "" {
+			switch {
+			case line[i] == '\\':
+				continued = i == len(line)-1
+				i += 2
+			case strings.HasPrefix(line[i:], quote):
+				i += len(quote)
+				quote = ""
+			default:
+				i++
+			}
+			continue
+		}
+		switch line[i] {
+		case '#':
+			return line[:i], ""
+		case '\'', '"':
+			quote = line[i : i+1]
+			if triple := strings.Repeat(quote, 3); strings.HasPrefix(line[i:], triple) {
+				quote = triple
+			}
+			i += len(quote)
+		default:
+			i++
+		}
+	}
+	if len(quote) == 1 && !continued {
+		quote = ""
+	}
+	return line, quote
+}
+
 // NewCompiler constructs a new Compiler that satisfies dag.Compiler
 func NewCompiler(schedulerTemplate []byte, hostname string) *Compiler {
 	return &Compiler{
 		schedulerTemplate: schedulerTemplate,
 		hostname:          hostname,
+		Now:               time.Now,
 	}
 }
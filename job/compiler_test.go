@@ -1,6 +1,7 @@
 package job_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -94,5 +95,79 @@ func TestCompiler(t *testing.T) {
 			_, err := com.Compile(namespaceSpec, spec)
 			assert.Error(t, err)
 		})
+		t.Run("should compile concurrently sharing the parsed template", func(t *testing.T) {
+			com := job.NewCompiler(
+				[]byte("content = {{.Job.Name}}"),
+				"",
+			)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					dag, err := com.Compile(namespaceSpec, spec)
+					assert.Nil(t, err)
+					assert.Equal(t, []byte("content = foo"), dag.Contents)
+				}()
+			}
+			wg.Wait()
+		})
+	})
+	t.Run("CompileCanonical", func(t *testing.T) {
+		t.Run("should canonicalize renders at different times identically", func(t *testing.T) {
+			com := job.NewCompiler(
+				[]byte("# generated by optimus {{.Version}} at {{ now.UnixNano }}\n\ndag_id = {{.Job.Name | quote}}  \n    # rendered at {{ now.UnixNano }}\nowner = {{.Job.Owner | quote}}\n"),
+				"",
+			)
+			first, err := com.Compile(namespaceSpec, spec)
+			assert.Nil(t, err)
+			time.Sleep(time.Millisecond)
+			second, err := com.Compile(namespaceSpec, spec)
+			assert.Nil(t, err)
+			assert.NotEqual(t, string(first.Contents), string(second.Contents))
+
+			firstCanonical, err := com.CompileCanonical(namespaceSpec, spec)
+			assert.Nil(t, err)
+			time.Sleep(time.Millisecond)
+			secondCanonical, err := com.CompileCanonical(namespaceSpec, spec)
+			assert.Nil(t, err)
+			assert.Equal(t, "dag_id = \"foo\"\nowner = \"mee@mee\"", string(firstCanonical.Contents))
+			assert.Equal(t, firstCanonical.Contents, secondCanonical.Contents)
+		})
+	})
+	t.Run("CanonicalDag", func(t *testing.T) {
+		t.Run("should strip comments, blank lines and trailing whitespace outside strings", func(t *testing.T) {
+			testCases := []struct {
+				Name     string
+				Dag      string
+				Expected string
+			}{
+				{
+					Name:     "comments and blank lines",
+					Dag:      "# generated by optimus\n\ndag_id = \"foo\"  # inline comment\n    # indented comment\nowner = \"mee\"  \r\n",
+					Expected: "dag_id = \"foo\"\nowner = \"mee\"",
+				},
+				{
+					Name:     "hash in single line strings",
+					Dag:      "query = 'select \\'#\\' from t'  # comment\nsep = \"#\"\n",
+					Expected: "query = 'select \\'#\\' from t'\nsep = \"#\"",
+				},
+				{
+					Name:     "multi-line strings",
+					Dag:      "doc_md = \"\"\"\n# Heading\n\n  details  \n\"\"\"  # end of doc\nsql = '''it's\n# kept\n'''\n",
+					Expected: "doc_md = \"\"\"\n# Heading\n\n  details  \n\"\"\"\nsql = '''it's\n# kept\n'''",
+				},
+				{
+					Name:     "strings continued with a backslash",
+					Dag:      "query = \"select \\\n# kept\"\n",
+					Expected: "query = \"select \\\n# kept\"",
+				},
+			}
+			for _, testCase := range testCases {
+				t.Run(testCase.Name, func(t *testing.T) {
+					assert.Equal(t, testCase.Expected, string(job.CanonicalDag([]byte(testCase.Dag))))
+				})
+			}
+		})
 	})
 }
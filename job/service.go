@@ -10,6 +10,7 @@ import (
 
 	"github.com/kushsharma/parallel"
 	"github.com/odpf/optimus/core/progress"
+	"github.com/odpf/optimus/instance"
 	"github.com/odpf/optimus/meta"
 	"github.com/odpf/optimus/models"
 	"github.com/odpf/optimus/store"
@@ -154,6 +155,10 @@ func (srv *Service) Check(namespace models.NamespaceSpec, jobSpecs []models.JobS
 		jobSpecs[i].Dependencies = map[string]models.JobSpecDependency{}
 	}
 
+	// globals available to jobs come from both project and namespace configs
+	globalsSpec := namespace.ProjectSpec
+	globalsSpec.Config = instance.ResolveGlobalConfig(nil, namespace.ProjectSpec.Config, namespace.Config, nil)
+
 	runner := parallel.NewRunner(parallel.WithTicket(ConcurrentTicketPerSec), parallel.WithLimit(ConcurrentLimit))
 	for _, jSpec := range jobSpecs {
 		runner.Add(func(currentSpec models.JobSpec) func() (interface{}, error) {
@@ -175,6 +180,14 @@ func (srv *Service) Check(namespace models.NamespaceSpec, jobSpecs []models.JobS
 					}
 				}
 
+				// check globals referenced by the job are configured
+				if err := instance.ValidateGlobalRefs(globalsSpec, currentSpec); err != nil {
+					if obs != nil {
+						obs.Notify(&EventJobCheckFailed{Name: currentSpec.Name, Reason: fmt.Sprintf("global references: %s\n", err.Error())})
+					}
+					return nil, err
+				}
+
 				// check compilation
 				if _, err := srv.compiler.Compile(namespace, currentSpec); err != nil {
 					if obs != nil {
@@ -16,6 +16,22 @@ func (m *ObjectWriter) NewWriter(ctx context.Context, bucket, path string) (io.W
 	return args.Get(0).(io.WriteCloser), args.Error(1)
 }
 
+func (m *ObjectWriter) Delete(ctx context.Context, bucket, path string) error {
+	return m.Called(ctx, bucket, path).Error(0)
+}
+
+type ObjectReader struct {
+	mock.Mock
+}
+
+func (m *ObjectReader) NewReader(bucket, path string) (io.ReadCloser, error) {
+	args := m.Called(bucket, path)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 // mock write closer
 type WriteCloser struct {
 	mock.Mock
@@ -0,0 +1,19 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MetricsRecorder struct {
+	mock.Mock
+}
+
+func (m *MetricsRecorder) IncCounter(name string, labels map[string]string) {
+	m.Called(name, labels)
+}
+
+func (m *MetricsRecorder) ObserveDuration(name string, labels map[string]string, duration time.Duration) {
+	m.Called(name, labels, duration)
+}
@@ -68,3 +68,12 @@ type PipelineLogObserver struct {
 func (obs *PipelineLogObserver) Notify(evt progress.Event) {
 	obs.Called(evt)
 }
+
+type SecretProvider struct {
+	mock.Mock
+}
+
+func (p *SecretProvider) Get(name string) (string, error) {
+	args := p.Called(name)
+	return args.String(0), args.Error(1)
+}
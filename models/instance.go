@@ -17,11 +17,18 @@ const (
 	// files will be used to store temporary data passed around for inter-task
 	// communication
 	InstanceDataTypeFile = "file"
+	// conf is the run configuration passed while triggering a run, it is
+	// available for templating assets and configs of task and hooks
+	InstanceDataTypeConf = "conf"
+	// hook output is a value published by a hook for the hooks running after
+	// it, named as <hook name>__<key>
+	InstanceDataTypeHookOutput = "hook_output"
 
 	// InstanceDataTypeEnvFileName is run data env type file name
 	InstanceDataTypeEnvFileName = ".env"
 
-	// iso 2021-01-14T02:00:00+00:00
+	// iso 2021-01-14T02:00:00+00:00, layout of times exchanged with
+	// schedulers and stored in instance data
 	InstanceScheduledAtTimeLayout = time.RFC3339
 
 	InstanceStateRunning = "running"
@@ -74,6 +81,20 @@ func (j *InstanceSpec) DataToJSON() ([]byte, error) {
 	return json.Marshal(j.Data)
 }
 
+// ExecutionPlan summarizes the next run of a job without registering an
+// instance for it
+type ExecutionPlan struct {
+	JobName     string
+	ScheduledAt time.Time
+	WindowStart time.Time
+	WindowEnd   time.Time
+
+	// EnvKeys are names of envs the task of the job runs with, sorted
+	EnvKeys []string
+	// Dependencies are names of jobs the job depends on, sorted
+	Dependencies []string
+}
+
 type InstanceService interface {
 	Register(jobSpec JobSpec, scheduledAt time.Time, taskType InstanceType) (InstanceSpec, error)
 	Compile(namespaceSpec NamespaceSpec, jobSpec JobSpec, instanceSpec InstanceSpec,
@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/odpf/optimus/core/cron"
 	"github.com/odpf/optimus/core/tree"
 
 	"github.com/google/uuid"
@@ -24,6 +27,10 @@ var (
 	ErrNoResources = errors.New("no resources found")
 	ErrNoSuchAsset = errors.New("asset not found")
 	ErrNoSuchHook  = errors.New("hook not found")
+	ErrNoSuchTask  = errors.New("task not found")
+
+	ErrIntervalFinerThanWindow = errors.New("schedule interval is finer than task window")
+	ErrUnknownTaskReference    = errors.New("reference to unknown task config")
 )
 
 const (
@@ -32,6 +39,9 @@ const (
 	// assuming all month are 30 days long for simplicity
 	HoursInMonth = time.Duration(30) * 24 * time.Hour
 
+	// quarters are treated as 3 months, i.e. 90 days, for simplicity
+	HoursInQuarter = 3 * HoursInMonth
+
 	// within a project
 	JobSpecDependencyTypeIntra JobSpecDependencyType = "intra"
 	// within optimus but cross project
@@ -57,7 +67,10 @@ type JobSpec struct {
 	Task         JobSpecTask
 	Dependencies map[string]JobSpecDependency // job name to dependency
 	Assets       JobAssets
-	Hooks        []JobSpecHook
+
+	// Hooks in declaration order, which is the order they are processed in
+	// unless dependencies among them require otherwise, see OrderedHooks
+	Hooks []JobSpecHook
 }
 
 func (js JobSpec) GetName() string {
@@ -73,6 +86,91 @@ func (js JobSpec) GetHookByName(name string) (JobSpecHook, error) {
 	return JobSpecHook{}, ErrNoSuchHook
 }
 
+// OrderedHooks returns hooks of the job in the order they are processed,
+// which is declaration order with hooks moved after the hooks they depend
+// on, keeping generation of hook configs and outputs reproducible
+func (js JobSpec) OrderedHooks() []JobSpecHook {
+	declared := map[string]bool{}
+	for _, hook := range js.Hooks {
+		declared[hook.Unit.Info().Name] = true
+	}
+
+	ordered := make([]JobSpecHook, 0, len(js.Hooks))
+	processed := map[string]bool{}
+	pending := append([]JobSpecHook{}, js.Hooks...)
+	for len(pending) > 0 {
+		next := 0
+		for idx, hook := range pending {
+			ready := true
+			for _, dependency := range hook.DependsOn {
+				name := dependency.Unit.Info().Name
+				if declared[name] && !processed[name] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = idx
+				break
+			}
+		}
+		// hooks depending on each other fall back to declaration order
+		ordered = append(ordered, pending[next])
+		processed[pending[next].Unit.Info().Name] = true
+		pending = append(pending[:next], pending[next+1:]...)
+	}
+	return ordered
+}
+
+// maxCountedCatchupRuns bounds the runs ExpectedCatchupRuns counts one by
+// one, runs beyond are extrapolated
+const maxCountedCatchupRuns = 10000
+
+// ExpectedCatchupRuns counts the runs scheduler will trigger to catch up
+// from start date of the job till now, a run is due once its interval
+// has passed. Counts above maxCountedCatchupRuns are approximate,
+// extrapolated from the pace of the runs counted
+func (js JobSpec) ExpectedCatchupRuns(now time.Time) (int, error) {
+	schd, err := cron.ParseCronSchedule(js.Schedule.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse schedule interval %s: %w", js.Schedule.Interval, err)
+	}
+	end := now
+	if js.Schedule.EndDate != nil && js.Schedule.EndDate.Before(now) {
+		end = *js.Schedule.EndDate
+	}
+
+	runs := 0
+	first := schd.Next(js.Schedule.StartDate.Add(-time.Second))
+	for tick := first; !tick.IsZero(); {
+		// intervals which parse but never fire, like 0 0 30 2 *, have
+		// zero as next tick
+		next := schd.Next(tick)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		runs++
+		if runs == maxCountedCatchupRuns {
+			return int(float64(runs) * float64(end.Sub(first)) / float64(next.Sub(first))), nil
+		}
+		tick = next
+	}
+	return runs, nil
+}
+
+// StartModeIn returns the start mode the job runs with in the project, its
+// own start mode, else start_date if the job enables catch up, else the
+// start mode configured for the project
+func (js JobSpec) StartModeIn(projectSpec ProjectSpec) JobStartMode {
+	if js.Behavior.StartMode != "" {
+		return js.Behavior.StartMode
+	}
+	if js.Behavior.CatchUp {
+		return JobStartFromStartDate
+	}
+	return JobStartMode(projectSpec.Config[ProjectJobStartModeKey])
+}
+
 func (js JobSpec) GetLabelsAsString() string {
 	labels := ""
 	for k, v := range js.Labels {
@@ -92,6 +190,56 @@ type JobSpecBehavior struct {
 	CatchUp       bool
 	Retry         JobSpecBehaviorRetry
 	Notify        []JobSpecNotifier
+
+	// StartMode overrides CatchUp when set, see JobStartMode
+	StartMode JobStartMode
+}
+
+// JobStartMode tells which runs the scheduler starts with on first deploy
+// of a job, making the intent behind catching up explicit
+type JobStartMode string
+
+const (
+	// JobStartFromStartDate runs every interval since start date of the
+	// job, backfilling intervals passed before the deploy
+	JobStartFromStartDate JobStartMode = "start_date"
+
+	// JobStartFromNow runs the latest interval onwards, skipping the
+	// intervals passed before the deploy
+	JobStartFromNow JobStartMode = "now"
+)
+
+// Validate checks the start mode is a known one, empty is allowed
+func (m JobStartMode) Validate() error {
+	switch m {
+	case "", JobStartFromStartDate, JobStartFromNow:
+		return nil
+	}
+	return fmt.Errorf("invalid start mode %s, expected one of %s, %s", m, JobStartFromStartDate, JobStartFromNow)
+}
+
+// CatchUp tells if the scheduler should catch up runs for the start mode,
+// fallback is used when no start mode is set
+func (m JobStartMode) CatchUp(fallback bool) bool {
+	switch m {
+	case JobStartFromStartDate:
+		return true
+	case JobStartFromNow:
+		return false
+	}
+	return fallback
+}
+
+// StartDate returns the date the scheduler starts runs from, the day of
+// now for JobStartFromNow unless the job starts later
+func (m JobStartMode) StartDate(startDate, now time.Time) time.Time {
+	if m != JobStartFromNow {
+		return startDate
+	}
+	if today := now.UTC().Truncate(24 * time.Hour); today.After(startDate) {
+		return today
+	}
+	return startDate
 }
 
 type JobSpecBehaviorRetry struct {
@@ -111,6 +259,42 @@ type JobSpecTask struct {
 	Config   JobSpecConfigs
 	Window   JobSpecTaskWindow
 	Priority int
+
+	// Subtasks are named variants of the task run with configs of their
+	// own, a stepping stone towards jobs with many tasks
+	Subtasks []JobSpecSubtask
+}
+
+// JobSpecSubtask runs the unit of the task with its configs overridden by
+// Config, using only the assets of the job named in Assets, all if empty
+type JobSpecSubtask struct {
+	Name   string
+	Config JobSpecConfigs
+	Assets []string
+}
+
+// GetTaskByName returns the task of the job as named by its unit, or a
+// subtask of that name
+func (t JobSpecTask) GetTaskByName(name string) (JobSpecTask, error) {
+	if t.Unit != nil && t.Unit.Info().Name == name {
+		return t, nil
+	}
+	for _, subtask := range t.Subtasks {
+		if subtask.Name != name {
+			continue
+		}
+		task := t
+		task.Config = JobSpecConfigs{}
+		for _, config := range t.Config {
+			if _, ok := subtask.Config.Get(config.Name); !ok {
+				task.Config = append(task.Config, config)
+			}
+		}
+		task.Config = append(task.Config, subtask.Config...)
+		task.Subtasks = nil
+		return task, nil
+	}
+	return JobSpecTask{}, ErrNoSuchTask
 }
 
 // using array to keep order, map would be more performant
@@ -130,20 +314,137 @@ type JobSpecConfigItem struct {
 	Value string
 }
 
+var taskConfigReference = regexp.MustCompile(`\bTASK__(\w+)`)
+
+// ValidateHookReferences checks every TASK__ variable referenced in configs
+// of hooks is a config of the task, as hooks inherit task configs with
+// that prefix
+func (js JobSpec) ValidateHookReferences() error {
+	taskConfigs := map[string]bool{}
+	for _, config := range js.Task.Config {
+		taskConfigs[config.Name] = true
+	}
+	for _, hook := range js.OrderedHooks() {
+		for _, config := range hook.Config {
+			for _, match := range taskConfigReference.FindAllStringSubmatch(config.Value, -1) {
+				if taskConfigs[match[1]] {
+					continue
+				}
+				return fmt.Errorf("%w: config %s of hook %s references %s", ErrUnknownTaskReference,
+					config.Name, hook.Unit.Info().Name, match[0])
+			}
+		}
+	}
+	return nil
+}
+
+// windowGrainSamples is the count of consecutive runs checked to find the
+// shortest gap between runs of a schedule
+const windowGrainSamples = 24
+
+// ValidateWindowGrain checks the schedule interval is not finer than the
+// task window, e.g. an hourly schedule with a daily window, as consecutive
+// runs would then process overlapping windows
+func (js JobSpec) ValidateWindowGrain() error {
+	schd, err := cron.ParseCronSchedule(js.Schedule.Interval)
+	if err != nil {
+		return fmt.Errorf("failed to parse schedule interval %s: %w", js.Schedule.Interval, err)
+	}
+	windowSize := js.Task.Window.Size
+	if js.Task.Window.TruncateTo == "M" {
+		// monthly windows span whole months, shortest of which is 28 days
+		windowSize = (windowSize / HoursInMonth) * 28 * 24 * time.Hour
+	}
+	if js.Task.Window.TruncateTo == "q" {
+		// quarterly windows span whole quarters, shortest of which is 90 days
+		windowSize = (windowSize / HoursInQuarter) * 90 * 24 * time.Hour
+	}
+
+	var shortestGap time.Duration
+	tick := schd.Next(js.Schedule.StartDate)
+	for i := 0; i < windowGrainSamples; i++ {
+		next := schd.Next(tick)
+		if gap := next.Sub(tick); shortestGap == 0 || gap < shortestGap {
+			shortestGap = gap
+		}
+		tick = next
+	}
+	if shortestGap < windowSize {
+		return fmt.Errorf("%w: %s runs every %s with a window of %s", ErrIntervalFinerThanWindow,
+			js.Name, shortestGap, js.Task.Window.Size)
+	}
+	return nil
+}
+
 type JobSpecTaskWindow struct {
 	Size       time.Duration
 	Offset     time.Duration
 	TruncateTo string
+
+	// Unset is set by adapters for jobs which configure none of size,
+	// offset and truncate_to, these use the default window of the project
+	// if it configures one, see ProjectSpec.WindowOf
+	Unset bool
+
+	// GracePeriod shifts the computed window back, keeping its size, for
+	// sources delivering data late
+	GracePeriod time.Duration
+}
+
+var windowMonthExp = regexp.MustCompile(`(\+|-)?([0-9]+)(M)`)
+
+// ParseWindowDuration parses size or offset of a task window, accepting
+// month notation like 1M or -1M12h besides the formats of
+// time.ParseDuration. Months are treated as HoursInMonth long
+func ParseWindowDuration(str string) (time.Duration, error) {
+	monthMatches := windowMonthExp.FindAllStringSubmatch(str, -1)
+	if len(monthMatches) == 0 {
+		return time.ParseDuration(str)
+	}
+
+	// replace month notation with days first
+	monthsCount, err := strconv.Atoi(monthMatches[0][2])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse window duration %s: %w", str, err)
+	}
+	size := HoursInMonth * time.Duration(monthsCount)
+	if monthMatches[0][1] == "-" {
+		size *= -1
+	}
+	if remaining := strings.TrimSpace(windowMonthExp.ReplaceAllString(str, "")); remaining != "" {
+		// check if there is remaining time that we can still parse
+		remainingTime, err := time.ParseDuration(remaining)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse window duration %s: %w", str, err)
+		}
+		size += remainingTime
+	}
+	return size, nil
 }
 
 func (w *JobSpecTaskWindow) GetStart(scheduledAt time.Time) time.Time {
 	s, _ := w.getWindowDate(scheduledAt, w.Size, w.Offset, w.TruncateTo)
-	return s
+	return s.Add(-w.GracePeriod)
 }
 
 func (w *JobSpecTaskWindow) GetEnd(scheduledAt time.Time) time.Time {
 	_, e := w.getWindowDate(scheduledAt, w.Size, w.Offset, w.TruncateTo)
-	return e
+	return e.Add(-w.GracePeriod)
+}
+
+// AttachTo sets the window each run of the job processed, computed from
+// the time the run is scheduled at, correlating runs with their data. The
+// end of the data interval reported by the scheduler is the canonical end
+// of the window when present
+func (w *JobSpecTaskWindow) AttachTo(jobStatus []JobStatus) []JobStatus {
+	for idx := range jobStatus {
+		jobStatus[idx].WindowStart = w.GetStart(jobStatus[idx].ScheduledAt)
+		jobStatus[idx].WindowEnd = w.GetEnd(jobStatus[idx].ScheduledAt)
+		if jobStatus[idx].DataIntervalEnd != nil {
+			jobStatus[idx].WindowEnd = *jobStatus[idx].DataIntervalEnd
+		}
+	}
+	return jobStatus
 }
 
 func (w *JobSpecTaskWindow) getWindowDate(today time.Time, windowSize, windowOffset time.Duration, windowTruncateTo string) (time.Time, time.Time) {
@@ -198,6 +499,18 @@ func (w *JobSpecTaskWindow) getWindowDate(today time.Time, windowSize, windowOff
 		windowStart = floatingStart
 	}
 
+	// quarterly windows align to calendar quarters starting in Jan, Apr, Jul
+	// and Oct, with the current quarter as window when offset is 0
+	if windowTruncateTo == "q" {
+		quarterStart := time.Date(today.Year(), today.Month()-(today.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+
+		// size and offset are in quarters, treating 90 days as 1 quarter
+		offsetQuarters := int(windowOffset / HoursInQuarter)
+		sizeQuarters := int(windowSize / HoursInQuarter)
+		windowEnd = quarterStart.AddDate(0, 3*(offsetQuarters+1), 0)
+		windowStart = windowEnd.AddDate(0, -3*sizeQuarters, 0)
+	}
+
 	return windowStart, windowEnd
 }
 
@@ -266,6 +579,22 @@ func (w *JobSpecTaskWindow) SizeString() string {
 	return w.inHrs(int(w.Size.Hours()))
 }
 
+// GracePeriodString formats the grace period compactly, e.g. 2h or 1h30m,
+// empty if the window has no grace period
+func (w *JobSpecTaskWindow) GracePeriodString() string {
+	if w.GracePeriod == 0 {
+		return ""
+	}
+	str := w.GracePeriod.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
 func (w *JobSpecTaskWindow) OffsetString() string {
 	return w.inHrs(int(w.Offset.Hours()))
 }
@@ -1,9 +1,11 @@
 package models_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/odpf/optimus/mock"
 	"github.com/odpf/optimus/models"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +18,200 @@ func TestJob(t *testing.T) {
 		}
 		assert.Equal(t, "job-name", jobSpec.GetName())
 	})
+	t.Run("OrderedHooks", func(t *testing.T) {
+		newHook := func(name string, dependsOn ...*models.JobSpecHook) models.JobSpecHook {
+			hookUnit := new(mock.BasePlugin)
+			hookUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+				Name:     name,
+				HookType: models.HookTypePre,
+			}, nil)
+			return models.JobSpecHook{
+				Unit:      &models.Plugin{Base: hookUnit},
+				DependsOn: dependsOn,
+			}
+		}
+		hookNames := func(hooks []models.JobSpecHook) []string {
+			var names []string
+			for _, hook := range hooks {
+				names = append(names, hook.Unit.Info().Name)
+			}
+			return names
+		}
+
+		t.Run("should keep declaration order of independent hooks across runs", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Hooks: []models.JobSpecHook{newHook("transporter"), newHook("predator"), newHook("audit"), newHook("notify")},
+			}
+			for run := 0; run < 50; run++ {
+				assert.Equal(t, []string{"transporter", "predator", "audit", "notify"}, hookNames(jobSpec.OrderedHooks()))
+			}
+		})
+		t.Run("should move hooks after the hooks they depend on", func(t *testing.T) {
+			predator := newHook("predator")
+			jobSpec := models.JobSpec{
+				Hooks: []models.JobSpecHook{newHook("transporter", &predator), newHook("audit"), predator},
+			}
+			assert.Equal(t, []string{"audit", "predator", "transporter"}, hookNames(jobSpec.OrderedHooks()))
+			assert.Equal(t, "transporter", jobSpec.Hooks[0].Unit.Info().Name)
+		})
+	})
+	t.Run("ExpectedCatchupRuns", func(t *testing.T) {
+		t.Run("should count daily runs between start date and now", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					Interval:  "0 2 * * *",
+				},
+			}
+			runs, err := jobSpec.ExpectedCatchupRuns(time.Date(2021, 1, 11, 3, 0, 0, 0, time.UTC))
+			assert.Nil(t, err)
+			// runs of 1st to 10th are due, run of 11th will be due on 12th
+			assert.Equal(t, 10, runs)
+		})
+		t.Run("should count hourly runs between start date and now", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					Interval:  "0 * * * *",
+				},
+			}
+			runs, err := jobSpec.ExpectedCatchupRuns(time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC))
+			assert.Nil(t, err)
+			assert.Equal(t, 48, runs)
+		})
+		t.Run("should stop counting at end date", func(t *testing.T) {
+			endDate := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					EndDate:   &endDate,
+					Interval:  "0 * * * *",
+				},
+			}
+			runs, err := jobSpec.ExpectedCatchupRuns(time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC))
+			assert.Nil(t, err)
+			assert.Equal(t, 24, runs)
+		})
+		t.Run("should count no runs for intervals which never fire", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					Interval:  "0 0 30 2 *",
+				},
+			}
+			runs, err := jobSpec.ExpectedCatchupRuns(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+			assert.Nil(t, err)
+			assert.Equal(t, 0, runs)
+		})
+		t.Run("should approximate runs of frequent intervals started long ago", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC),
+					Interval:  "* * * * *",
+				},
+			}
+			runs, err := jobSpec.ExpectedCatchupRuns(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+			assert.Nil(t, err)
+			assert.InDelta(t, 3653*24*60, runs, 10)
+		})
+		t.Run("should fail for invalid interval", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					Interval:  "invalid",
+				},
+			}
+			_, err := jobSpec.ExpectedCatchupRuns(time.Now())
+			assert.NotNil(t, err)
+		})
+	})
+	t.Run("StartModeIn", func(t *testing.T) {
+		projectSpec := models.ProjectSpec{
+			Config: map[string]string{
+				models.ProjectJobStartModeKey: string(models.JobStartFromNow),
+			},
+		}
+		t.Run("should prefer start mode of the job", func(t *testing.T) {
+			jobSpec := models.JobSpec{Behavior: models.JobSpecBehavior{StartMode: models.JobStartFromStartDate}}
+			assert.Equal(t, models.JobStartFromStartDate, jobSpec.StartModeIn(projectSpec))
+		})
+		t.Run("should prefer catch up of the job over start mode of project", func(t *testing.T) {
+			jobSpec := models.JobSpec{Behavior: models.JobSpecBehavior{CatchUp: true}}
+			assert.Equal(t, models.JobStartFromStartDate, jobSpec.StartModeIn(projectSpec))
+		})
+		t.Run("should use start mode of project otherwise", func(t *testing.T) {
+			assert.Equal(t, models.JobStartFromNow, models.JobSpec{}.StartModeIn(projectSpec))
+			assert.Equal(t, models.JobStartMode(""), models.JobSpec{}.StartModeIn(models.ProjectSpec{}))
+		})
+	})
+	t.Run("ValidateWindowGrain", func(t *testing.T) {
+		t.Run("should fail for schedule interval finer than window", func(t *testing.T) {
+			cases := []struct {
+				Interval   string
+				WindowSize time.Duration
+				TruncateTo string
+			}{
+				{"0 * * * *", 24 * time.Hour, "d"},
+				{"0 2 * * *", 24 * 7 * time.Hour, "w"},
+				{"0 2 * * 1-5", 48 * time.Hour, "d"},
+				{"0 2 * * 0", 24 * 30 * time.Hour, "M"},
+			}
+			for _, tcase := range cases {
+				jobSpec := models.JobSpec{
+					Name: "foo",
+					Schedule: models.JobSpecSchedule{
+						StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						Interval:  tcase.Interval,
+					},
+					Task: models.JobSpecTask{
+						Window: models.JobSpecTaskWindow{
+							Size:       tcase.WindowSize,
+							TruncateTo: tcase.TruncateTo,
+						},
+					},
+				}
+				err := jobSpec.ValidateWindowGrain()
+				assert.True(t, errors.Is(err, models.ErrIntervalFinerThanWindow), tcase.Interval)
+			}
+		})
+		t.Run("should pass for schedule interval matching or coarser than window", func(t *testing.T) {
+			cases := []struct {
+				Interval   string
+				WindowSize time.Duration
+				TruncateTo string
+			}{
+				{"0 * * * *", time.Hour, "h"},
+				{"0 2 * * *", 24 * time.Hour, "d"},
+				{"0 2 * * 0", 24 * 7 * time.Hour, "w"},
+				{"0 2 1 * *", 24 * 30 * time.Hour, "M"},
+				{"0 2 * * *", time.Hour, "h"},
+			}
+			for _, tcase := range cases {
+				jobSpec := models.JobSpec{
+					Name: "foo",
+					Schedule: models.JobSpecSchedule{
+						StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+						Interval:  tcase.Interval,
+					},
+					Task: models.JobSpecTask{
+						Window: models.JobSpecTaskWindow{
+							Size:       tcase.WindowSize,
+							TruncateTo: tcase.TruncateTo,
+						},
+					},
+				}
+				assert.Nil(t, jobSpec.ValidateWindowGrain(), tcase.Interval)
+			}
+		})
+		t.Run("should fail for invalid interval", func(t *testing.T) {
+			jobSpec := models.JobSpec{
+				Schedule: models.JobSpecSchedule{
+					Interval: "invalid",
+				},
+			}
+			assert.NotNil(t, jobSpec.ValidateWindowGrain())
+		})
+	})
 	t.Run("JobSpecTaskWindow", func(t *testing.T) {
 		t.Run("should generate valid window start and end", func(t *testing.T) {
 			cases := []struct {
@@ -145,5 +341,80 @@ func TestJob(t *testing.T) {
 				assert.Equal(t, tcase.ExpectedEnd, windowEnd)
 			}
 		})
+		t.Run("should attach window of each run to job status", func(t *testing.T) {
+			win := &models.JobSpecTaskWindow{
+				Size:       24 * time.Hour,
+				Offset:     0,
+				TruncateTo: "d",
+			}
+			jobStatus := win.AttachTo([]models.JobStatus{
+				{
+					ScheduledAt: time.Date(2020, 11, 11, 2, 0, 0, 0, time.UTC),
+					State:       models.JobStatusStateSuccess,
+				},
+				{
+					ScheduledAt: time.Date(2020, 11, 12, 2, 0, 0, 0, time.UTC),
+					State:       models.JobStatusStateFailed,
+				},
+			})
+			assert.Equal(t, time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC), jobStatus[0].WindowStart)
+			assert.Equal(t, time.Date(2020, 11, 11, 0, 0, 0, 0, time.UTC), jobStatus[0].WindowEnd)
+			assert.Equal(t, time.Date(2020, 11, 11, 0, 0, 0, 0, time.UTC), jobStatus[1].WindowStart)
+			assert.Equal(t, time.Date(2020, 11, 12, 0, 0, 0, 0, time.UTC), jobStatus[1].WindowEnd)
+			assert.Equal(t, models.JobStatusStateFailed, jobStatus[1].State)
+		})
+		t.Run("should shift window back by grace period keeping its size", func(t *testing.T) {
+			win := &models.JobSpecTaskWindow{
+				Size:        24 * time.Hour,
+				Offset:      0,
+				TruncateTo:  "d",
+				GracePeriod: 2 * time.Hour,
+			}
+			today := time.Date(2021, 2, 25, 6, 33, 22, 0, time.UTC)
+			assert.Equal(t, time.Date(2021, 2, 23, 22, 0, 0, 0, time.UTC), win.GetStart(today))
+			assert.Equal(t, time.Date(2021, 2, 24, 22, 0, 0, 0, time.UTC), win.GetEnd(today))
+		})
+		t.Run("should format grace period of window compactly", func(t *testing.T) {
+			for gracePeriod, expected := range map[time.Duration]string{
+				0:                       "",
+				2 * time.Hour:           "2h",
+				90 * time.Minute:        "1h30m",
+				45 * time.Second:        "45s",
+				time.Hour + time.Second: "1h0m1s",
+			} {
+				win := &models.JobSpecTaskWindow{GracePeriod: gracePeriod}
+				assert.Equal(t, expected, win.GracePeriodString())
+			}
+		})
+		t.Run("should align quarterly windows to calendar quarters", func(t *testing.T) {
+			win := &models.JobSpecTaskWindow{
+				Size:       models.HoursInQuarter,
+				Offset:     0,
+				TruncateTo: "q",
+			}
+			quarterStarts := []time.Time{
+				time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+			for month := time.January; month <= time.December; month++ {
+				today := time.Date(2021, month, 15, 6, 33, 22, 0, time.UTC)
+				quarter := (month - 1) / 3
+				assert.Equal(t, quarterStarts[quarter], win.GetStart(today), "month %s", month)
+				assert.Equal(t, quarterStarts[quarter+1], win.GetEnd(today), "month %s", month)
+			}
+		})
+		t.Run("should compose size and offset of quarterly windows in quarters", func(t *testing.T) {
+			win := &models.JobSpecTaskWindow{
+				Size:       2 * models.HoursInQuarter,
+				Offset:     -models.HoursInQuarter,
+				TruncateTo: "q",
+			}
+			today := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+			assert.Equal(t, time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), win.GetStart(today))
+			assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), win.GetEnd(today))
+		})
 	})
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// MetricsRecorder records metrics of optimus internals, implementations
+// can export them to prometheus or similar monitoring systems
+type MetricsRecorder interface {
+	// IncCounter increments the counter with provided labels by one
+	IncCounter(name string, labels map[string]string)
+
+	// ObserveDuration records the duration in histogram with provided labels
+	ObserveDuration(name string, labels map[string]string, duration time.Duration)
+}
+
+// NoopMetrics discards all metrics, used when no recorder is configured
+type NoopMetrics struct{}
+
+func (NoopMetrics) IncCounter(string, map[string]string) {}
+
+func (NoopMetrics) ObserveDuration(string, map[string]string, time.Duration) {}
@@ -15,6 +15,34 @@ const (
 	ProjectStoragePathKey = "STORAGE_PATH"
 	ProjectSchedulerHost  = "SCHEDULER_HOST"
 
+	// ProjectSchedulerAPIBasePath overrides the base path of the scheduler
+	// api, e.g. for gateways rewriting paths, defaults to api/v1 for airflow
+	ProjectSchedulerAPIBasePath = "SCHEDULER_API_BASE_PATH"
+
+	// ProjectStoragePrefixKey optionally namespaces objects of the project
+	// within its storage path, e.g. tenants/<project>, useful when many
+	// projects share a bucket
+	ProjectStoragePrefixKey = "STORAGE_PREFIX"
+
+	// ProjectSharedLibPathKey points to a shared library of snippets, e.g.
+	// gs://bucket/snippets, which assets can include using libInclude
+	ProjectSharedLibPathKey = "SHARED_LIB_PATH"
+
+	// task window used by jobs of the project which don't define one, size
+	// and offset are durations like 24h, truncate to is one of h, d, w, M, q
+	ProjectDefaultWindowSizeKey       = "DEFAULT_WINDOW_SIZE"
+	ProjectDefaultWindowOffsetKey     = "DEFAULT_WINDOW_OFFSET"
+	ProjectDefaultWindowTruncateToKey = "DEFAULT_WINDOW_TRUNCATE_TO"
+
+	// ProjectSchedulerDagLinterURL is the endpoint of an external service
+	// rendered dags are posted to for linting before deploy, dags aren't
+	// linted if not configured
+	ProjectSchedulerDagLinterURL = "SCHEDULER_DAG_LINTER_URL"
+
+	// ProjectJobStartModeKey sets the start mode of jobs of the project
+	// which don't set one, either start_date or now, see JobStartMode
+	ProjectJobStartModeKey = "JOB_START_MODE"
+
 	// Secret used for uploading prepared scheduler specifications to cloud
 	// e.g. for gcs it will be base64 encoded service account for the bucket
 	ProjectSecretStorageKey = "STORAGE"
@@ -57,12 +85,97 @@ func (s ProjectSpec) String() string {
 	return fmt.Sprintf("%s, %v", s.Name, s.Config)
 }
 
+// StoragePrefix returns the object path prefix configured for the project
+// under ProjectStoragePrefixKey, empty if none is configured
+func (s ProjectSpec) StoragePrefix() (string, error) {
+	prefix := strings.Trim(s.Config[ProjectStoragePrefixKey], "/")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, part := range strings.Split(prefix, "/") {
+		if part == "" || part == "." || part == ".." || strings.Contains(part, "\\") {
+			return "", errors.Errorf("invalid %s %s of project %s", ProjectStoragePrefixKey,
+				s.Config[ProjectStoragePrefixKey], s.Name)
+		}
+	}
+	return prefix, nil
+}
+
+// DefaultWindow returns the task window configured as default for jobs of
+// the project, false if the project has no default window
+func (s ProjectSpec) DefaultWindow() (JobSpecTaskWindow, bool, error) {
+	size, ok := s.Config[ProjectDefaultWindowSizeKey]
+	if !ok {
+		return JobSpecTaskWindow{}, false, nil
+	}
+
+	var err error
+	window := JobSpecTaskWindow{
+		TruncateTo: s.Config[ProjectDefaultWindowTruncateToKey],
+	}
+	if window.Size, err = ParseWindowDuration(size); err != nil || window.Size <= 0 {
+		return JobSpecTaskWindow{}, false, errors.Errorf("invalid %s %s of project %s", ProjectDefaultWindowSizeKey, size, s.Name)
+	}
+	if offset, ok := s.Config[ProjectDefaultWindowOffsetKey]; ok {
+		if window.Offset, err = ParseWindowDuration(offset); err != nil {
+			return JobSpecTaskWindow{}, false, errors.Wrapf(err, "invalid %s %s of project %s", ProjectDefaultWindowOffsetKey, offset, s.Name)
+		}
+	}
+	return window, true, nil
+}
+
+// WindowOf returns the window of a job, replaced by the default window of
+// the project for jobs which don't configure one, keeping the grace period
+// of the job. The flag tells if the default window of the project is used
+func (s ProjectSpec) WindowOf(window JobSpecTaskWindow) (JobSpecTaskWindow, bool, error) {
+	if !window.Unset && window.Size != 0 {
+		return window, false, nil
+	}
+	defaultWindow, ok, err := s.DefaultWindow()
+	if err != nil || !ok {
+		return window, false, err
+	}
+	defaultWindow.GracePeriod = window.GracePeriod
+	return defaultWindow, true, nil
+}
+
 type ProjectSecrets []ProjectSecretItem
 
 func (s ProjectSecrets) String() string {
 	return "*redacted*"
 }
 
+// ErrSecretNotFound is matched with errors.Is by errors of SecretProviders
+// for secrets which aren't configured
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves secrets by name, e.g. from a vault, for use in
+// templates. Secrets which aren't configured are reported with an error
+// matching ErrSecretNotFound
+type SecretProvider interface {
+	Get(name string) (string, error)
+}
+
+// Get makes the secrets of a project usable as a SecretProvider
+func (s ProjectSecrets) Get(name string) (string, error) {
+	if val, ok := s.GetByName(name); ok {
+		return val, nil
+	}
+	return "", &secretNotFoundError{name: name}
+}
+
+type secretNotFoundError struct {
+	name string
+}
+
+func (e *secretNotFoundError) Error() string {
+	return fmt.Sprintf("secret %s not found", e.name)
+}
+
+func (e *secretNotFoundError) Is(target error) bool {
+	return target == ErrSecretNotFound
+}
+
 func (s ProjectSecrets) GetByName(name string) (string, bool) {
 	for _, v := range s {
 		if v.Name == name {
@@ -3,6 +3,7 @@ package models_test
 import (
 	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/gtank/cryptopasta"
 	"github.com/stretchr/testify/assert"
@@ -102,4 +103,78 @@ func TestProjectSpec(t *testing.T) {
 			assert.Equal(t, rawSecret, string(value))
 		})
 	})
+	t.Run("StoragePrefix", func(t *testing.T) {
+		t.Run("should return configured prefix without surrounding slashes", func(t *testing.T) {
+			prefix, err := models.ProjectSpec{
+				Name: "test",
+				Config: map[string]string{
+					models.ProjectStoragePrefixKey: "/tenants/test/",
+				},
+			}.StoragePrefix()
+			assert.Nil(t, err)
+			assert.Equal(t, "tenants/test", prefix)
+		})
+		t.Run("should return empty prefix if not configured", func(t *testing.T) {
+			prefix, err := models.ProjectSpec{Name: "test"}.StoragePrefix()
+			assert.Nil(t, err)
+			assert.Equal(t, "", prefix)
+		})
+		t.Run("should fail for prefix traversing outside storage path", func(t *testing.T) {
+			for _, prefix := range []string{"../other", "tenants/../../other", "tenants//test", "./tenants"} {
+				_, err := models.ProjectSpec{
+					Name: "test",
+					Config: map[string]string{
+						models.ProjectStoragePrefixKey: prefix,
+					},
+				}.StoragePrefix()
+				assert.NotNil(t, err, prefix)
+			}
+		})
+	})
+	t.Run("DefaultWindow", func(t *testing.T) {
+		t.Run("should return default window configured for the project", func(t *testing.T) {
+			window, ok, err := models.ProjectSpec{
+				Name: "test",
+				Config: map[string]string{
+					models.ProjectDefaultWindowSizeKey:       "48h",
+					models.ProjectDefaultWindowOffsetKey:     "-24h",
+					models.ProjectDefaultWindowTruncateToKey: "d",
+				},
+			}.DefaultWindow()
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, models.JobSpecTaskWindow{
+				Size:       48 * time.Hour,
+				Offset:     -24 * time.Hour,
+				TruncateTo: "d",
+			}, window)
+		})
+		t.Run("should accept month notation for size of default window", func(t *testing.T) {
+			window, ok, err := models.ProjectSpec{
+				Name: "test",
+				Config: map[string]string{
+					models.ProjectDefaultWindowSizeKey:   "1M",
+					models.ProjectDefaultWindowOffsetKey: "-1M",
+				},
+			}.DefaultWindow()
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, models.HoursInMonth, window.Size)
+			assert.Equal(t, -models.HoursInMonth, window.Offset)
+		})
+		t.Run("should report absence of default window", func(t *testing.T) {
+			_, ok, err := models.ProjectSpec{Name: "test"}.DefaultWindow()
+			assert.Nil(t, err)
+			assert.False(t, ok)
+		})
+		t.Run("should fail for invalid window size", func(t *testing.T) {
+			_, _, err := models.ProjectSpec{
+				Name: "test",
+				Config: map[string]string{
+					models.ProjectDefaultWindowSizeKey: "a day",
+				},
+			}.DefaultWindow()
+			assert.NotNil(t, err)
+		})
+	})
 }
@@ -14,6 +14,10 @@ var (
 	JobStatusStateSuccess JobStatusState = "success"
 	JobStatusStateFailed  JobStatusState = "failed"
 	JobStatusStateRunning JobStatusState = "running"
+
+	JobRunTypeScheduled JobRunType = "scheduled"
+	JobRunTypeManual    JobRunType = "manual"
+	JobRunTypeBackfill  JobRunType = "backfill"
 )
 
 // SchedulerUnit is implemented by supported schedulers
@@ -47,13 +51,46 @@ type SchedulerUnit interface {
 		batchSize int) ([]JobStatus, error)
 }
 
+// RunEvent is a state transition of a task in a run of a job
+type RunEvent struct {
+	Task  string
+	State string
+	At    time.Time
+}
+
 type JobStatusState string
 
 func (j JobStatusState) String() string {
 	return string(j)
 }
 
+// JobRunType tells what triggered a run of the job
+type JobRunType string
+
+func (j JobRunType) String() string {
+	return string(j)
+}
+
 type JobStatus struct {
 	ScheduledAt time.Time
 	State       JobStatusState
+	RunType     JobRunType
+
+	// ExternalTrigger is set for runs triggered manually or through the api
+	// instead of by the schedule
+	ExternalTrigger bool
+
+	// StartedAt and EndedAt are nil when the run is yet to start or finish
+	StartedAt *time.Time
+	EndedAt   *time.Time
+
+	// DataIntervalStart and DataIntervalEnd are the data interval the
+	// scheduler assigned to the run, nil for schedulers not reporting one
+	DataIntervalStart *time.Time
+	DataIntervalEnd   *time.Time
+
+	// WindowStart and WindowEnd are DSTART and DEND of the data the run
+	// processed, zero unless attached with JobSpecTaskWindow.AttachTo
+	WindowStart time.Time
+	WindowEnd   time.Time
 }
@@ -19,6 +19,10 @@ func (gcs *GcsObjectWriter) NewWriter(ctx context.Context, bucket, path string)
 	return b.Object(path).NewWriter(ctx), nil
 }
 
+func (gcs *GcsObjectWriter) Delete(ctx context.Context, bucket, path string) error {
+	return gcs.Client.Bucket(bucket).Object(path).Delete(ctx)
+}
+
 type gcsObjectReader struct {
 	c *storage.Client
 }
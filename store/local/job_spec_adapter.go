@@ -1,8 +1,6 @@
 package local
 
 import (
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,9 +17,7 @@ const (
 )
 
 var (
-	monthExp             = regexp.MustCompile("(\\+|-)?([0-9]+)(M)")
-	HoursInMonth         = time.Duration(30) * 24 * time.Hour
-	ErrNotAMonthDuration = errors.New("invalid month string")
+	HoursInMonth = models.HoursInMonth
 )
 
 func init() {
@@ -53,6 +49,7 @@ type JobSchedule struct {
 type JobBehavior struct {
 	DependsOnPast bool             `yaml:"depends_on_past" json:"depends_on_past"`
 	Catchup       bool             `yaml:"catch_up" json:"catch_up"`
+	StartMode     string           `yaml:"start_mode,omitempty" json:"start_mode,omitempty" validate:"regexp=^(start_date|now|)$"`
 	Retry         JobBehaviorRetry `yaml:"retry,omitempty" json:"retry"`
 	Notify        []JobNotifier    `yaml:"notify,omitempty" json:"notify"`
 }
@@ -70,15 +67,24 @@ type JobNotifier struct {
 }
 
 type JobTask struct {
+	Name     string
+	Config   yaml.MapSlice `yaml:"config,omitempty"`
+	Window   JobTaskWindow
+	Subtasks []JobSubtask `yaml:"subtasks,omitempty"`
+}
+
+// JobSubtask is a named variant of the task, see models.JobSpecSubtask
+type JobSubtask struct {
 	Name   string
 	Config yaml.MapSlice `yaml:"config,omitempty"`
-	Window JobTaskWindow
+	Assets []string      `yaml:"assets,omitempty"`
 }
 
 type JobTaskWindow struct {
-	Size       string
-	Offset     string
-	TruncateTo string `yaml:"truncate_to" validate:"regexp=^(h|d|w|M|m)$"`
+	Size        string
+	Offset      string
+	TruncateTo  string `yaml:"truncate_to" validate:"regexp=^(h|d|w|M|m|q)$"`
+	GracePeriod string `yaml:"grace_period,omitempty"`
 }
 
 type JobHook struct {
@@ -140,6 +146,9 @@ func (conf *Job) MergeFrom(parent Job) {
 	if conf.Behavior.Catchup == false {
 		conf.Behavior.Catchup = parent.Behavior.Catchup
 	}
+	if conf.Behavior.StartMode == "" {
+		conf.Behavior.StartMode = parent.Behavior.StartMode
+	}
 	for _, pNotify := range parent.Behavior.Notify {
 		childNotifyIdx := -1
 		for cnIdx, cn := range conf.Behavior.Notify {
@@ -231,6 +240,9 @@ func (conf *Job) MergeFrom(parent Job) {
 	if conf.Task.Window.Size == "" {
 		conf.Task.Window.Size = parent.Task.Window.Size
 	}
+	if conf.Task.Window.GracePeriod == "" {
+		conf.Task.Window.GracePeriod = parent.Task.Window.GracePeriod
+	}
 	if parent.Task.Config != nil {
 		if conf.Task.Config == nil {
 			conf.Task.Config = []yaml.MapItem{}
@@ -293,32 +305,29 @@ func (conf *Job) prepareWindow() (models.JobSpecTaskWindow, error) {
 	window.Size = time.Hour * 24
 	window.Offset = 0
 	window.TruncateTo = "d"
+	window.Unset = conf.Task.Window.Size == "" && conf.Task.Window.Offset == "" && conf.Task.Window.TruncateTo == ""
 
 	if conf.Task.Window.TruncateTo != "" {
 		window.TruncateTo = conf.Task.Window.TruncateTo
 	}
 
-	// check if string contains monthly notation
+	// size and offset may be in monthly notation
 	if conf.Task.Window.Size != "" {
-		window.Size, err = tryParsingInMonths(conf.Task.Window.Size)
+		window.Size, err = models.ParseWindowDuration(conf.Task.Window.Size)
 		if err != nil {
-			// treat as normal duration
-			window.Size, err = time.ParseDuration(conf.Task.Window.Size)
-			if err != nil {
-				return window, errors.Wrapf(err, "failed to parse task window %s with size %v", conf.Name, conf.Task.Window.Size)
-			}
+			return window, errors.Wrapf(err, "failed to parse task window %s with size %v", conf.Name, conf.Task.Window.Size)
 		}
 	}
-
-	// check if string contains monthly notation
 	if conf.Task.Window.Offset != "" {
-		window.Offset, err = tryParsingInMonths(conf.Task.Window.Offset)
+		window.Offset, err = models.ParseWindowDuration(conf.Task.Window.Offset)
 		if err != nil {
-			// treat as normal duration
-			window.Offset, err = time.ParseDuration(conf.Task.Window.Offset)
-			if err != nil {
-				return window, errors.Wrapf(err, "failed to parse task window %s with offset %v", conf.Name, conf.Task.Window.Offset)
-			}
+			return window, errors.Wrapf(err, "failed to parse task window %s with offset %v", conf.Name, conf.Task.Window.Offset)
+		}
+	}
+	if conf.Task.Window.GracePeriod != "" {
+		window.GracePeriod, err = time.ParseDuration(conf.Task.Window.GracePeriod)
+		if err != nil {
+			return window, errors.Wrapf(err, "failed to parse task window %s with grace period %v", conf.Name, conf.Task.Window.GracePeriod)
 		}
 	}
 
@@ -410,6 +419,15 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 		}
 	}
 
+	var subtasks []models.JobSpecSubtask
+	for _, subtask := range conf.Task.Subtasks {
+		subtasks = append(subtasks, models.JobSpecSubtask{
+			Name:   subtask.Name,
+			Config: JobSpecConfigFromYamlSlice(subtask.Config),
+			Assets: subtask.Assets,
+		})
+	}
+
 	var jobNotifiers []models.JobSpecNotifier
 	for _, notify := range conf.Behavior.Notify {
 		jobNotifiers = append(jobNotifiers, models.JobSpecNotifier{
@@ -432,6 +450,7 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 		},
 		Behavior: models.JobSpecBehavior{
 			CatchUp:       conf.Behavior.Catchup,
+			StartMode:     models.JobStartMode(conf.Behavior.StartMode),
 			DependsOnPast: conf.Behavior.DependsOnPast,
 			Retry: models.JobSpecBehaviorRetry{
 				Count:              conf.Behavior.Retry.Count,
@@ -441,9 +460,10 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 			Notify: jobNotifiers,
 		},
 		Task: models.JobSpecTask{
-			Unit:   execUnit,
-			Config: taskConf,
-			Window: window,
+			Unit:     execUnit,
+			Config:   taskConf,
+			Window:   window,
+			Subtasks: subtasks,
 		},
 		Assets:       models.JobAssets{}.FromMap(conf.Asset),
 		Dependencies: dependencies,
@@ -475,6 +495,15 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 		retryDelayDuration = spec.Behavior.Retry.Delay.String()
 	}
 
+	var subtasks []JobSubtask
+	for _, subtask := range spec.Task.Subtasks {
+		subtasks = append(subtasks, JobSubtask{
+			Name:   subtask.Name,
+			Config: JobSpecConfigToYamlSlice(subtask.Config),
+			Assets: subtask.Assets,
+		})
+	}
+
 	var notifiers []JobNotifier
 	for _, notify := range spec.Behavior.Notify {
 		notifiers = append(notifiers, JobNotifier{
@@ -497,6 +526,7 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 		Behavior: JobBehavior{
 			DependsOnPast: spec.Behavior.DependsOnPast,
 			Catchup:       spec.Behavior.CatchUp,
+			StartMode:     string(spec.Behavior.StartMode),
 			Retry: JobBehaviorRetry{
 				Count:              spec.Behavior.Retry.Count,
 				Delay:              retryDelayDuration,
@@ -505,19 +535,23 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 			Notify: notifiers,
 		},
 		Task: JobTask{
-			Name:   spec.Task.Unit.Info().Name,
-			Config: taskConf,
-			Window: JobTaskWindow{
-				Size:       spec.Task.Window.SizeString(),
-				Offset:     spec.Task.Window.OffsetString(),
-				TruncateTo: spec.Task.Window.TruncateTo,
-			},
+			Name:     spec.Task.Unit.Info().Name,
+			Config:   taskConf,
+			Subtasks: subtasks,
 		},
 		Asset:        spec.Assets.ToMap(),
 		Dependencies: []JobDependency{},
 		Hooks:        []JobHook{},
 	}
 
+	if !spec.Task.Window.Unset {
+		parsed.Task.Window = JobTaskWindow{
+			Size:       spec.Task.Window.SizeString(),
+			Offset:     spec.Task.Window.OffsetString(),
+			TruncateTo: spec.Task.Window.TruncateTo,
+		}
+	}
+	parsed.Task.Window.GracePeriod = spec.Task.Window.GracePeriodString()
 	if spec.Schedule.EndDate != nil {
 		parsed.Schedule.EndDate = spec.Schedule.EndDate.Format(models.JobDatetimeLayout)
 	}
@@ -567,32 +601,3 @@ func JobSpecConfigFromYamlSlice(conf yaml.MapSlice) models.JobSpecConfigs {
 	}
 	return conv
 }
-
-// check if string contains monthly notation
-func tryParsingInMonths(str string) (time.Duration, error) {
-	sz := time.Duration(0)
-	monthMatches := monthExp.FindAllStringSubmatch(str, -1)
-	if len(monthMatches) > 0 && len(monthMatches[0]) == 4 {
-		// replace month notation with days first, treating 1M as 30 days
-		monthsCount, err := strconv.Atoi(monthMatches[0][2])
-		if err != nil {
-			return sz, errors.Wrapf(err, "failed to parse task configuration of %s", str)
-		}
-		sz = HoursInMonth * time.Duration(monthsCount)
-		if monthMatches[0][1] == "-" {
-			sz *= -1
-		}
-
-		str = strings.TrimSpace(monthExp.ReplaceAllString(str, ""))
-		if len(str) > 0 {
-			// check if there is remaining time that we can still parse
-			remainingTime, err := time.ParseDuration(str)
-			if err != nil {
-				return sz, errors.Wrapf(err, "failed to parse task configuration of %s", str)
-			}
-			sz += remainingTime
-		}
-		return sz, nil
-	}
-	return sz, ErrNotAMonthDuration
-}
@@ -3,6 +3,7 @@ package local_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/odpf/optimus/models"
 
@@ -69,6 +70,160 @@ hooks: []
 
 		assert.Equal(t, localJobParsed, localJobBack)
 	})
+	t.Run("should use default window of project for jobs without a window", func(t *testing.T) {
+		yamlSpec := `
+version: 1
+name: test_job
+owner: test@example.com
+schedule:
+  start_date: "2021-02-03"
+  interval: 0 2 * * *
+task:
+  name: bq2bq
+  config:
+    PROJECT: project
+`
+		var localJobParsed local.Job
+		err := yaml.Unmarshal([]byte(yamlSpec), &localJobParsed)
+		assert.Nil(t, err)
+
+		execUnit := new(mock.BasePlugin)
+		execUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+			Name: "bq2bq",
+		}, nil)
+		pluginRepo := new(mock.SupportedPluginRepo)
+		pluginRepo.On("GetByName", "bq2bq").Return(&models.Plugin{
+			Base: execUnit,
+		}, nil)
+		adapter := local.NewJobSpecAdapter(pluginRepo)
+
+		modelJob, err := adapter.ToSpec(localJobParsed)
+		assert.Nil(t, err)
+		assert.True(t, modelJob.Task.Window.Unset)
+
+		window, ok, err := models.ProjectSpec{
+			Name: "test",
+			Config: map[string]string{
+				models.ProjectDefaultWindowSizeKey:       "1M",
+				models.ProjectDefaultWindowTruncateToKey: "M",
+			},
+		}.WindowOf(modelJob.Task.Window)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, models.JobSpecTaskWindow{Size: models.HoursInMonth, TruncateTo: "M"}, window)
+
+		window, ok, err = models.ProjectSpec{Name: "test"}.WindowOf(modelJob.Task.Window)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 24*time.Hour, window.Size)
+
+		localJobBack, err := adapter.FromSpec(modelJob)
+		assert.Nil(t, err)
+		assert.Equal(t, local.JobTaskWindow{}, localJobBack.Task.Window)
+	})
+	t.Run("should convert grace period of window from yaml to optimus model & back successfully", func(t *testing.T) {
+		yamlSpec := `
+version: 1
+name: test_job
+owner: test@example.com
+schedule:
+  start_date: "2021-02-03"
+  interval: 0 2 * * *
+task:
+  name: bq2bq
+  config:
+    PROJECT: project
+  window:
+    size: 24h
+    offset: 0
+    truncate_to: d
+    grace_period: 2h
+`
+		var localJobParsed local.Job
+		err := yaml.Unmarshal([]byte(yamlSpec), &localJobParsed)
+		assert.Nil(t, err)
+
+		execUnit := new(mock.BasePlugin)
+		execUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+			Name: "bq2bq",
+		}, nil)
+		pluginRepo := new(mock.SupportedPluginRepo)
+		pluginRepo.On("GetByName", "bq2bq").Return(&models.Plugin{
+			Base: execUnit,
+		}, nil)
+		adapter := local.NewJobSpecAdapter(pluginRepo)
+
+		modelJob, err := adapter.ToSpec(localJobParsed)
+		assert.Nil(t, err)
+		assert.Equal(t, 2*time.Hour, modelJob.Task.Window.GracePeriod)
+
+		localJobBack, err := adapter.FromSpec(modelJob)
+		assert.Nil(t, err)
+		assert.Equal(t, localJobParsed.Task.Window, localJobBack.Task.Window)
+
+		localJobParsed.Task.Window.GracePeriod = "2 hours"
+		_, err = adapter.ToSpec(localJobParsed)
+		assert.NotNil(t, err)
+	})
+	t.Run("should convert subtasks of task from yaml to optimus model & back successfully", func(t *testing.T) {
+		yamlSpec := `
+version: 1
+name: test_job
+owner: test@example.com
+schedule:
+  start_date: "2021-02-03"
+  interval: 0 2 * * *
+task:
+  name: bq2bq
+  config:
+    PROJECT: project
+    TABLE: events
+  subtasks:
+    - name: daily
+      config:
+        TABLE: daily_events
+      assets:
+        - daily.sql
+    - name: hourly
+`
+		var localJobParsed local.Job
+		err := yaml.Unmarshal([]byte(yamlSpec), &localJobParsed)
+		assert.Nil(t, err)
+
+		execUnit := new(mock.BasePlugin)
+		execUnit.On("PluginInfo").Return(&models.PluginInfoResponse{
+			Name: "bq2bq",
+		}, nil)
+		pluginRepo := new(mock.SupportedPluginRepo)
+		pluginRepo.On("GetByName", "bq2bq").Return(&models.Plugin{
+			Base: execUnit,
+		}, nil)
+		adapter := local.NewJobSpecAdapter(pluginRepo)
+
+		modelJob, err := adapter.ToSpec(localJobParsed)
+		assert.Nil(t, err)
+		assert.Equal(t, []models.JobSpecSubtask{
+			{
+				Name: "daily",
+				Config: models.JobSpecConfigs{
+					{
+						Name:  "TABLE",
+						Value: "daily_events",
+					},
+				},
+				Assets: []string{"daily.sql"},
+			},
+			{
+				Name:   "hourly",
+				Config: models.JobSpecConfigs{},
+			},
+		}, modelJob.Task.Subtasks)
+
+		localJobBack, err := adapter.FromSpec(modelJob)
+		assert.Nil(t, err)
+		assert.Equal(t, localJobParsed.Task.Subtasks[0], localJobBack.Task.Subtasks[0])
+		assert.Equal(t, "hourly", localJobBack.Task.Subtasks[1].Name)
+	})
 }
 
 func TestJob_MergeFrom(t *testing.T) {
@@ -35,10 +35,13 @@ type Job struct {
 
 	TaskName         string
 	TaskConfig       datatypes.JSON
-	WindowSize       *int64 //duration in nanos
+	WindowSize       *int64 //duration in nanos, nil if the job has no window
 	WindowOffset     *int64
 	WindowTruncateTo *string
 
+	WindowGracePeriod *int64
+	Subtasks          datatypes.JSON
+
 	Assets datatypes.JSON
 	Hooks  datatypes.JSON
 
@@ -50,6 +53,7 @@ type Job struct {
 type JobBehavior struct {
 	DependsOnPast bool
 	CatchUp       bool
+	StartMode     string
 	Retry         JobBehaviorRetry
 	Notify        []JobBehaviorNotifier
 }
@@ -85,6 +89,28 @@ func (a JobAsset) FromSpec(spec models.JobSpecAsset) JobAsset {
 	}
 }
 
+type JobSubtask struct {
+	Name   string
+	Config models.JobSpecConfigs
+	Assets []string
+}
+
+func (a JobSubtask) ToSpec() models.JobSpecSubtask {
+	return models.JobSpecSubtask{
+		Name:   a.Name,
+		Config: a.Config,
+		Assets: a.Assets,
+	}
+}
+
+func (a JobSubtask) FromSpec(spec models.JobSpecSubtask) JobSubtask {
+	return JobSubtask{
+		Name:   spec.Name,
+		Config: spec.Config,
+		Assets: spec.Assets,
+	}
+}
+
 type JobHook struct {
 	Name   string
 	Config datatypes.JSON
@@ -181,11 +207,39 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 		jobHooks = append(jobHooks, hookSpec)
 	}
 
+	//prep subtasks
+	var subtasks []models.JobSpecSubtask
+	if conf.Subtasks != nil {
+		subtasksRaw := []JobSubtask{}
+		if err := json.Unmarshal(conf.Subtasks, &subtasksRaw); err != nil {
+			return models.JobSpec{}, err
+		}
+		for _, subtask := range subtasksRaw {
+			subtasks = append(subtasks, subtask.ToSpec())
+		}
+	}
+
 	execUnit, err := adapt.pluginRepo.GetByName(conf.TaskName)
 	if err != nil {
 		return models.JobSpec{}, errors.Wrap(err, "spec reading error")
 	}
 
+	window := models.JobSpecTaskWindow{
+		Size:       24 * time.Hour,
+		TruncateTo: "d",
+		Unset:      true,
+	}
+	if conf.WindowSize != nil {
+		window = models.JobSpecTaskWindow{
+			Size:       time.Duration(*conf.WindowSize),
+			Offset:     time.Duration(*conf.WindowOffset),
+			TruncateTo: *conf.WindowTruncateTo,
+		}
+	}
+	if conf.WindowGracePeriod != nil {
+		window.GracePeriod = time.Duration(*conf.WindowGracePeriod)
+	}
+
 	var notifiers []models.JobSpecNotifier
 	for _, notify := range behavior.Notify {
 		notifiers = append(notifiers, models.JobSpecNotifier{
@@ -210,6 +264,7 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 		Behavior: models.JobSpecBehavior{
 			DependsOnPast: behavior.DependsOnPast,
 			CatchUp:       behavior.CatchUp,
+			StartMode:     models.JobStartMode(behavior.StartMode),
 			Retry: models.JobSpecBehaviorRetry{
 				Count:              behavior.Retry.Count,
 				Delay:              time.Duration(behavior.Retry.Delay),
@@ -218,13 +273,10 @@ func (adapt JobSpecAdapter) ToSpec(conf Job) (models.JobSpec, error) {
 			Notify: notifiers,
 		},
 		Task: models.JobSpecTask{
-			Unit:   execUnit,
-			Config: taskConf,
-			Window: models.JobSpecTaskWindow{
-				Size:       time.Duration(*conf.WindowSize),
-				Offset:     time.Duration(*conf.WindowOffset),
-				TruncateTo: *conf.WindowTruncateTo,
-			},
+			Unit:     execUnit,
+			Config:   taskConf,
+			Window:   window,
+			Subtasks: subtasks,
 		},
 		Assets:       *(models.JobAssets{}).New(jobAssets),
 		Dependencies: dependencies,
@@ -256,6 +308,7 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 	behaviorJSON, err := json.Marshal(JobBehavior{
 		DependsOnPast: spec.Behavior.DependsOnPast,
 		CatchUp:       spec.Behavior.CatchUp,
+		StartMode:     string(spec.Behavior.StartMode),
 		Retry: JobBehaviorRetry{
 			Count:              spec.Behavior.Retry.Count,
 			Delay:              spec.Behavior.Retry.Delay.Nanoseconds(),
@@ -307,8 +360,23 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 		return Job{}, err
 	}
 
-	wsize := spec.Task.Window.Size.Nanoseconds()
-	woffset := spec.Task.Window.Offset.Nanoseconds()
+	subtasks := []JobSubtask{}
+	for _, subtask := range spec.Task.Subtasks {
+		subtasks = append(subtasks, JobSubtask{}.FromSpec(subtask))
+	}
+	subtasksJSON, err := json.Marshal(subtasks)
+	if err != nil {
+		return Job{}, err
+	}
+
+	// windows the job doesn't configure are stored as null
+	var wsize, woffset *int64
+	var wtruncateTo *string
+	if !spec.Task.Window.Unset {
+		size, offset := spec.Task.Window.Size.Nanoseconds(), spec.Task.Window.Offset.Nanoseconds()
+		wsize, woffset, wtruncateTo = &size, &offset, &spec.Task.Window.TruncateTo
+	}
+	wgracePeriod := spec.Task.Window.GracePeriod.Nanoseconds()
 
 	var jobDestination string
 	if spec.Task.Unit.DependencyMod != nil {
@@ -337,11 +405,14 @@ func (adapt JobSpecAdapter) FromSpec(spec models.JobSpec) (Job, error) {
 		Dependencies:     dependenciesJSON,
 		TaskName:         spec.Task.Unit.Info().Name,
 		TaskConfig:       taskConfigJSON,
-		WindowSize:       &wsize,
-		WindowOffset:     &woffset,
-		WindowTruncateTo: &spec.Task.Window.TruncateTo,
+		WindowSize:       wsize,
+		WindowOffset:     woffset,
+		WindowTruncateTo: wtruncateTo,
 		Assets:           assetsJSON,
 		Hooks:            hooksJSON,
+
+		WindowGracePeriod: &wgracePeriod,
+		Subtasks:          subtasksJSON,
 	}, nil
 }
 
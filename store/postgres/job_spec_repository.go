@@ -126,7 +126,18 @@ func (repo *JobSpecRepository) Save(spec models.JobSpec) error {
 	}
 	resource.ID = existingJobSpec.ID
 
-	return repo.db.Model(resource).Updates(resource).Error
+	if err := repo.db.Model(resource).Updates(resource).Error; err != nil {
+		return err
+	}
+	if resource.WindowSize == nil {
+		// updates skip nil fields, windows no longer configured are cleared
+		return repo.db.Model(resource).Updates(map[string]interface{}{
+			"window_size":        nil,
+			"window_offset":      nil,
+			"window_truncate_to": nil,
+		}).Error
+	}
+	return nil
 }
 
 func (repo *JobSpecRepository) GetByID(id uuid.UUID) (models.JobSpec, error) {
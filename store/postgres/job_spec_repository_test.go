@@ -520,6 +520,79 @@ func TestJobRepository(t *testing.T) {
 			assert.Equal(t, false, checkModel.Behavior.CatchUp)
 			assert.Equal(t, true, checkModel.Behavior.DependsOnPast)
 		})
+		t.Run("should properly insert grace period of window, reading and writing", func(t *testing.T) {
+			db := DBSetup()
+			defer db.Close()
+			testModelA := testConfigs[0]
+			testModelA.Task.Window.GracePeriod = time.Hour * 2
+
+			unitData1 := models.GenerateDestinationRequest{Config: models.PluginConfigs{}.FromJobSpec(testConfigs[0].Task.Config), Assets: models.PluginAssets{}.FromJobSpec(testConfigs[0].Assets)}
+			depMod1.On("GenerateDestination", context.TODO(), unitData1).Return(&models.GenerateDestinationResponse{Destination: destination}, nil)
+			defer execUnit1.AssertExpectations(t)
+			defer depMod1.AssertExpectations(t)
+
+			projectJobSpecRepo := NewProjectJobSpecRepository(db, projectSpec, adapter)
+			repo := NewJobSpecRepository(db, namespaceSpec, projectJobSpecRepo, adapter)
+
+			//try for create
+			err := repo.Save(testModelA)
+			assert.Nil(t, err)
+
+			checkModel, err := repo.GetByID(testModelA.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, time.Hour*2, checkModel.Task.Window.GracePeriod)
+
+			//try for update
+			testModelA.Task.Window.GracePeriod = 0
+			err = repo.Save(testModelA)
+			assert.Nil(t, err)
+
+			checkModel, err = repo.GetByID(testModelA.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, time.Duration(0), checkModel.Task.Window.GracePeriod)
+		})
+		t.Run("should properly insert subtasks of task, reading and writing", func(t *testing.T) {
+			db := DBSetup()
+			defer db.Close()
+			testModelA := testConfigs[0]
+			testModelA.Task.Subtasks = []models.JobSpecSubtask{
+				{
+					Name: "daily",
+					Config: models.JobSpecConfigs{
+						{
+							Name:  "TABLE",
+							Value: "daily_events",
+						},
+					},
+					Assets: []string{"query.sql"},
+				},
+			}
+
+			unitData1 := models.GenerateDestinationRequest{Config: models.PluginConfigs{}.FromJobSpec(testConfigs[0].Task.Config), Assets: models.PluginAssets{}.FromJobSpec(testConfigs[0].Assets)}
+			depMod1.On("GenerateDestination", context.TODO(), unitData1).Return(&models.GenerateDestinationResponse{Destination: destination}, nil)
+			defer execUnit1.AssertExpectations(t)
+			defer depMod1.AssertExpectations(t)
+
+			projectJobSpecRepo := NewProjectJobSpecRepository(db, projectSpec, adapter)
+			repo := NewJobSpecRepository(db, namespaceSpec, projectJobSpecRepo, adapter)
+
+			//try for create
+			err := repo.Save(testModelA)
+			assert.Nil(t, err)
+
+			checkModel, err := repo.GetByID(testModelA.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, testModelA.Task.Subtasks, checkModel.Task.Subtasks)
+
+			//try for update
+			testModelA.Task.Subtasks = nil
+			err = repo.Save(testModelA)
+			assert.Nil(t, err)
+
+			checkModel, err = repo.GetByID(testModelA.ID)
+			assert.Nil(t, err)
+			assert.Nil(t, checkModel.Task.Subtasks)
+		})
 	})
 
 	t.Run("GetByName", func(t *testing.T) {
@@ -83,6 +83,12 @@ type ObjectWriter interface {
 	NewWriter(ctx context.Context, bucket, path string) (io.WriteCloser, error)
 }
 
+// ObjectDeleter removes objects written by an ObjectWriter, implemented by
+// writers which support it
+type ObjectDeleter interface {
+	Delete(ctx context.Context, bucket, path string) error
+}
+
 // ObjectReader similar to objectWriter but for reading
 type ObjectReader interface {
 	NewReader(bucket, path string) (io.ReadCloser, error)